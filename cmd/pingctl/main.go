@@ -0,0 +1,295 @@
+package main
+
+// This file contains a command line client for the PingService.  Each RPC is
+// exposed as a subcommand and the results are printed as JSON, one message per
+// line, making it suitable for smoke testing a deployed pingsrv.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	// Registers the google.rpc error details so that those returned by the server can be printed
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+)
+
+var (
+	addr        = flag.String("addr", "localhost:8080", "the host:port, or URL, of the pingsrv server, http:// URLs use cleartext HTTP/2, and unix:// URLs a Unix socket")
+	caFile      = flag.String("ca", "", "PEM file containing the CA certificates used to verify the server, for example testing.crt")
+	serverName  = flag.String("server-name", "", "overrides the host name used to verify the server certificate")
+	certFile    = flag.String("cert", "", "PEM file containing the client certificate presented to servers requiring mutual TLS")
+	keyFile     = flag.String("key", "", "PEM file containing the private key of the client certificate")
+	token       = flag.String("token", os.Getenv("ACCESS_TOKEN"), "bearer token sent with every request, defaults to the ACCESS_TOKEN environment variable")
+	counter     = flag.String("counter", "", "the name of the server counter to use, empty selects the default counter")
+	protocol    = flag.String("protocol", string(client.ProtocolConnect), "the wire protocol to use, one of connect, grpc, or grpcweb")
+	http3       = flag.Bool("http3", false, "use HTTP/3 over QUIC, the server must have its HTTP/3 listener enabled")
+	compression = flag.String("compression", string(client.CompressionNone), "the compression applied to requests, one of none, or gzip")
+	dialTimeout = flag.Duration("dial-timeout", 5*time.Second, "the maximum time allowed for establishing connections")
+	timeout     = flag.Duration("timeout", 30*time.Second, "the deadline applied to each RPC, zero disables the deadline")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: %s [flags] command [arguments]
+
+commands:
+  ping                     return the current counter and the server timestamp
+  sum addition...          stream the additions to the server and return the new total
+  generate addition        have the server stream back the increments of the total
+  count addition...        stream the additions and receive every increment of the total
+  watch                    stream the current counter followed by every change made to it
+  reset [expected]         return the counter to zero, only if it holds the expected value when supplied
+  set value [expected]     assign the value to the counter, only if it holds the expected value when supplied
+  hardfail code [detail...] have the server fail with the code, a name such as unavailable or a number,
+                           attaching the details error_info, retry_info, debug_info, or bad_request
+  faults [file]            print the fault injection rules, or replace them using a JSON SetFaultRulesRequest file
+
+flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	pingClient, err := client.NewClient(*addr, client.Opts{
+		CAFile:      *caFile,
+		ServerName:  *serverName,
+		CertFile:    *certFile,
+		KeyFile:     *keyFile,
+		Token:       *token,
+		Counter:     *counter,
+		Protocol:    client.Protocol(*protocol),
+		Compression: client.Compression(*compression),
+		HTTP3:       *http3,
+		DialTimeout: *dialTimeout,
+		Timeout:     *timeout,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-2)
+	}
+
+	if errGo := run(context.Background(), pingClient, flag.Arg(0), flag.Args()[1:]); errGo != nil {
+		printError(errGo)
+		os.Exit(-3)
+	}
+}
+
+func run(ctx context.Context, pingClient *client.Client, cmd string, args []string) (err error) {
+	switch cmd {
+	case "ping":
+		resp, err := pingClient.Ping(ctx)
+		if err != nil {
+			return err
+		}
+		return printMsg(resp)
+	case "sum":
+		additions, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		resp, err := pingClient.Sum(ctx, additions)
+		if err != nil {
+			return err
+		}
+		return printMsg(resp)
+	case "generate":
+		additions, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		if len(additions) != 1 {
+			return fmt.Errorf("generate expects a single addition")
+		}
+		return pingClient.Generate(ctx, additions[0], func(msg *pingv1.GenerateResponse) error {
+			return printMsg(msg)
+		})
+	case "count":
+		additions, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		return pingClient.Count(ctx, additions, func(msg *pingv1.CountResponse) error {
+			return printMsg(msg)
+		})
+	case "watch":
+		return pingClient.Watch(ctx, func(msg *pingv1.WatchResponse) error {
+			return printMsg(msg)
+		})
+	case "reset":
+		values, err := parseTotals(args)
+		if err != nil {
+			return err
+		}
+		if len(values) > 1 {
+			return fmt.Errorf("reset expects at most one expected value")
+		}
+		var expected *int64
+		if len(values) == 1 {
+			expected = &values[0]
+		}
+		resp, err := pingClient.Reset(ctx, expected)
+		if err != nil {
+			return err
+		}
+		return printMsg(resp)
+	case "set":
+		values, err := parseTotals(args)
+		if err != nil {
+			return err
+		}
+		if len(values) < 1 || len(values) > 2 {
+			return fmt.Errorf("set expects a value and an optional expected value")
+		}
+		var expected *int64
+		if len(values) == 2 {
+			expected = &values[1]
+		}
+		resp, err := pingClient.Set(ctx, values[0], expected)
+		if err != nil {
+			return err
+		}
+		return printMsg(resp)
+	case "hardfail":
+		if len(args) < 1 {
+			return fmt.Errorf("hardfail expects a failure code and optional error details")
+		}
+		code, err := parseCode(args[0])
+		if err != nil {
+			return err
+		}
+		details, err := parseDetails(args[1:])
+		if err != nil {
+			return err
+		}
+		return pingClient.HardFail(ctx, code, details...)
+	case "faults":
+		if len(args) > 1 {
+			return fmt.Errorf("faults expects at most one rules file")
+		}
+		if len(args) == 1 {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			req := &pingv1.SetFaultRulesRequest{}
+			if err = protojson.Unmarshal(data, req); err != nil {
+				return fmt.Errorf("invalid rules file %q: %w", args[0], err)
+			}
+			if err = pingClient.SetFaultRules(ctx, req.Rules); err != nil {
+				return err
+			}
+		}
+		resp, err := pingClient.GetFaultRules(ctx)
+		if err != nil {
+			return err
+		}
+		return printMsg(resp)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func parseValues(args []string) (values []int32, err error) {
+	values = make([]int32, 0, len(args))
+	for _, arg := range args {
+		value, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %w", arg, err)
+		}
+		values = append(values, int32(value))
+	}
+	return values, nil
+}
+
+// parseTotals parses the values of counters, which unlike additions use the full range of an int64
+func parseTotals(args []string) (values []int64, err error) {
+	values = make([]int64, 0, len(args))
+	for _, arg := range args {
+		value, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %w", arg, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func parseCode(arg string) (code connect.Code, err error) {
+	if errGo := code.UnmarshalText([]byte(arg)); errGo == nil {
+		return code, nil
+	}
+	value, errGo := strconv.ParseUint(arg, 10, 32)
+	if errGo != nil {
+		return code, fmt.Errorf("invalid failure code %q", arg)
+	}
+	return connect.Code(value), nil
+}
+
+func parseDetails(args []string) (details []pingv1.ErrorDetail, err error) {
+	details = make([]pingv1.ErrorDetail, 0, len(args))
+	for _, arg := range args {
+		value, isPresent := pingv1.ErrorDetail_value["ERROR_DETAIL_"+strings.ToUpper(arg)]
+		if !isPresent || value == 0 {
+			return nil, fmt.Errorf("invalid error detail %q", arg)
+		}
+		details = append(details, pingv1.ErrorDetail(value))
+	}
+	return details, nil
+}
+
+func printMsg(msg proto.Message) (err error) {
+	output, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// printError outputs errors as a JSON document so that scripts can inspect the code
+// and error details returned by the server
+func printError(err error) {
+	details := []json.RawMessage{}
+	if connectErr := new(connect.Error); errors.As(err, &connectErr) {
+		for _, detail := range connectErr.Details() {
+			msg, errGo := detail.Value()
+			if errGo != nil {
+				continue
+			}
+			if output, errGo := protojson.Marshal(msg); errGo == nil {
+				details = append(details, output)
+			}
+		}
+	}
+	output, _ := json.Marshal(struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details,omitempty"`
+	}{
+		Code:    connect.CodeOf(err).String(),
+		Message: err.Error(),
+		Details: details,
+	})
+	fmt.Println(string(output))
+}
@@ -0,0 +1,230 @@
+package main
+
+// This file contains the hot reloading of the server TLS certificate and key.  The
+// files are watched for changes, and a SIGHUP can be used to force a reload, with the
+// new certificate handed out to TLS handshakes using tls.Config.GetCertificate.  In
+// development the certificate can instead be generated, see ensureDevCerts.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/buf-ping/pkg/devcert"
+	"github.com/karlmutch/go-service/pkg/runtime"
+
+	"github.com/karlmutch/kv"
+)
+
+// devCertHosts returns the host names, and IP addresses, the generated certificate is issued
+// for, localhost and the loopback addresses, the host name of the machine, the addresses the
+// listeners are bound to, and any extra hosts configured
+func devCertHosts(opts *serverOpts) (hosts []string) {
+	candidates := []string{"localhost", "127.0.0.1", "::1", opts.cfgHost}
+	if hostname, errGo := os.Hostname(); errGo == nil {
+		candidates = append(candidates, hostname)
+	}
+	for _, addr := range []string{opts.ipPort, opts.http3Addr} {
+		if host, _, errGo := net.SplitHostPort(addr); errGo == nil {
+			if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+				candidates = append(candidates, host)
+			}
+		}
+	}
+	candidates = append(candidates, strings.Split(opts.devCertHosts, ",")...)
+
+	seen := map[string]struct{}{}
+	for _, host := range candidates {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if _, isPresent := seen[host]; isPresent || len(host) == 0 {
+			continue
+		}
+		seen[host] = struct{}{}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// ensureDevCerts generates a development CA, and a server certificate issued by it, when the
+// certificate files are missing, reusing them on later runs until they near expiry
+func ensureDevCerts(opts *serverOpts) (err kv.Error) {
+	hosts := devCertHosts(opts)
+	result, err := devcert.Ensure(devcert.Opts{
+		CertFn: opts.certPemFn,
+		KeyFn:  opts.certKeyFn,
+		CAFn:   opts.devCAFn,
+		Hosts:  hosts,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case result.IsUserManaged:
+		opts.logger.Info("development certificates not generated, using the existing certificate", "cert", opts.certPemFn)
+	case result.IsCAGenerated:
+		opts.logger.Warn("development CA generated, clients must be given the new CA", "ca", opts.devCAFn, "cert", opts.certPemFn,
+			"hosts", hosts, "not_after", result.NotAfter.UTC().Format(time.RFC3339))
+	case result.IsIssued:
+		opts.logger.Info("development certificate issued", "ca", opts.devCAFn, "cert", opts.certPemFn,
+			"hosts", hosts, "not_after", result.NotAfter.UTC().Format(time.RFC3339))
+	default:
+		opts.logger.Info("development certificate reused", "ca", opts.devCAFn, "cert", opts.certPemFn,
+			"not_after", result.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// reloadSettle is the time file events must stop arriving for before the certificate is reloaded
+const reloadSettle = 250 * time.Millisecond
+
+// certReloader holds the current server certificate and replaces it whenever the
+// certificate or key files change
+type certReloader struct {
+	certPemFn string
+	certKeyFn string
+
+	cert   atomic.Pointer[tls.Certificate]
+	logger *slog.Logger
+}
+
+// newCertReloader loads the initial certificate and starts watching for changes, the
+// watching stops when the context is cancelled
+func newCertReloader(ctx context.Context, opts *serverOpts) (reloader *certReloader, err kv.Error) {
+	reloader = &certReloader{
+		certPemFn: opts.certPemFn,
+		certKeyFn: opts.certKeyFn,
+		logger:    opts.logger,
+	}
+
+	cert, err := reloader.load()
+	if err != nil {
+		return nil, err
+	}
+	reloader.cert.Store(cert)
+
+	// The directories are watched rather than the files as cert-manager, and Kubernetes
+	// secret volumes, replace files by swapping symbolic links
+	watcher, errGo := fsnotify.NewWatcher()
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	dirs := map[string]struct{}{
+		filepath.Dir(opts.certPemFn): {},
+		filepath.Dir(opts.certKeyFn): {},
+	}
+	for dir := range dirs {
+		if errGo = watcher.Add(dir); errGo != nil {
+			watcher.Close()
+			return nil, kv.Wrap(errGo).With("dir", dir, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+
+	hupC := make(chan os.Signal, 1)
+	signal.Notify(hupC, syscall.SIGHUP)
+
+	go reloader.watch(ctx, watcher, hupC)
+
+	return reloader, nil
+}
+
+// GetCertificate is used by tls.Config to retrieve the current certificate
+func (reloader *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return reloader.cert.Load(), nil
+}
+
+func (reloader *certReloader) load() (cert *tls.Certificate, err kv.Error) {
+	pair, errGo := tls.LoadX509KeyPair(reloader.certPemFn, reloader.certKeyFn)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("cert", reloader.certPemFn, "key", reloader.certKeyFn, "stack", stack.Trace().TrimRuntime())
+	}
+	if pair.Leaf, errGo = x509.ParseCertificate(pair.Certificate[0]); errGo != nil {
+		return nil, kv.Wrap(errGo).With("cert", reloader.certPemFn, "stack", stack.Trace().TrimRuntime())
+	}
+	return &pair, nil
+}
+
+func (reloader *certReloader) watch(ctx context.Context, watcher *fsnotify.Watcher, hupC chan os.Signal) {
+	defer func() {
+		signal.Stop(hupC)
+		watcher.Close()
+	}()
+
+	// File events arrive in bursts while files are being replaced so they are
+	// debounced before a reload is attempted
+	settle := time.NewTimer(time.Hour)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupC:
+			reloader.reload(ctx, "SIGHUP")
+		case event, isOK := <-watcher.Events:
+			if !isOK {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			settle.Reset(reloadSettle)
+		case <-settle.C:
+			reloader.reload(ctx, "file change")
+		case errGo, isOK := <-watcher.Errors:
+			if !isOK {
+				return
+			}
+			reloader.logger.Warn("certificate watcher failure", "error", kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime()).Error())
+		}
+	}
+}
+
+// reload replaces the current certificate, failures leave the existing certificate in place
+func (reloader *certReloader) reload(ctx context.Context, reason string) {
+	_, span := otel.GetTracerProvider().Tracer(runtime.BuildInfo.ProjectPath).Start(ctx, "certificate reload")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("reason", reason))
+
+	cert, err := reloader.load()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		reloader.logger.Warn("certificate reload failed, continuing with the existing certificate", "reason", reason, "error", err.Error())
+		return
+	}
+
+	// Files being touched, or a SIGHUP, without the certificate changing is not a rotation
+	if bytes.Equal(cert.Certificate[0], reloader.cert.Load().Certificate[0]) {
+		span.AddEvent("certificate unchanged")
+		return
+	}
+
+	reloader.cert.Store(cert)
+
+	expiry := cert.Leaf.NotAfter.UTC().Format(time.RFC3339)
+	span.AddEvent("certificate rotated", trace.WithAttributes(
+		attribute.String("tls.server.certificate.serial", cert.Leaf.SerialNumber.Text(16)),
+		attribute.String("tls.server.not_after", expiry),
+	))
+	reloader.logger.Info("certificate rotated", "reason", reason, "serial", cert.Leaf.SerialNumber.Text(16), "not_after", expiry)
+}
@@ -0,0 +1,269 @@
+package main
+
+// This file contains tests of the hot reloading of the server certificate, covering reloads
+// triggered by changes to the certificate files, and by SIGHUP, the debouncing of file changes,
+// and the retention of the existing certificate when a reload fails.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/karlmutch/buf-ping/pkg/devcert"
+	"github.com/karlmutch/buf-ping/pkg/pingtest"
+)
+
+// rotateCert issues a new server certificate from the CA of the certificates, in place of the
+// existing certificate, the new certificate also covers the host rotated.example
+func rotateCert(t *testing.T, certs *pingtest.Certificates) {
+	t.Helper()
+
+	result, err := devcert.Ensure(devcert.Opts{
+		CertFn: certs.CertFn,
+		KeyFn:  certs.KeyFn,
+		CAFn:   certs.CAFn,
+		Hosts:  []string{pingtest.ServerName, "127.0.0.1", "::1", "rotated.example"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !result.IsIssued {
+		t.Fatal("expected a new certificate to be issued")
+	}
+}
+
+// isRotated is true when the certificate covers the host added by rotateCert
+func isRotated(cert *x509.Certificate) bool {
+	for _, name := range cert.DNSNames {
+		if name == "rotated.example" {
+			return true
+		}
+	}
+	return false
+}
+
+// servedLeaf returns the certificate the server presents to a new TLS connection
+func servedLeaf(t *testing.T, srv *pingtest.Server) (leaf *x509.Certificate) {
+	t.Helper()
+
+	pem, errGo := os.ReadFile(srv.Certs.CAFn)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	conn, errGo := tls.Dial("tcp", srv.Addr, &tls.Config{RootCAs: roots, ServerName: pingtest.ServerName, NextProtos: []string{"h2"}})
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+// waitFor polls the condition until it is true, failing the test once the timeout has passed
+func waitFor(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(timeout); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not happen within %s", what, timeout)
+		}
+	}
+}
+
+// TestCertReloadServed rewrites the certificate files of a running server and checks that new
+// connections are given the new certificate
+func TestCertReloadServed(t *testing.T) {
+	srv := pingtest.Start(t, startPingsrv)
+
+	if leaf := servedLeaf(t, srv); isRotated(leaf) {
+		t.Fatal("expected the original certificate to be served")
+	}
+	rotateCert(t, srv.Certs)
+	waitFor(t, 5*time.Second, "serving the rotated certificate", func() bool {
+		return isRotated(servedLeaf(t, srv))
+	})
+}
+
+// newTestReloader returns a reloader of the certificates watching the directory, along with the
+// channel used to deliver SIGHUP to it, and its log
+func newTestReloader(t *testing.T, certs *pingtest.Certificates, dir string) (reloader *certReloader, hupC chan os.Signal, log *syncBuffer) {
+	t.Helper()
+
+	log = &syncBuffer{}
+	reloader = &certReloader{
+		certPemFn: certs.CertFn,
+		certKeyFn: certs.KeyFn,
+		logger:    slog.New(slog.NewTextHandler(log, nil)),
+	}
+	cert, err := reloader.load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	reloader.cert.Store(cert)
+
+	watcher, errGo := fsnotify.NewWatcher()
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	if errGo = watcher.Add(dir); errGo != nil {
+		watcher.Close()
+		t.Fatal(errGo)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneC := make(chan struct{})
+	hupC = make(chan os.Signal, 1)
+	go func() {
+		defer close(doneC)
+		reloader.watch(ctx, watcher, hupC)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-doneC
+	})
+	return reloader, hupC, log
+}
+
+// newTestCertificates generates a CA, and server certificate, for the tests of the reloader
+func newTestCertificates(t *testing.T) (certs *pingtest.Certificates) {
+	t.Helper()
+
+	certs, err := pingtest.NewCertificates(t.TempDir(), []string{pingtest.ServerName, "127.0.0.1", "::1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return certs
+}
+
+// current returns the certificate the reloader is handing out
+func current(t *testing.T, reloader *certReloader) (leaf *x509.Certificate) {
+	t.Helper()
+
+	cert, errGo := reloader.GetCertificate(nil)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	return cert.Leaf
+}
+
+func TestCertReloadSIGHUP(t *testing.T) {
+	certs := newTestCertificates(t)
+	// The reloader watches an unrelated directory so that only SIGHUP reloads the certificate
+	reloader, hupC, log := newTestReloader(t, certs, t.TempDir())
+
+	rotateCert(t, certs)
+	time.Sleep(2 * reloadSettle)
+	if isRotated(current(t, reloader)) {
+		t.Fatal("expected the certificate to be reloaded only once SIGHUP was received")
+	}
+
+	hupC <- syscall.SIGHUP
+	waitFor(t, 5*time.Second, "reloading the certificate on SIGHUP", func() bool {
+		return isRotated(current(t, reloader))
+	})
+	if !strings.Contains(log.String(), `msg="certificate rotated" reason=SIGHUP`) {
+		t.Fatalf("expected the rotation to be logged, got\n%s", log.String())
+	}
+}
+
+func TestCertReloadDebounce(t *testing.T) {
+	certs := newTestCertificates(t)
+	reloader, _, log := newTestReloader(t, certs, filepath.Dir(certs.CertFn))
+
+	// The files keep changing for longer than the settle time, with gaps shorter than it, so a
+	// reload is only attempted once they stop
+	rotateCert(t, certs)
+	rotated, errGo := os.ReadFile(certs.CertFn)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	lastWrite := time.Now()
+	for i := 0; i != 5; i++ {
+		time.Sleep(reloadSettle / 2)
+		if isRotated(current(t, reloader)) {
+			t.Fatal("expected the certificate not to be reloaded while the files are changing")
+		}
+		if errGo = os.WriteFile(certs.CertFn, rotated, 0o600); errGo != nil {
+			t.Fatal(errGo)
+		}
+		lastWrite = time.Now()
+	}
+
+	waitFor(t, 5*time.Second, "reloading the changed certificate", func() bool {
+		return isRotated(current(t, reloader))
+	})
+	if elapsed := time.Since(lastWrite); elapsed < reloadSettle {
+		t.Fatalf("expected the reload to wait %s after the last change, it waited %s", reloadSettle, elapsed)
+	}
+	if rotations := strings.Count(log.String(), "certificate rotated"); rotations != 1 {
+		t.Fatalf("expected a single rotation, got\n%s", log.String())
+	}
+}
+
+func TestCertReloadFailure(t *testing.T) {
+	other := newTestCertificates(t)
+
+	testCases := []struct {
+		name    string
+		corrupt func(t *testing.T, certs *pingtest.Certificates)
+	}{
+		{
+			name: "missing certificate",
+			corrupt: func(t *testing.T, certs *pingtest.Certificates) {
+				if errGo := os.Remove(certs.CertFn); errGo != nil {
+					t.Fatal(errGo)
+				}
+			},
+		},
+		{
+			name: "invalid certificate",
+			corrupt: func(t *testing.T, certs *pingtest.Certificates) {
+				if errGo := os.WriteFile(certs.CertFn, []byte("not a certificate"), 0o600); errGo != nil {
+					t.Fatal(errGo)
+				}
+			},
+		},
+		{
+			name: "key of another certificate",
+			corrupt: func(t *testing.T, certs *pingtest.Certificates) {
+				key, errGo := os.ReadFile(other.KeyFn)
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				if errGo = os.WriteFile(certs.KeyFn, key, 0o600); errGo != nil {
+					t.Fatal(errGo)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			certs := newTestCertificates(t)
+			reloader, hupC, log := newTestReloader(t, certs, t.TempDir())
+			original := current(t, reloader)
+
+			tc.corrupt(t, certs)
+			hupC <- syscall.SIGHUP
+			waitFor(t, 5*time.Second, "logging the failed reload", func() bool {
+				return strings.Contains(log.String(), "certificate reload failed")
+			})
+			if !bytes.Equal(current(t, reloader).Raw, original.Raw) {
+				t.Fatal("expected the existing certificate to be kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+// This file contains the processing of the server configuration.  Every option
+// can be supplied as a command line flag, as a PINGSRV_ prefixed environment
+// variable, or as a key within a YAML or TOML configuration file.  Flags take
+// precedence over environment variables, which take precedence over the
+// configuration file, which in turn takes precedence over the defaults.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+const envPrefix = "PINGSRV_"
+
+// secretOptions are masked when the effective configuration is printed
+var secretOptions = map[string]struct{}{
+	"o11y-key": {},
+}
+
+// newFlagSet binds every configurable serverOpts field to a flag
+func newFlagSet(opts *serverOpts) (fs *flag.FlagSet) {
+	fs = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+
+	fs.StringVar(&opts.serviceID, "service-id", "ping-server", "the identifier of the service used for health checks, telemetry, and single instance locking")
+	fs.StringVar(&opts.cfgHost, "host", "", "the host name reported by telemetry")
+
+	fs.StringVar(&opts.ipPort, "ip-port", "0.0.0.0:8080", "the address the TLS listener binds to")
+	fs.BoolVar(&opts.noTLS, "no-tls", false, "disable the TLS listener, for servers only reached using h2c, or a Unix socket")
+	fs.StringVar(&opts.h2cAddr, "h2c-addr", "", "the address of an INSECURE cleartext HTTP/2 (h2c) listener for use behind a TLS terminating proxy, disabled when empty")
+	fs.StringVar(&opts.http3Addr, "http3-addr", "", "the UDP address of an HTTP/3 (QUIC) listener using the TLS configuration, advertised to TLS clients using Alt-Svc, disabled when empty")
+	fs.StringVar(&opts.unixSocket, "unix-socket", "", "the path of a Unix domain socket served using cleartext HTTP/2, disabled when empty")
+
+	fs.BoolVar(&opts.noREST, "no-rest", false, "disable the REST/JSON transcoding of the RPCs using their google.api.http annotations")
+	fs.StringVar(&opts.openapiPath, "openapi-path", "/explorer/", "the path serving the API explorer, and the OpenAPI document as openapi.json beneath it, disabled when empty")
+
+	fs.StringVar(&opts.environment, "environment", envProduction, "the environment the server runs in, one of development, or production, selecting defaults such as the CORS origins")
+
+	fs.StringVar(&opts.corsOrigins, "cors-origins", "", "comma separated origins allowed to make cross-origin requests, such as https://app.example.com, https://*.example.com, http://localhost:*, or *, defaults to localhost in development and none in production")
+	fs.StringVar(&opts.corsMethods, "cors-methods", defaultCORSMethods, "comma separated methods allowed in cross-origin requests")
+	fs.StringVar(&opts.corsHeaders, "cors-headers", defaultCORSHeaders, "comma separated request headers allowed in cross-origin requests")
+	fs.BoolVar(&opts.corsCredentials, "cors-credentials", false, "allow cross-origin requests to include credentials such as cookies, and client certificates, cannot be used with the * origin")
+
+	fs.StringVar(&opts.certPemFn, "cert", "testing.crt", "PEM file containing the server certificate")
+	fs.StringVar(&opts.certKeyFn, "key", "testing.key", "PEM file containing the server private key")
+	fs.BoolVar(&opts.devCerts, "dev-certs", false, "for development, generate the server certificate and key, issued by a generated CA, when they are missing and reuse them until they near expiry")
+	fs.StringVar(&opts.devCAFn, "dev-ca", "testing-ca.crt", "PEM file the generated development CA is written to for use by clients, its key is kept alongside it")
+	fs.StringVar(&opts.devCertHosts, "dev-cert-hosts", "", "comma separated host names, and IP addresses, added to the generated certificate along with localhost, the loopback addresses, and the host name")
+	fs.StringVar(&opts.clientCAFn, "client-ca", "", "PEM file containing the CAs used to verify client certificates, enables mutual TLS")
+
+	fs.StringVar(&opts.cfgNamespace, "k8s-namespace", "", "the Kubernetes namespace containing the configuration map")
+	fs.StringVar(&opts.cfgConfigMap, "k8s-configmap", "", "the name of the Kubernetes configuration map monitored by the server")
+
+	fs.StringVar(&opts.authKeysFn, "auth-keys", "", "file containing the JWKS, PEM public keys, or HMAC secret used to verify bearer tokens, enables authentication")
+	fs.StringVar(&opts.authIssuer, "auth-issuer", "", "the issuer bearer tokens must contain in their iss claim")
+	fs.StringVar(&opts.authAudience, "auth-audience", "", "the audience bearer tokens must contain in their aud claim")
+
+	fs.StringVar(&opts.stateDir, "state-dir", "", "directory used to persist the running total across restarts, the total is held in memory when empty")
+	fs.StringVar(&opts.stateFsync, "state-fsync", "interval", "when the state log is flushed to disk, one of always, interval, or never")
+	fs.DurationVar(&opts.stateFsyncInterval, "state-fsync-interval", time.Second, "the time between flushes of the state log when using the interval fsync policy")
+	fs.DurationVar(&opts.stateSnapshotInterval, "state-snapshot-interval", time.Minute, "the maximum time between snapshots of the running total")
+
+	fs.StringVar(&opts.counterScope, "counter-scope", "none", "how named counters are partitioned between callers, one of none, tenant, or baggage")
+	fs.StringVar(&opts.counterTenantClaim, "counter-tenant-claim", "tenant", "the bearer token claim identifying the tenant when the counter scope is tenant")
+	fs.StringVar(&opts.counterBaggageKey, "counter-baggage-key", "tenant", "the OTel baggage member identifying the tenant when the counter scope is baggage")
+	fs.IntVar(&opts.maxCounters, "max-counters", 10000, "the maximum number of named counters the server will hold")
+	fs.StringVar(&opts.counterOverflow, "counter-overflow", "reject", "the handling of changes that would overflow a counter, one of saturate, wrap, or reject")
+
+	fs.IntVar(&opts.watchBuffer, "watch-buffer", 64, "the number of counter changes buffered for each Watch RPC")
+	fs.StringVar(&opts.watchSlowConsumer, "watch-slow-consumer", "drop", "the handling of Watch RPCs whose buffer is full, drop sends a gap once the client catches up, disconnect ends the RPC")
+
+	fs.StringVar(&opts.faultRulesFn, "fault-rules", "", "JSON file containing the fault injection rules applied to PingService RPCs, enables fault injection")
+	fs.BoolVar(&opts.faultAdmin, "fault-admin", false, "serve the FaultService used to change the fault injection rules at runtime, enables fault injection and requires auth-keys")
+	fs.StringVar(&opts.faultAdminScope, "fault-admin-scope", "ping.fault.admin", "the bearer token scope callers of the FaultService must be granted")
+
+	fs.StringVar(&opts.rateLimits, "rate-limits", "", "comma separated procedure=rate[:burst] token bucket limits applied to each caller, rates are per second and procedures may be globs")
+	fs.StringVar(&opts.rateLimitKey, "rate-limit-key", "identity", "how callers are told apart when rate limiting, one of identity, ip, or header")
+	fs.StringVar(&opts.rateLimitHeader, "rate-limit-header", "", "the request header identifying callers when the rate limit key is header")
+
+	fs.IntVar(&opts.admissionMaxInflight, "admission-max-inflight", 0, "the maximum number of PingService RPCs running at once, zero is unlimited")
+	fs.StringVar(&opts.admissionLimits, "admission-limits", "", "comma separated procedure=max concurrency limits, procedures may be globs, for example /ping.v1.PingService/Generate=16")
+	fs.BoolVar(&opts.admissionAdaptive, "admission-adaptive", false, "adapt the concurrency limits of unary RPCs to their latency")
+	fs.DurationVar(&opts.admissionRetryAfter, "admission-retry-after", time.Second, "the delay clients are advised to wait before retrying RPCs shed by admission control")
+
+	fs.StringVar(&opts.prometheusAddr, "prometheus-addr", "", "the address of the Prometheus metrics exporter")
+	fs.DurationVar(&opts.prometheusRefresh, "prometheus-refresh", 15*time.Second, "the refresh interval of the Prometheus metrics")
+
+	fs.StringVar(&opts.o11yKey, "o11y-key", "", "the Honeycomb API key, defaults to the HONEYCOMB_API_KEY environment variable")
+
+	fs.StringVar(&opts.otelExporter, "otel-exporter", "", "the exporter of traces, metrics, and logs, one of otlp-grpc, otlp-http, stdout, file, or none, defaults to the OTEL_<SIGNAL>_EXPORTER, and OTEL_EXPORTER_OTLP_PROTOCOL, environment variables, or otlp-grpc")
+	fs.StringVar(&opts.otelFile, "otel-file", "telemetry.jsonl", "the JSON lines file written by the file exporter")
+	fs.IntVar(&opts.otelFileMaxSize, "otel-file-max-size", 100, "the size in megabytes at which the file written by the file exporter is rotated")
+	fs.IntVar(&opts.otelFileMaxBackups, "otel-file-max-backups", 5, "the number of rotated files retained by the file exporter, zero retains every file")
+	fs.DurationVar(&opts.otelMetricInterval, "otel-metric-interval", 0, "the interval between metric exports, defaults to the OTEL_METRIC_EXPORT_INTERVAL environment variable, or 1m")
+	fs.StringVar(&opts.otelSampler, "otel-sampler", "", "the trace sampler, one of always_on, always_off, traceidratio, parentbased_always_on, parentbased_always_off, or parentbased_traceidratio, defaults to the OTEL_TRACES_SAMPLER environment variable, or parentbased_always_on")
+	fs.StringVar(&opts.otelSamplerArg, "otel-sampler-arg", "", "the ratio of traces sampled by the traceidratio samplers, defaults to the OTEL_TRACES_SAMPLER_ARG environment variable, or 1")
+
+	fs.DurationVar(&opts.drainTimeout, "drain-timeout", 20*time.Second, "the time RPCs in flight are given to finish during shutdown, streams still running are then ended with an unavailable error")
+	fs.DurationVar(&opts.cooldown, "cooldown", 2*time.Second, "the time allowed for background processing to stop during shutdown")
+
+	return fs
+}
+
+// envName returns the environment variable used to set an option
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// parseConfig populates the options from the command line arguments, the environment,
+// and an optional configuration file.  When printOnly is returned as true the
+// caller should output the effective configuration using printConfig and then exit.
+func parseConfig(args []string, opts *serverOpts) (fs *flag.FlagSet, printOnly bool, err kv.Error) {
+	fs = newFlagSet(opts)
+
+	configFn := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML, or TOML, configuration file, selected using the file extension")
+	fs.BoolVar(&printOnly, "print-config", false, "print the effective configuration and exit")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags]\n\nevery flag can also be set using its %s prefixed environment variable, for example %s\n\nflags:\n",
+			fs.Name(), envPrefix, envName("ip-port"))
+		fs.PrintDefaults()
+	}
+
+	if errGo := fs.Parse(args); errGo != nil {
+		if errors.Is(errGo, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		return nil, false, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+
+	explicit := map[string]struct{}{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = struct{}{}
+	})
+
+	if len(*configFn) != 0 {
+		values, err := readConfigFile(*configFn)
+		if err != nil {
+			return nil, false, err
+		}
+		for name, value := range values {
+			if fs.Lookup(name) == nil || name == "config" || name == "print-config" {
+				return nil, false, kv.NewError("unknown configuration option").With("option", name, "file", *configFn, "stack", stack.Trace().TrimRuntime())
+			}
+			if _, isPresent := explicit[name]; isPresent {
+				continue
+			}
+			if errGo := fs.Set(name, value); errGo != nil {
+				return nil, false, kv.Wrap(errGo).With("option", name, "file", *configFn, "stack", stack.Trace().TrimRuntime())
+			}
+		}
+	}
+
+	// Environment variables are applied after the file so that they override it
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		if _, isPresent := explicit[f.Name]; isPresent {
+			return
+		}
+		value, isPresent := os.LookupEnv(envName(f.Name))
+		if !isPresent {
+			return
+		}
+		if errGo := fs.Set(f.Name, value); errGo != nil {
+			err = kv.Wrap(errGo).With("env", envName(f.Name), "stack", stack.Trace().TrimRuntime())
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return fs, printOnly, nil
+}
+
+// readConfigFile loads a flat YAML, or TOML, document containing option names and values
+func readConfigFile(fn string) (values map[string]string, err kv.Error) {
+	data, errGo := os.ReadFile(fn)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		errGo = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		errGo = toml.Unmarshal(data, &doc)
+	default:
+		return nil, kv.NewError("unsupported configuration file type, expected .yaml, .yml, or .toml").With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	values = make(map[string]string, len(doc))
+	for key, value := range doc {
+		// Option names are accepted in either kebab, or snake case
+		name := strings.ReplaceAll(key, "_", "-")
+		switch value.(type) {
+		case map[string]any, []any:
+			return nil, kv.NewError("configuration options must be scalar values").With("option", key, "file", fn, "stack", stack.Trace().TrimRuntime())
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// printConfig outputs the effective configuration as a YAML document that can
+// be used as a configuration file
+func printConfig(fs *flag.FlagSet, w io.Writer) (err kv.Error) {
+	names := []string{}
+	effective := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		value := f.Value.String()
+		if _, isSecret := secretOptions[f.Name]; isSecret && len(value) != 0 {
+			value = "********"
+		}
+		names = append(names, f.Name)
+		effective[f.Name] = value
+	})
+	sort.Strings(names)
+
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range names {
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: effective[name], Style: yaml.DoubleQuotedStyle},
+		)
+	}
+	output, errGo := yaml.Marshal(doc)
+	if errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	if _, errGo = w.Write(output); errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return nil
+}
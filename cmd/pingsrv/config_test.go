@@ -0,0 +1,184 @@
+package main
+
+// This file contains tests of the processing of the server configuration, covering the
+// precedence of flags, environment variables, and configuration files over each other and
+// the defaults, along with the selection of the configuration file format.
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		contents string
+		env      map[string]string
+		args     []string
+		ipPort   string
+		cooldown time.Duration
+		isError  bool
+	}{
+		{
+			name:     "defaults",
+			ipPort:   "0.0.0.0:8080",
+			cooldown: 2 * time.Second,
+		},
+		{
+			name:     "file over defaults",
+			file:     "pingsrv.yaml",
+			contents: "ip-port: 127.0.0.1:1000\ncooldown: 5s\n",
+			ipPort:   "127.0.0.1:1000",
+			cooldown: 5 * time.Second,
+		},
+		{
+			name:     "env over file",
+			file:     "pingsrv.yaml",
+			contents: "ip-port: 127.0.0.1:1000\ncooldown: 5s\n",
+			env:      map[string]string{"PINGSRV_IP_PORT": "127.0.0.1:2000"},
+			ipPort:   "127.0.0.1:2000",
+			cooldown: 5 * time.Second,
+		},
+		{
+			name:     "flag over env, and file",
+			file:     "pingsrv.yaml",
+			contents: "ip-port: 127.0.0.1:1000\ncooldown: 5s\n",
+			env:      map[string]string{"PINGSRV_IP_PORT": "127.0.0.1:2000", "PINGSRV_COOLDOWN": "6s"},
+			args:     []string{"--ip-port", "127.0.0.1:3000"},
+			ipPort:   "127.0.0.1:3000",
+			cooldown: 6 * time.Second,
+		},
+		{
+			name:     "flag over env",
+			env:      map[string]string{"PINGSRV_IP_PORT": "127.0.0.1:2000"},
+			args:     []string{"--ip-port=127.0.0.1:3000"},
+			ipPort:   "127.0.0.1:3000",
+			cooldown: 2 * time.Second,
+		},
+		{
+			name:     "flag set to the default over env",
+			env:      map[string]string{"PINGSRV_COOLDOWN": "6s"},
+			args:     []string{"--cooldown=2s"},
+			ipPort:   "0.0.0.0:8080",
+			cooldown: 2 * time.Second,
+		},
+		{
+			name:     "toml",
+			file:     "pingsrv.toml",
+			contents: "ip-port = \"127.0.0.1:1000\"\ncooldown = \"5s\"\n",
+			ipPort:   "127.0.0.1:1000",
+			cooldown: 5 * time.Second,
+		},
+		{
+			name:     "yml",
+			file:     "pingsrv.YML",
+			contents: "ip-port: 127.0.0.1:1000\n",
+			ipPort:   "127.0.0.1:1000",
+			cooldown: 2 * time.Second,
+		},
+		{
+			name:     "snake case keys",
+			file:     "pingsrv.toml",
+			contents: "ip_port = \"127.0.0.1:1000\"\n",
+			ipPort:   "127.0.0.1:1000",
+			cooldown: 2 * time.Second,
+		},
+		{
+			name:     "file named by env",
+			file:     "pingsrv.yaml",
+			contents: "ip-port: 127.0.0.1:1000\n",
+			env:      map[string]string{"PINGSRV_CONFIG": "pingsrv.yaml"},
+			ipPort:   "127.0.0.1:1000",
+			cooldown: 2 * time.Second,
+		},
+		{name: "unknown key", file: "pingsrv.yaml", contents: "ip-port: 127.0.0.1:1000\nunknown: 1\n", isError: true},
+		{name: "config key", file: "pingsrv.yaml", contents: "config: other.yaml\n", isError: true},
+		{name: "print-config key", file: "pingsrv.toml", contents: "print-config = true\n", isError: true},
+		{name: "nested value", file: "pingsrv.yaml", contents: "ip-port:\n  host: 127.0.0.1\n", isError: true},
+		{name: "yaml in a toml file", file: "pingsrv.toml", contents: "ip-port: 127.0.0.1:1000\n", isError: true},
+		{name: "toml in a yaml file", file: "pingsrv.yaml", contents: "[server]\nip-port = \"127.0.0.1:1000\"\n", isError: true},
+		{name: "unsupported extension", file: "pingsrv.json", contents: "{\"ip-port\": \"127.0.0.1:1000\"}", isError: true},
+		{name: "invalid file value", file: "pingsrv.yaml", contents: "cooldown: soon\n", isError: true},
+		{name: "invalid env value", env: map[string]string{"PINGSRV_COOLDOWN": "soon"}, isError: true},
+		{name: "missing file", args: []string{"--config", filepath.Join(os.TempDir(), "pingsrv-missing", "pingsrv.yaml")}, isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args := tc.args
+			if len(tc.file) != 0 {
+				if errGo := os.WriteFile(filepath.Join(dir, tc.file), []byte(tc.contents), 0o600); errGo != nil {
+					t.Fatal(errGo)
+				}
+				if _, isPresent := tc.env["PINGSRV_CONFIG"]; !isPresent {
+					args = append([]string{"--config", filepath.Join(dir, tc.file)}, args...)
+				}
+			}
+			for name, value := range tc.env {
+				if name == "PINGSRV_CONFIG" {
+					value = filepath.Join(dir, value)
+				}
+				t.Setenv(name, value)
+			}
+
+			opts := &serverOpts{}
+			_, _, err := parseConfig(args, opts)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatal("expected the configuration to be refused")
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if opts.ipPort != tc.ipPort || opts.cooldown != tc.cooldown {
+				t.Fatalf("expected ip-port %s, cooldown %s, got %s, %s", tc.ipPort, tc.cooldown, opts.ipPort, opts.cooldown)
+			}
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Setenv("PINGSRV_O11Y_KEY", "secret")
+
+	fs, printOnly, err := parseConfig([]string{"--print-config", "--ip-port", "127.0.0.1:1000"}, &serverOpts{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !printOnly {
+		t.Fatal("expected only the configuration to be printed")
+	}
+
+	output := &bytes.Buffer{}
+	if err = printConfig(fs, output); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, line := range []string{`ip-port: "127.0.0.1:1000"`, `o11y-key: "********"`, `cooldown: "2s"`} {
+		if !strings.Contains(output.String(), line+"\n") {
+			t.Errorf("expected the configuration to contain %s, got\n%s", line, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "secret") || strings.Contains(output.String(), "print-config") {
+		t.Errorf("expected secrets, and the print-config flag, to be left out, got\n%s", output.String())
+	}
+
+	// The printed configuration can be used as a configuration file
+	fn := filepath.Join(t.TempDir(), "pingsrv.yaml")
+	if errGo := os.WriteFile(fn, output.Bytes(), 0o600); errGo != nil {
+		t.Fatal(errGo)
+	}
+	opts := &serverOpts{}
+	if _, _, err = parseConfig([]string{"--config", fn}, opts); err != nil {
+		t.Fatal(err.Error())
+	}
+	if opts.ipPort != "127.0.0.1:1000" {
+		t.Fatalf("expected the printed configuration to set ip-port, got %s", opts.ipPort)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+// This file contains the CORS policy applied to browser requests.  The origins allowed
+// to make cross-origin requests are configured as a list of patterns, defaulting by
+// environment to local development origins in development and to none in production.
+// Preflight requests that are refused are logged along with their origin so that
+// misconfigured front ends can be diagnosed from the server.
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-stack/stack"
+	"github.com/rs/cors"
+
+	"github.com/karlmutch/kv"
+)
+
+const (
+	envDevelopment = "development"
+	envProduction  = "production"
+)
+
+var (
+	// defaultCORSMethods are the methods used by the Connect, gRPC-Web, and REST requests of browsers
+	defaultCORSMethods = "GET,POST,PUT"
+	// defaultCORSHeaders are the request headers used by the Connect, and gRPC-Web, protocols, bearer
+	// tokens, and OTel context propagation
+	defaultCORSHeaders = "Authorization,Content-Type,Connect-Protocol-Version,Connect-Timeout-Ms,Connect-Accept-Encoding," +
+		"Connect-Content-Encoding,Grpc-Timeout,X-Grpc-Web,X-User-Agent,Traceparent,Tracestate,Baggage"
+
+	// corsOriginsByEnv are the origins allowed when none are configured
+	corsOriginsByEnv = map[string]string{
+		envDevelopment: "http://localhost:*,https://localhost:*,http://127.0.0.1:*,https://127.0.0.1:*",
+		envProduction:  "",
+	}
+)
+
+// originPattern matches the origins of cross-origin requests.  Patterns are either *, an
+// origin such as https://app.example.com, or an origin with a wildcard subdomain such as
+// https://*.example.com, or a wildcard port such as http://localhost:*.
+type originPattern struct {
+	isAny       bool
+	scheme      string
+	host        string
+	isSubdomain bool
+	port        string
+}
+
+func parseOriginPattern(text string) (p *originPattern, err kv.Error) {
+	if text == "*" {
+		return &originPattern{isAny: true}, nil
+	}
+	scheme, rest, isPresent := strings.Cut(strings.ToLower(text), "://")
+	if !isPresent || (scheme != "http" && scheme != "https") || len(rest) == 0 || strings.ContainsAny(rest, "/?#@") {
+		return nil, kv.NewError("CORS origins must be of the form scheme://host[:port], the host may start with *. and the port may be *").With("origin", text, "stack", stack.Trace().TrimRuntime())
+	}
+	p = &originPattern{scheme: scheme, host: rest}
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.HasSuffix(rest, "]") {
+		p.host, p.port = rest[:i], rest[i+1:]
+	}
+	if strings.HasPrefix(p.host, "*.") {
+		p.host, p.isSubdomain = p.host[2:], true
+	}
+	if len(p.host) == 0 || strings.Contains(p.host, "*") || (len(p.port) == 0 && strings.HasSuffix(rest, ":")) {
+		return nil, kv.NewError("CORS origins may only use a wildcard for the subdomain, or the port").With("origin", text, "stack", stack.Trace().TrimRuntime())
+	}
+	return p, nil
+}
+
+// match returns true when the origin is matched by the pattern, subdomain patterns match
+// subdomains at any depth but not the domain itself
+func (p *originPattern) match(origin *url.URL) bool {
+	if p.isAny {
+		return true
+	}
+	if origin.Scheme != p.scheme {
+		return false
+	}
+	if p.port != "*" && origin.Port() != p.port {
+		return false
+	}
+	host := strings.ToLower(origin.Hostname())
+	if strings.HasPrefix(origin.Host, "[") {
+		host = "[" + host + "]"
+	}
+	if p.isSubdomain {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// corsPolicy decides which origins may make cross-origin requests
+type corsPolicy struct {
+	patterns []*originPattern
+}
+
+func newCORSPolicy(origins string) (policy *corsPolicy, err kv.Error) {
+	policy = &corsPolicy{}
+	for _, text := range strings.Split(origins, ",") {
+		if text = strings.TrimSpace(text); len(text) == 0 {
+			continue
+		}
+		p, err := parseOriginPattern(text)
+		if err != nil {
+			return nil, err
+		}
+		policy.patterns = append(policy.patterns, p)
+	}
+	return policy, nil
+}
+
+// isAllowed returns true when the origin of a request may make cross-origin requests
+func (policy *corsPolicy) isAllowed(origin string) bool {
+	u, errGo := url.Parse(origin)
+	if errGo != nil || len(u.Host) == 0 {
+		return false
+	}
+	for _, p := range policy.patterns {
+		if p.match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList returns the non empty items of a comma separated list
+func splitList(list string) (items []string) {
+	items = []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newCORS returns a handler applying the CORS policy of the server to requests before they are
+// passed to the handler
+func newCORS(opts *serverOpts, handler http.Handler) (corsHandler http.Handler, err kv.Error) {
+	env := opts.environment
+	if len(env) == 0 {
+		env = envProduction
+	}
+	defaultOrigins, isPresent := corsOriginsByEnv[env]
+	if !isPresent {
+		return nil, kv.NewError("unknown environment, expected development or production").With("environment", env, "stack", stack.Trace().TrimRuntime())
+	}
+	origins := opts.corsOrigins
+	if len(origins) == 0 {
+		origins = defaultOrigins
+	}
+	policy, err := newCORSPolicy(origins)
+	if err != nil {
+		return nil, err
+	}
+	if opts.corsCredentials {
+		for _, p := range policy.patterns {
+			if p.isAny {
+				return nil, kv.NewError("CORS credentials cannot be allowed for every origin").With("stack", stack.Trace().TrimRuntime())
+			}
+		}
+	}
+
+	methods, headers := opts.corsMethods, opts.corsHeaders
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	coresProfile := cors.New(cors.Options{
+		AllowOriginFunc:  policy.isAllowed,
+		AllowedMethods:   splitList(strings.ToUpper(methods)),
+		AllowedHeaders:   splitList(headers),
+		AllowCredentials: opts.corsCredentials,
+		ExposedHeaders: []string{
+			"Accept",
+			"Accept-Encoding",
+			"Accept-Post",
+			"Connect-Accept-Encoding",
+			"Connect-Content-Encoding",
+			"Content-Encoding",
+			"Grpc-Accept-Encoding",
+			"Grpc-Encoding",
+			"Grpc-Message",
+			"Grpc-Status",
+			"Grpc-Status-Details-Bin",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"Retry-After",
+			"X-Grpc-Test-Echo-Initial",
+			"X-Grpc-Test-Echo-Trailing-Bin",
+		},
+	})
+	opts.logger.Info("CORS policy", "environment", env, "origins", origins, "methods", methods, "credentials", opts.corsCredentials)
+
+	return logRejectedPreflights(opts.logger, policy, coresProfile.Handler(handler)), nil
+}
+
+// logRejectedPreflights logs the preflight requests the CORS handler refused, which it
+// signals by leaving out the Access-Control-Allow-Origin header
+func logRejectedPreflights(logger *slog.Logger, policy *corsPolicy, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+
+		origin := r.Header.Get("Origin")
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || len(origin) == 0 || len(method) == 0 || len(w.Header().Get("Access-Control-Allow-Origin")) != 0 {
+			return
+		}
+		reason := "method or headers not allowed"
+		if !policy.isAllowed(origin) {
+			reason = "origin not allowed"
+		}
+		logger.Warn("CORS preflight rejected", "origin", origin, "method", method,
+			"headers", r.Header.Get("Access-Control-Request-Headers"), "reason", reason)
+	})
+}
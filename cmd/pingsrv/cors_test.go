@@ -0,0 +1,279 @@
+package main
+
+// This file contains tests of the CORS policy, covering the matching of origin patterns and the
+// headers returned to allowed, and refused, cross-origin requests and their preflights.
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginPatterns(t *testing.T) {
+	testCases := []struct {
+		origins string
+		origin  string
+		allowed bool
+	}{
+		{origins: "https://app.example.com", origin: "https://app.example.com", allowed: true},
+		{origins: "https://app.example.com", origin: "https://APP.example.com", allowed: true},
+		{origins: "https://app.example.com", origin: "http://app.example.com"},
+		{origins: "https://app.example.com", origin: "https://app.example.com:8443"},
+		{origins: "https://app.example.com", origin: "https://evil.app.example.com"},
+		{origins: "https://app.example.com:8443", origin: "https://app.example.com:8443", allowed: true},
+		{origins: "https://*.example.com", origin: "https://app.example.com", allowed: true},
+		{origins: "https://*.example.com", origin: "https://a.b.example.com", allowed: true},
+		{origins: "https://*.example.com", origin: "https://example.com"},
+		{origins: "https://*.example.com", origin: "https://app.example.com.evil.com"},
+		{origins: "https://*.example.com", origin: "https://evilexample.com"},
+		{origins: "http://localhost:*", origin: "http://localhost:3000", allowed: true},
+		{origins: "http://localhost:*", origin: "http://localhost", allowed: true},
+		{origins: "http://[::1]:*", origin: "http://[::1]:3000", allowed: true},
+		{origins: "*", origin: "https://anything.example.org", allowed: true},
+		{origins: "*", origin: "null"},
+		{origins: "", origin: "https://app.example.com"},
+		{origins: "https://a.example.com, https://b.example.com", origin: "https://b.example.com", allowed: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.origins+" "+tc.origin, func(t *testing.T) {
+			policy, err := newCORSPolicy(tc.origins)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if allowed := policy.isAllowed(tc.origin); allowed != tc.allowed {
+				t.Fatalf("expected %q allowed to be %t", tc.origin, tc.allowed)
+			}
+		})
+	}
+
+	for _, origins := range []string{"app.example.com", "ftp://app.example.com", "https://app.example.com/path", "https://app.*.com", "https://*", "https://app.example.com:"} {
+		if _, err := newCORSPolicy(origins); err == nil {
+			t.Errorf("expected %q to be refused", origins)
+		}
+	}
+}
+
+// newTestCORS returns the CORS handler for the options in front of a handler that answers every
+// request with a 200, along with the log of the handler and a flag set once a request reaches
+// the handler
+func newTestCORS(t *testing.T, opts *serverOpts) (handler http.Handler, log *bytes.Buffer, isForwarded *bool) {
+	t.Helper()
+
+	log = &bytes.Buffer{}
+	isForwarded = new(bool)
+	opts.logger = slog.New(slog.NewTextHandler(log, nil))
+	handler, err := newCORS(opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*isForwarded = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return handler, log, isForwarded
+}
+
+func TestCORS(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        serverOpts
+		method      string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		status      int
+		headers     map[string]string
+		rejected    string
+		isForwarded bool
+	}{
+		{
+			name:   "allowed origin",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodPost, origin: "https://app.example.com",
+			status: http.StatusOK,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "Origin",
+			},
+			isForwarded: true,
+		},
+		{
+			name:   "disallowed origin",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodPost, origin: "https://evil.example.com",
+			status:      http.StatusOK,
+			headers:     map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Expose-Headers": ""},
+			isForwarded: true,
+		},
+		{
+			name:   "wildcard origin",
+			opts:   serverOpts{corsOrigins: "*"},
+			method: http.MethodGet, origin: "https://anything.example.org",
+			status:      http.StatusOK,
+			headers:     map[string]string{"Access-Control-Allow-Origin": "https://anything.example.org"},
+			isForwarded: true,
+		},
+		{
+			name:   "credentials",
+			opts:   serverOpts{corsOrigins: "https://*.example.com", corsCredentials: true},
+			method: http.MethodPost, origin: "https://app.example.com",
+			status: http.StatusOK,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			isForwarded: true,
+		},
+		{
+			name:   "preflight",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: http.MethodPost, reqHeaders: "Content-Type, Connect-Protocol-Version",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     http.MethodPost,
+				"Access-Control-Allow-Headers":     "Content-Type, Connect-Protocol-Version",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "preflight with credentials",
+			opts:   serverOpts{corsOrigins: "https://app.example.com", corsCredentials: true},
+			method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: http.MethodPut, reqHeaders: "Authorization",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     http.MethodPut,
+				"Access-Control-Allow-Headers":     "Authorization",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:   "preflight from a disallowed origin",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodOptions, origin: "https://evil.example.com",
+			reqMethod: http.MethodPost,
+			status:    http.StatusNoContent,
+			headers:   map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+			rejected:  "origin not allowed",
+		},
+		{
+			name:   "preflight of a disallowed method",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: http.MethodDelete,
+			status:    http.StatusNoContent,
+			headers:   map[string]string{"Access-Control-Allow-Origin": ""},
+			rejected:  "method or headers not allowed",
+		},
+		{
+			name:   "preflight of a disallowed header",
+			opts:   serverOpts{corsOrigins: "https://app.example.com"},
+			method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: http.MethodPost, reqHeaders: "X-Unknown",
+			status:   http.StatusNoContent,
+			headers:  map[string]string{"Access-Control-Allow-Origin": ""},
+			rejected: "method or headers not allowed",
+		},
+		{
+			name:   "development defaults",
+			opts:   serverOpts{environment: envDevelopment},
+			method: http.MethodPost, origin: "http://localhost:5173",
+			status:      http.StatusOK,
+			headers:     map[string]string{"Access-Control-Allow-Origin": "http://localhost:5173"},
+			isForwarded: true,
+		},
+		{
+			name:   "production defaults",
+			opts:   serverOpts{environment: envProduction},
+			method: http.MethodPost, origin: "http://localhost:5173",
+			status:      http.StatusOK,
+			headers:     map[string]string{"Access-Control-Allow-Origin": ""},
+			isForwarded: true,
+		},
+		{
+			name:        "same origin",
+			opts:        serverOpts{corsOrigins: "https://app.example.com"},
+			method:      http.MethodPost,
+			status:      http.StatusOK,
+			headers:     map[string]string{"Access-Control-Allow-Origin": ""},
+			isForwarded: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler, log, isForwarded := newTestCORS(t, &tc.opts)
+
+			req := httptest.NewRequest(tc.method, "/ping.v1.PingService/Ping", nil)
+			if len(tc.origin) != 0 {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if len(tc.reqMethod) != 0 {
+				req.Header.Set("Access-Control-Request-Method", tc.reqMethod)
+			}
+			if len(tc.reqHeaders) != 0 {
+				req.Header.Set("Access-Control-Request-Headers", tc.reqHeaders)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if *isForwarded != tc.isForwarded {
+				t.Fatalf("expected the request to reach the server to be %t", tc.isForwarded)
+			}
+			for name, value := range tc.headers {
+				if got := strings.Join(w.Header().Values(name), ", "); got != value {
+					t.Errorf("expected %s to be %q, got %q", name, value, got)
+				}
+			}
+
+			// Responses to allowed origins expose the headers describing rate limits
+			if exposed := w.Header().Get("Access-Control-Expose-Headers"); len(w.Header().Get("Access-Control-Allow-Origin")) != 0 &&
+				tc.method != http.MethodOptions && !strings.Contains(exposed, "Ratelimit-Remaining") {
+				t.Errorf("expected the rate limit headers to be exposed, got %q", exposed)
+			}
+
+			isRejected := strings.Contains(log.String(), "CORS preflight rejected")
+			switch {
+			case len(tc.rejected) == 0 && isRejected:
+				t.Errorf("unexpected rejection %s", log.String())
+			case len(tc.rejected) != 0 && !strings.Contains(log.String(), "reason=\""+tc.rejected+"\""):
+				t.Errorf("expected the preflight to be logged as rejected with %q, got %s", tc.rejected, log.String())
+			}
+		})
+	}
+}
+
+func TestCORSOpts(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	testCases := []struct {
+		name string
+		opts serverOpts
+	}{
+		{name: "credentials for every origin", opts: serverOpts{corsOrigins: "https://app.example.com,*", corsCredentials: true}},
+		{name: "unknown environment", opts: serverOpts{environment: "staging"}},
+		{name: "invalid origin", opts: serverOpts{corsOrigins: "app.example.com"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.logger = discard
+			if _, err := newCORS(&tc.opts, http.NotFoundHandler()); err == nil {
+				t.Fatal("expected the options to be refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+// This file contains the draining of the server during shutdown.  Once draining
+// starts the health of the services is reported as NOT_SERVING, new RPCs are
+// refused, and the streams already running are given until the drain deadline to
+// finish.  Streams still running at the deadline are ended with an unavailable
+// error so that clients see a clean failure they can retry against another
+// server rather than a broken connection.
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// drainGrace is the time streams are given to return the error sent to them at the drain deadline
+const drainGrace = time.Second
+
+// drainStream is a streaming RPC that was running when draining started, or started before
+type drainStream struct {
+	procedure string
+	started   time.Time
+	cancel    context.CancelFunc
+
+	// isExpired is set once the drain deadline has passed and the stream is being ended
+	isExpired atomic.Bool
+}
+
+// drainer is a connectrpc interceptor tracking the streaming RPCs of the server so
+// that they can be drained during shutdown
+type drainer struct {
+	logger *slog.Logger
+
+	isDraining bool
+	streams    map[*drainStream]struct{}
+	idleC      chan struct{}
+	sync.Mutex
+}
+
+func newDrainer(logger *slog.Logger) (d *drainer) {
+	return &drainer{
+		logger:  logger,
+		streams: map[*drainStream]struct{}{},
+	}
+}
+
+// errShuttingDown is returned for RPCs refused, or ended, because the server is shutting down
+func errShuttingDown(procedure string) (err error) {
+	return rpcerr.AddRetryInfo(rpcerr.New(connect.CodeUnavailable, "SERVER_SHUTTING_DOWN",
+		kv.NewError("server shutting down").With("procedure", procedure, "stack", stack.Trace().TrimRuntime())),
+		time.Second)
+}
+
+// add tracks a new stream, false is returned when the server is draining and the stream is refused
+func (d *drainer) add(ctx context.Context, procedure string) (s *drainStream, streamCtx context.Context, isAdmitted bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.isDraining {
+		return nil, ctx, false
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	s = &drainStream{
+		procedure: procedure,
+		started:   time.Now(),
+		cancel:    cancel,
+	}
+	d.streams[s] = struct{}{}
+	return s, streamCtx, true
+}
+
+// remove stops tracking a stream that has ended, when draining the outcome of the stream is logged
+func (d *drainer) remove(s *drainStream, err error) {
+	s.cancel()
+
+	d.Lock()
+	defer d.Unlock()
+
+	// Abandoned streams have already had their outcome logged
+	if _, isPresent := d.streams[s]; !isPresent {
+		return
+	}
+	delete(d.streams, s)
+	if !d.isDraining {
+		return
+	}
+
+	outcome := "completed"
+	switch {
+	case s.isExpired.Load():
+		outcome = "ended at deadline"
+	case err != nil:
+		outcome = "failed"
+	}
+	args := []any{"procedure", s.procedure, "outcome", outcome, "duration", time.Since(s.started).String()}
+	if err != nil && !s.isExpired.Load() {
+		args = append(args, "code", connect.CodeOf(err).String())
+	}
+	d.logger.Info("stream drained", args...)
+
+	if d.idleC != nil && len(d.streams) == 0 {
+		close(d.idleC)
+		d.idleC = nil
+	}
+}
+
+// drain stops new RPCs from being accepted, the returned channel is closed once every
+// stream has ended
+func (d *drainer) drain() (idleC <-chan struct{}, streams int) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.isDraining = true
+	c := make(chan struct{})
+	if len(d.streams) == 0 {
+		close(c)
+	} else {
+		d.idleC = c
+	}
+	return c, len(d.streams)
+}
+
+// expire ends the streams still running once the drain deadline has passed
+func (d *drainer) expire() {
+	d.Lock()
+	defer d.Unlock()
+
+	for s := range d.streams {
+		s.isExpired.Store(true)
+		s.cancel()
+	}
+}
+
+// abandon logs the streams that did not end, even after being sent an error, these
+// are cut off when the server closes its connections
+func (d *drainer) abandon() {
+	d.Lock()
+	defer d.Unlock()
+
+	for s := range d.streams {
+		d.logger.Warn("stream drained", "procedure", s.procedure, "outcome", "abandoned", "duration", time.Since(s.started).String())
+		delete(d.streams, s)
+	}
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs, unary RPCs are not
+// tracked as http.Server.Shutdown waits for them to complete
+func (d *drainer) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		d.Lock()
+		isDraining := d.isDraining
+		d.Unlock()
+		if isDraining {
+			return nil, errShuttingDown(req.Spec().Procedure)
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (d *drainer) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (d *drainer) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) (err error) {
+		procedure := conn.Spec().Procedure
+		s, ctx, isAdmitted := d.add(ctx, procedure)
+		if !isAdmitted {
+			return errShuttingDown(procedure)
+		}
+		// Handlers that panic, such as those having their connection reset by fault injection,
+		// must still stop being tracked or draining would wait upon them until the deadline
+		defer func() { d.remove(s, err) }()
+
+		err = next(ctx, &drainConn{StreamingHandlerConn: conn, stream: s})
+
+		// Handlers see their context cancelled, or their messages fail, once the deadline passes
+		// and the error they return is replaced with one telling the client why
+		if s.isExpired.Load() {
+			return errShuttingDown(procedure)
+		}
+		return err
+	}
+}
+
+// drainConn fails the sending, and receiving, of messages once the drain deadline has passed
+type drainConn struct {
+	connect.StreamingHandlerConn
+	stream *drainStream
+}
+
+// Send implements the connect.StreamingHandlerConn interface
+func (conn *drainConn) Send(msg any) error {
+	if conn.stream.isExpired.Load() {
+		return errShuttingDown(conn.stream.procedure)
+	}
+	return conn.StreamingHandlerConn.Send(msg)
+}
+
+// Receive implements the connect.StreamingHandlerConn interface
+func (conn *drainConn) Receive(msg any) error {
+	if conn.stream.isExpired.Load() {
+		return errShuttingDown(conn.stream.procedure)
+	}
+	return conn.StreamingHandlerConn.Receive(msg)
+}
+
+// drainServer gracefully shuts the servers of the listeners down, it returns once they have stopped
+func drainServer(opts *serverOpts, listeners []*listener, d *drainer, services []string) {
+	for _, service := range services {
+		serverHealth.SetStatus(service, grpchealth.StatusNotServing)
+	}
+
+	idleC, streams := d.drain()
+	opts.logger.Info("draining", "streams", streams, "timeout", opts.drainTimeout.String())
+
+	// Shutdown closes the listener and idle connections, and then waits for the
+	// remaining connections to become idle.  It is allowed the grace period beyond
+	// the drain deadline so that the errors sent to expired streams reach clients
+	// before their connections are closed.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.drainTimeout+drainGrace)
+	defer cancel()
+	shutdownC := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l *listener) {
+			shutdownC <- l.shutdown(shutdownCtx)
+		}(l)
+	}
+
+	select {
+	case <-idleC:
+	case <-time.After(opts.drainTimeout):
+		d.expire()
+		select {
+		case <-idleC:
+		case <-time.After(drainGrace):
+		}
+	}
+
+	isStopped := true
+	for range listeners {
+		if errGo := <-shutdownC; errGo != nil {
+			isStopped = false
+		}
+	}
+	if !isStopped {
+		d.abandon()
+		for _, l := range listeners {
+			if errGo := l.close(); errGo != nil && !errors.Is(errGo, net.ErrClosed) {
+				opts.logger.Warn("server close failed", "listener", l.kind, "error", errGo.Error())
+			}
+		}
+	}
+	opts.logger.Info("drain complete")
+}
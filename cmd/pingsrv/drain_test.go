@@ -0,0 +1,331 @@
+package main
+
+// This file contains tests of the draining of the server during shutdown, covering the
+// reporting of the services as NOT_SERVING, the refusal of new RPCs, the ending of streams at
+// the drain deadline, and the logging of the outcome of each stream.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+	"github.com/karlmutch/buf-ping/pkg/pingtest"
+
+	"github.com/karlmutch/kv"
+)
+
+// syncBuffer is a buffer that can be written to by the server while being read by the test
+type syncBuffer struct {
+	buf bytes.Buffer
+	sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (n int, err error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+// reasonOf returns the reason of the ErrorInfo detail carried by the error
+func reasonOf(t *testing.T, err error) (reason string) {
+	t.Helper()
+
+	connectErr := &connect.Error{}
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("expected a connect error, got %v", err)
+	}
+	for _, detail := range connectErr.Details() {
+		value, errGo := detail.Value()
+		if errGo != nil {
+			t.Fatal(errGo)
+		}
+		if info, isInfo := value.(*errdetails.ErrorInfo); isInfo {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+// checkShuttingDown fails the test unless the error tells the client the server is shutting down
+func checkShuttingDown(t *testing.T, err error) {
+	t.Helper()
+
+	checkCode(t, err, connect.CodeUnavailable)
+	if reason := reasonOf(t, err); reason != "SERVER_SHUTTING_DOWN" {
+		t.Fatalf("expected the reason SERVER_SHUTTING_DOWN, got %q", reason)
+	}
+}
+
+// TestDrain stops a server with a Watch stream that never ends on its own and checks that the
+// stream is ended with a clean error at the drain deadline, and that its outcome is logged
+func TestDrain(t *testing.T) {
+	log := &syncBuffer{}
+	drainTimeout := 500 * time.Millisecond
+	srv := pingtest.Start(t, func(ctx context.Context, cfg *pingtest.Config) (errs []kv.Error) {
+		cfg.Logger = slog.New(slog.NewTextHandler(log, nil))
+		opts := &serverOpts{
+			serviceID:    "ping-test",
+			ipPort:       cfg.Addr,
+			certPemFn:    cfg.Certs.CertFn,
+			certKeyFn:    cfg.Certs.KeyFn,
+			drainTimeout: drainTimeout,
+			startedC:     cfg.StartedC,
+			logger:       cfg.Logger,
+		}
+		return EntryPoint(ctx, opts)
+	})
+
+	c := srv.NewClient(t, client.Opts{Counter: "drain-watch"})
+	watchingC := make(chan struct{})
+	watchErrC := make(chan error, 1)
+	go func() {
+		watchErrC <- c.Watch(context.Background(), func(resp *pingv1.WatchResponse) error {
+			if resp.Procedure == "" {
+				close(watchingC)
+			}
+			return nil
+		})
+	}()
+	select {
+	case <-watchingC:
+	case err := <-watchErrC:
+		t.Fatalf("watch ended before the server was stopped, %v", err)
+	}
+
+	stopped := time.Now()
+	stopC := make(chan []kv.Error, 1)
+	go func() {
+		stopC <- srv.Stop()
+	}()
+
+	select {
+	case err := <-watchErrC:
+		checkShuttingDown(t, err)
+		if elapsed := time.Since(stopped); elapsed < drainTimeout {
+			t.Fatalf("expected the stream to be ended at the drain deadline, it was ended after %s", elapsed)
+		}
+	case <-time.After(drainTimeout + 5*time.Second):
+		t.Fatal("the stream was not ended at the drain deadline")
+	}
+	if errs := <-stopC; len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for _, line := range []string{
+		`msg=draining streams=1`,
+		`msg="stream drained" procedure=/ping.v1.PingService/Watch outcome="ended at deadline"`,
+		`msg="drain complete"`,
+	} {
+		if !strings.Contains(log.String(), line) {
+			t.Errorf("expected the log to contain %s, got\n%s", line, log.String())
+		}
+	}
+}
+
+// testStreamConn is a streaming connection for the procedure that has no messages
+type testStreamConn struct {
+	procedure string
+}
+
+func (conn *testStreamConn) Spec() connect.Spec {
+	return connect.Spec{Procedure: conn.procedure, StreamType: connect.StreamTypeServer}
+}
+func (conn *testStreamConn) Peer() connect.Peer           { return connect.Peer{} }
+func (conn *testStreamConn) Receive(any) error            { return errors.New("no messages") }
+func (conn *testStreamConn) RequestHeader() http.Header   { return http.Header{} }
+func (conn *testStreamConn) Send(any) error               { return nil }
+func (conn *testStreamConn) ResponseHeader() http.Header  { return http.Header{} }
+func (conn *testStreamConn) ResponseTrailer() http.Header { return http.Header{} }
+
+func TestDrainerOutcomes(t *testing.T) {
+	testCases := []struct {
+		name string
+		// end is how the stream is ended once draining has started
+		end     func(d *drainer, releaseC chan struct{})
+		err     error
+		outcome string
+		code    connect.Code
+		// isAbandoned streams are not waited upon by the drain
+		isAbandoned bool
+	}{
+		{
+			name:    "completed",
+			end:     func(d *drainer, releaseC chan struct{}) { close(releaseC) },
+			outcome: `outcome=completed`,
+		},
+		{
+			name:    "failed",
+			end:     func(d *drainer, releaseC chan struct{}) { close(releaseC) },
+			err:     connect.NewError(connect.CodeAborted, errors.New("failed")),
+			outcome: `outcome=failed`,
+			code:    connect.CodeAborted,
+		},
+		{
+			name:    "ended at deadline",
+			end:     func(d *drainer, releaseC chan struct{}) { d.expire() },
+			outcome: `outcome="ended at deadline"`,
+			code:    connect.CodeUnavailable,
+		},
+		{
+			name: "abandoned",
+			end: func(d *drainer, releaseC chan struct{}) {
+				d.abandon()
+				close(releaseC)
+			},
+			outcome:     `outcome=abandoned`,
+			isAbandoned: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			log := &syncBuffer{}
+			d := newDrainer(slog.New(slog.NewTextHandler(log, nil)))
+
+			startedC := make(chan struct{})
+			releaseC := make(chan struct{})
+			handler := d.WrapStreamingHandler(func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+				close(startedC)
+				select {
+				case <-releaseC:
+					return tc.err
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			errC := make(chan error, 1)
+			go func() {
+				errC <- handler(context.Background(), &testStreamConn{procedure: "/ping.v1.PingService/Watch"})
+			}()
+			<-startedC
+
+			idleC, streams := d.drain()
+			if streams != 1 {
+				t.Fatalf("expected 1 stream to be draining, got %d", streams)
+			}
+			tc.end(d, releaseC)
+
+			err := <-errC
+			checkCode(t, err, tc.code)
+			if tc.code == connect.CodeUnavailable {
+				checkShuttingDown(t, err)
+			}
+			if !tc.isAbandoned {
+				select {
+				case <-idleC:
+				case <-time.After(5 * time.Second):
+					t.Fatal("expected the drain to complete once the stream ended")
+				}
+			}
+			if !strings.Contains(log.String(), `msg="stream drained" procedure=/ping.v1.PingService/Watch `+tc.outcome) {
+				t.Fatalf("expected the log to contain %s, got\n%s", tc.outcome, log.String())
+			}
+			if lines := strings.Count(log.String(), "stream drained"); lines != 1 {
+				t.Fatalf("expected the outcome of the stream to be logged once, got\n%s", log.String())
+			}
+		})
+	}
+}
+
+// TestDrainerRefuses checks that RPCs started once draining has begun are refused with an
+// error telling the client to retry elsewhere
+func TestDrainerRefuses(t *testing.T) {
+	log := &syncBuffer{}
+	d := newDrainer(slog.New(slog.NewTextHandler(log, nil)))
+	if _, streams := d.drain(); streams != 0 {
+		t.Fatalf("expected no streams to be draining, got %d", streams)
+	}
+
+	isCalled := false
+	unary := d.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		isCalled = true
+		return nil, nil
+	})
+	_, err := unary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	checkShuttingDown(t, err)
+
+	streaming := d.WrapStreamingHandler(func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		isCalled = true
+		return nil
+	})
+	err = streaming(context.Background(), &testStreamConn{procedure: "/ping.v1.PingService/Watch"})
+	checkShuttingDown(t, err)
+
+	if isCalled {
+		t.Fatal("expected the handlers not to be called while draining")
+	}
+}
+
+// TestDrainerPanic checks that a stream whose handler panics, as those reset by fault injection
+// do, is no longer tracked and does not hold up draining
+func TestDrainerPanic(t *testing.T) {
+	log := &syncBuffer{}
+	d := newDrainer(slog.New(slog.NewTextHandler(log, nil)))
+
+	handler := d.WrapStreamingHandler(func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		panic(http.ErrAbortHandler)
+	})
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Fatalf("expected the panic of the handler to be passed on, got %v", recovered)
+			}
+		}()
+		_ = handler(context.Background(), &testStreamConn{procedure: "/ping.v1.PingService/Watch"})
+	}()
+
+	idleC, streams := d.drain()
+	if streams != 0 {
+		t.Fatalf("expected the stream that panicked to no longer be tracked, %d streams are draining", streams)
+	}
+	select {
+	case <-idleC:
+	default:
+		t.Fatal("expected the drain to complete immediately")
+	}
+}
+
+// TestDrainServerHealth checks that the services are reported as NOT_SERVING once draining starts
+func TestDrainServerHealth(t *testing.T) {
+	log := &syncBuffer{}
+	opts := &serverOpts{
+		drainTimeout: time.Second,
+		logger:       slog.New(slog.NewTextHandler(log, nil)),
+	}
+	services := []string{"ping-drain-test.v1.A", "ping-drain-test.v1.B"}
+	for _, service := range services {
+		serverHealth.SetStatus(service, grpchealth.StatusServing)
+	}
+
+	drainServer(opts, nil, newDrainer(opts.logger), services)
+
+	for _, service := range services {
+		resp, errGo := (&Checker{}).Check(context.Background(), &grpchealth.CheckRequest{Service: service})
+		if errGo != nil {
+			t.Fatal(errGo)
+		}
+		if resp.Status != grpchealth.StatusNotServing {
+			t.Errorf("expected %s to be NOT_SERVING, got %s", service, resp.Status)
+		}
+	}
+}
@@ -26,21 +26,106 @@ type serverOpts struct {
 	serviceID string
 	cfgHost   string
 
+	// ipPort is the address of the TLS listener, unused when noTLS is set
 	ipPort string
+	noTLS  bool
+
+	// h2cAddr, and unixSocket when set enable the cleartext HTTP/2 listeners
+	h2cAddr    string
+	unixSocket string
+	// http3Addr when set enables the HTTP/3 listener, it shares the TLS configuration
+	http3Addr string
+
+	// noREST disables the REST/JSON transcoding of the RPCs
+	noREST bool
+	// openapiPath when set is the path serving the OpenAPI document and explorer
+	openapiPath string
+
+	// environment selects defaults that differ between development and production, an empty
+	// value is production
+	environment string
+
+	// corsOrigins when empty uses the origins allowed by default in the environment
+	corsOrigins     string
+	corsMethods     string
+	corsHeaders     string
+	corsCredentials bool
 
 	certPemFn string
 	certKeyFn string
 
+	// devCerts generates the certificate, issued by the development CA in devCAFn, for the
+	// hosts in devCertHosts, along with the default hosts, when the files are missing
+	devCerts     bool
+	devCAFn      string
+	devCertHosts string
+
+	// clientCAFn when set enables mutual TLS using the CA bundle to verify client certificates
+	clientCAFn string
+
 	cfgNamespace string
 	cfgConfigMap string
 
+	authKeysFn   string
+	authIssuer   string
+	authAudience string
+
+	// stateDir when set enables persistence of the running total
+	stateDir              string
+	stateFsync            string
+	stateFsyncInterval    time.Duration
+	stateSnapshotInterval time.Duration
+
+	// counterScope partitions the named counters between callers, one of none, tenant, or baggage
+	counterScope       string
+	counterTenantClaim string
+	counterBaggageKey  string
+	maxCounters        int
+	counterOverflow    string
+
+	// watchBuffer, and watchSlowConsumer control the delivery of changes to Watch RPCs
+	watchBuffer       int
+	watchSlowConsumer string
+
+	// faultRulesFn, and faultAdmin enable the injection of faults into PingService RPCs
+	faultRulesFn string
+	faultAdmin   bool
+	// faultAdminScope is the bearer token scope callers of the FaultService must be granted
+	faultAdminScope string
+
+	// rateLimits when set enables the rate limiting of PingService RPCs for each caller
+	rateLimits      string
+	rateLimitKey    string
+	rateLimitHeader string
+
+	// admissionMaxInflight, and admissionLimits shed PingService RPCs beyond the concurrency limits
+	admissionMaxInflight int
+	admissionLimits      string
+	admissionAdaptive    bool
+	admissionRetryAfter  time.Duration
+
 	prometheusAddr    string
 	prometheusRefresh time.Duration
 
 	o11yKey string
 
+	// otelExporter selects the exporter of every signal, when empty the OTEL_* environment
+	// variables are used, see o11y.go
+	otelExporter       string
+	otelFile           string
+	otelFileMaxSize    int
+	otelFileMaxBackups int
+	otelMetricInterval time.Duration
+	otelSampler        string
+	otelSamplerArg     string
+
 	cooldown time.Duration
 	startedC chan any
+	// stoppedC is closed once the server has drained its RPCs and stopped
+	stoppedC chan struct{}
+
+	// drainTimeout is the time RPCs in flight are given to finish during shutdown
+	drainTimeout time.Duration
 
 	errorC  chan kv.Error
 	statusC chan []string
@@ -60,12 +145,24 @@ func EntryPoint(ctx context.Context, opts *serverOpts) (errs []kv.Error) {
 		opts.ipPort = "0.0.0.0:8080"
 	}
 
+	if opts.drainTimeout == 0 {
+		opts.drainTimeout = 20 * time.Second
+	}
+
+	if opts.prometheusRefresh == 0 {
+		opts.prometheusRefresh = 15 * time.Second
+	}
+	opts.stoppedC = make(chan struct{})
+
 	if len(opts.certPemFn) == 0 {
 		opts.certPemFn = "testing.crt"
 	}
 	if len(opts.certKeyFn) == 0 {
 		opts.certKeyFn = "testing.key"
 	}
+	if len(opts.devCAFn) == 0 {
+		opts.devCAFn = "testing-ca.crt"
+	}
 
 	if len(opts.o11yKey) == 0 {
 		opts.o11yKey = os.Getenv("HONEYCOMB_API_KEY")
@@ -112,6 +209,9 @@ func EntryPoint(ctx context.Context, opts *serverOpts) (errs []kv.Error) {
 
 	<-ctx.Done()
 
+	// Wait for the RPCs in flight to be drained
+	<-opts.stoppedC
+
 	return nil
 }
 
@@ -125,7 +225,8 @@ func processMonitor(ctx context.Context, cancel context.CancelFunc, opts *server
 	// Setup a channel for graceful shutdown on a CTRL-C etc
 	killC := make(chan os.Signal, 1)
 
-	// Asynchronous listener for SIGINT, SIGTERM, and SIGHUP ... signals
+	// Asynchronous listener for SIGINT, and SIGTERM ... signals, SIGHUP is reserved for
+	// certificate reloading
 	go func() {
 		for {
 			select {
@@ -135,7 +236,11 @@ func processMonitor(ctx context.Context, cancel context.CancelFunc, opts *server
 					opts.logger.Info(statusMsgs[0])
 				} else {
 					if len(statusMsgs) != 0 {
-						opts.logger.Info(statusMsgs[0], statusMsgs[1:])
+						args := make([]any, 0, len(statusMsgs)-1)
+						for _, msg := range statusMsgs[1:] {
+							args = append(args, msg)
+						}
+						opts.logger.Info(statusMsgs[0], args...)
 					}
 				}
 			case err := <-errorC:
@@ -151,6 +256,7 @@ func processMonitor(ctx context.Context, cancel context.CancelFunc, opts *server
 				if killC != nil {
 					close(killC)
 				}
+				cancel()
 				return
 			case <-ctx.Done():
 				defer func() {
@@ -170,8 +276,8 @@ func processMonitor(ctx context.Context, cancel context.CancelFunc, opts *server
 		}
 	}()
 
-	// Add the SIGINT, SIGTERM, and SIGHUP signals to the channel listener
-	signal.Notify(killC, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	// Add the SIGINT, and SIGTERM signals to the channel listener
+	signal.Notify(killC, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
 	return errorC, statusC
 }
@@ -0,0 +1,267 @@
+package main
+
+// This file contains the listeners the server accepts connections on.  Any
+// combination of a TLS listener, an HTTP/3 (QUIC) listener, a cleartext HTTP/2 (h2c)
+// listener, and a Unix domain socket can be served at once, each by its own server
+// sharing the same handler.  The HTTP/3 listener uses the TLS configuration and is
+// advertised to the clients of the TLS listener using the Alt-Svc header.  The h2c
+// listener is intended for use behind a TLS terminating proxy, such as a service mesh
+// sidecar, and is never enabled by default.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// h3PollInterval is the interval at which the requests in flight on the HTTP/3 listener
+// are checked while waiting for them to finish during shutdown
+const h3PollInterval = 100 * time.Millisecond
+
+// listener is an open listener and the server that will serve it, HTTP/3 listeners
+// use a UDP socket and their own server in place of the ln, and srvr fields
+type listener struct {
+	kind string
+	ln   net.Listener
+	srvr *http.Server
+
+	pc       net.PacketConn
+	h3       *http3.Server
+	inflight atomic.Int64
+}
+
+// newHTTPServer returns a server using the timeouts and limits common to every listener
+func newHTTPServer(handler http.Handler) (srvr *http.Server) {
+	return &http.Server{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       5 * time.Minute,
+		WriteTimeout:      5 * time.Minute,
+		MaxHeaderBytes:    8 * 1024, // 8KiB
+		Handler:           handler,
+	}
+}
+
+// newH2CServer returns a server accepting cleartext HTTP/2 using prior knowledge, or the
+// HTTP/1.1 upgrade, along with plain HTTP/1.1
+func newH2CServer(handler http.Handler) (srvr *http.Server, err kv.Error) {
+	h2s := &http2.Server{}
+	srvr = newHTTPServer(h2c.NewHandler(handler, h2s))
+
+	// Configuring the server registers the HTTP/2 connections so that they are sent a
+	// GOAWAY when the server is shut down
+	if errGo := http2.ConfigureServer(srvr, h2s); errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return srvr, nil
+}
+
+// newH3Listener returns an HTTP/3 listener serving the handler on a UDP socket.  The
+// quic-go server cannot be shut down gracefully so the requests it has in flight are
+// counted, allowing shutdown to wait for them before the server is closed.
+func newH3Listener(addr string, handler http.Handler, tlsConfig *tls.Config) (l *listener, err kv.Error) {
+	pc, errGo := net.ListenPacket("udp", addr)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("address", addr, "stack", stack.Trace().TrimRuntime())
+	}
+	l = &listener{kind: "h3", pc: pc}
+	l.h3 = &http3.Server{
+		TLSConfig: tlsConfig,
+		// 0-RTT is left disabled as requests sent using it can be replayed, and not every
+		// procedure is idempotent
+		QuicConfig:     &quic.Config{},
+		MaxHeaderBytes: 8 * 1024, // 8KiB
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.inflight.Add(1)
+			defer l.inflight.Add(-1)
+			handler.ServeHTTP(w, r)
+		}),
+	}
+	return l, nil
+}
+
+// altSvcHandler advertises the HTTP/3 listener using the Alt-Svc header of every response,
+// before the HTTP/3 listener is serving no header is added
+func altSvcHandler(h3 *http3.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = h3.SetQuicHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// listenUnix opens a Unix domain socket, replacing any socket left behind by a previous
+// server.  A socket that still accepts connections belongs to a running server and is
+// left in place, with an error returned.
+func listenUnix(path string) (ln net.Listener, err kv.Error) {
+	if info, errGo := os.Lstat(path); errGo == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, kv.NewError("the Unix socket path exists and is not a socket").With("path", path, "stack", stack.Trace().TrimRuntime())
+		}
+		if conn, errGo := net.DialTimeout("unix", path, time.Second); errGo == nil {
+			conn.Close()
+			return nil, kv.NewError("the Unix socket is in use by another server").With("path", path, "stack", stack.Trace().TrimRuntime())
+		}
+		if errGo = os.Remove(path); errGo != nil {
+			return nil, kv.Wrap(errGo).With("path", path, "stack", stack.Trace().TrimRuntime())
+		}
+	} else if !errors.Is(errGo, fs.ErrNotExist) {
+		return nil, kv.Wrap(errGo).With("path", path, "stack", stack.Trace().TrimRuntime())
+	}
+
+	ln, errGo := net.Listen("unix", path)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("path", path, "stack", stack.Trace().TrimRuntime())
+	}
+	return ln, nil
+}
+
+// openListeners opens every configured listener.  The listeners are opened before serving
+// starts so that failures to bind are returned to the caller rather than surfacing
+// asynchronously, if any listener fails those already opened are closed.
+func openListeners(opts *serverOpts, handler http.Handler, tlsConfig *tls.Config) (listeners []*listener, err kv.Error) {
+	defer func() {
+		if err != nil {
+			for _, l := range listeners {
+				if l.h3 != nil {
+					l.close()
+				} else {
+					l.ln.Close()
+				}
+			}
+			listeners = nil
+		}
+	}()
+
+	// The HTTP/3 listener is opened first so that the TLS listener can advertise it
+	var h3 *listener
+	if len(opts.http3Addr) != 0 {
+		if tlsConfig == nil {
+			return listeners, kv.NewError("the HTTP/3 listener requires TLS").With("address", opts.http3Addr, "stack", stack.Trace().TrimRuntime())
+		}
+		if h3, err = newH3Listener(opts.http3Addr, handler, tlsConfig); err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, h3)
+	}
+
+	if tlsConfig != nil {
+		ln, errGo := net.Listen("tcp", opts.ipPort)
+		if errGo != nil {
+			return listeners, kv.Wrap(errGo).With("address", opts.ipPort, "stack", stack.Trace().TrimRuntime())
+		}
+		tlsHandler := handler
+		if h3 != nil {
+			tlsHandler = altSvcHandler(h3.h3, handler)
+		}
+		srvr := newHTTPServer(tlsHandler)
+		srvr.TLSConfig = tlsConfig
+		listeners = append(listeners, &listener{kind: "tls", ln: ln, srvr: srvr})
+	}
+
+	if len(opts.h2cAddr) != 0 {
+		ln, errGo := net.Listen("tcp", opts.h2cAddr)
+		if errGo != nil {
+			return listeners, kv.Wrap(errGo).With("address", opts.h2cAddr, "stack", stack.Trace().TrimRuntime())
+		}
+		srvr, err := newH2CServer(handler)
+		if err != nil {
+			ln.Close()
+			return listeners, err
+		}
+		listeners = append(listeners, &listener{kind: "h2c", ln: ln, srvr: srvr})
+	}
+
+	if len(opts.unixSocket) != 0 {
+		ln, err := listenUnix(opts.unixSocket)
+		if err != nil {
+			return listeners, err
+		}
+		srvr, err := newH2CServer(handler)
+		if err != nil {
+			ln.Close()
+			return listeners, err
+		}
+		listeners = append(listeners, &listener{kind: "unix", ln: ln, srvr: srvr})
+	}
+
+	if len(listeners) == 0 {
+		return nil, kv.NewError("no listeners configured, enable TLS, an h2c address, or a Unix socket").With("stack", stack.Trace().TrimRuntime())
+	}
+	return listeners, nil
+}
+
+// serve starts serving the listener, errors other than the server being shut down are
+// sent to the server error channel
+func (l *listener) serve(opts *serverOpts) {
+	switch l.kind {
+	case "tls":
+		opts.logger.Info("TLS listener starting", "address", l.ln.Addr().String())
+	case "h3":
+		opts.logger.Info("HTTP/3 listener starting", "address", l.pc.LocalAddr().String())
+	case "h2c":
+		opts.logger.Warn("h2c listener starting, connections are neither encrypted nor authenticated by TLS", "address", l.ln.Addr().String())
+	case "unix":
+		opts.logger.Info("Unix socket listener starting", "path", l.ln.Addr().String())
+	}
+
+	go func() {
+		// The kind is used to select TLS as configuring HTTP/2 also populates the TLSConfig
+		var errGo error
+		switch l.kind {
+		case "tls":
+			errGo = l.srvr.ServeTLS(l.ln, "", "")
+		case "h3":
+			errGo = l.h3.Serve(l.pc)
+		default:
+			errGo = l.srvr.Serve(l.ln)
+		}
+		if errGo != nil && !errors.Is(errGo, http.ErrServerClosed) {
+			opts.errorC <- kv.Wrap(errGo).With("listener", l.kind, "stack", stack.Trace().TrimRuntime())
+		}
+	}()
+}
+
+// shutdown gracefully shuts the server of the listener down, waiting for requests in flight
+// until the context is done
+func (l *listener) shutdown(ctx context.Context) (errGo error) {
+	if l.h3 == nil {
+		return l.srvr.Shutdown(ctx)
+	}
+
+	ticker := time.NewTicker(h3PollInterval)
+	defer ticker.Stop()
+	for l.inflight.Load() != 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return l.close()
+}
+
+// close immediately closes the listener, and the connections of its server
+func (l *listener) close() (errGo error) {
+	if l.h3 == nil {
+		return l.srvr.Close()
+	}
+	// Closing the HTTP/3 server leaves the UDP socket it was given open
+	errGo = l.h3.Close()
+	if errClose := l.pc.Close(); errGo == nil {
+		errGo = errClose
+	}
+	return errGo
+}
@@ -0,0 +1,218 @@
+package main
+
+// This file contains tests of the listeners the server accepts connections on, covering the
+// TLS, HTTP/3, and cleartext HTTP/2 listeners, the Unix domain socket and the replacement of stale
+// sockets, and the advertisement of the HTTP/3 listener to clients of the TLS listener.
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+	"github.com/karlmutch/buf-ping/pkg/pingtest"
+
+	"github.com/karlmutch/kv"
+)
+
+// freePort returns a loopback address with a port that was free when it was checked, using UDP
+// when isUDP is set and otherwise TCP
+func freePort(t *testing.T, isUDP bool) (addr string) {
+	t.Helper()
+
+	if isUDP {
+		pc, errGo := net.ListenPacket("udp", "127.0.0.1:0")
+		if errGo != nil {
+			t.Fatal(errGo)
+		}
+		defer pc.Close()
+		return pc.LocalAddr().String()
+	}
+	ln, errGo := net.Listen("tcp", "127.0.0.1:0")
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// socketDir returns a directory for Unix sockets, which is kept short as the paths of sockets
+// are limited to about 100 bytes
+func socketDir(t *testing.T) (dir string) {
+	t.Helper()
+
+	dir, errGo := os.MkdirTemp("", "pingsrv")
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// TestListeners runs a server with every listener enabled and makes an RPC using each of them
+func TestListeners(t *testing.T) {
+	h2cAddr := freePort(t, false)
+	http3Addr := freePort(t, true)
+	socket := filepath.Join(socketDir(t), "ping.sock")
+
+	srv := pingtest.Start(t, func(ctx context.Context, cfg *pingtest.Config) (errs []kv.Error) {
+		opts := &serverOpts{
+			serviceID:    "ping-test",
+			ipPort:       cfg.Addr,
+			certPemFn:    cfg.Certs.CertFn,
+			certKeyFn:    cfg.Certs.KeyFn,
+			h2cAddr:      h2cAddr,
+			http3Addr:    http3Addr,
+			unixSocket:   socket,
+			drainTimeout: time.Second,
+			startedC:     cfg.StartedC,
+			logger:       cfg.Logger,
+		}
+		return EntryPoint(ctx, opts)
+	})
+
+	testCases := []struct {
+		name string
+		addr string
+		opts client.Opts
+	}{
+		{name: "tls", addr: srv.Addr, opts: client.Opts{CAFile: srv.Certs.CAFn, ServerName: pingtest.ServerName}},
+		{name: "h3", addr: http3Addr, opts: client.Opts{CAFile: srv.Certs.CAFn, ServerName: pingtest.ServerName, HTTP3: true}},
+		{name: "h2c", addr: "http://" + h2cAddr},
+		{name: "unix", addr: "unix://" + socket},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.DialTimeout = 5 * time.Second
+			tc.opts.Timeout = 30 * time.Second
+			for _, protocol := range protocols {
+				tc.opts.Protocol = protocol
+				c, err := client.NewClient(tc.addr, tc.opts)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				// The HTTP/3 server does not send trailers, which gRPC needs
+				_, errGo := c.Ping(context.Background())
+				if tc.opts.HTTP3 && protocol == client.ProtocolGRPC {
+					checkCode(t, errGo, connect.CodeInternal)
+					continue
+				}
+				checkCode(t, errGo, 0)
+			}
+		})
+	}
+
+	// The HTTP/3 listener is advertised to clients of the TLS listener
+	pem, errGo := os.ReadFile(srv.Certs.CAFn)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: pingtest.ServerName},
+			ForceAttemptHTTP2: true,
+		},
+		Timeout: 30 * time.Second,
+	}
+	defer httpClient.CloseIdleConnections()
+
+	resp, errGo := httpClient.Post("https://"+srv.Addr+"/ping.v1.PingService/Ping", "application/json", strings.NewReader("{}"))
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the Ping to succeed, got %s", resp.Status)
+	}
+	_, port, errGo := net.SplitHostPort(http3Addr)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	if altSvc := resp.Header.Get("Alt-Svc"); !strings.Contains(altSvc, `h3=":`+port+`"`) {
+		t.Fatalf("expected the HTTP/3 listener on port %s to be advertised, got Alt-Svc %q", port, altSvc)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	testCases := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		isError bool
+	}{
+		{name: "missing", prepare: func(t *testing.T, path string) {}},
+		{
+			name: "stale socket",
+			prepare: func(t *testing.T, path string) {
+				ln, errGo := net.Listen("unix", path)
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				// The socket file is left behind as it is by a server that did not exit cleanly
+				ln.(*net.UnixListener).SetUnlinkOnClose(false)
+				ln.Close()
+			},
+		},
+		{
+			name: "socket in use",
+			prepare: func(t *testing.T, path string) {
+				ln, errGo := net.Listen("unix", path)
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				t.Cleanup(func() { ln.Close() })
+			},
+			isError: true,
+		},
+		{
+			name: "not a socket",
+			prepare: func(t *testing.T, path string) {
+				if errGo := os.WriteFile(path, []byte("data"), 0o600); errGo != nil {
+					t.Fatal(errGo)
+				}
+			},
+			isError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(socketDir(t), "ping.sock")
+			tc.prepare(t, path)
+
+			ln, err := listenUnix(path)
+			switch {
+			case tc.isError && err == nil:
+				ln.Close()
+				t.Fatal("expected the socket to be refused")
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				// The path is left untouched for its owner
+				if _, errGo := os.Lstat(path); errGo != nil {
+					t.Fatal(errGo)
+				}
+				return
+			}
+			defer ln.Close()
+
+			conn, errGo := net.Dial("unix", path)
+			if errGo != nil {
+				t.Fatal(errGo)
+			}
+			conn.Close()
+		})
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 // This file contains the code used to initiate the server when not running under test.
-// Any CLI procesisng will be performed by tis function then it will invoke the EntryPoint
-// function to run the server proper.
+// Any CLI procesisng will be performed by tis function, see config.go, then it will invoke
+// the EntryPoint function to run the server proper.
 
 import (
 	"context"
@@ -11,6 +11,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/karlmutch/buf-ping/pkg/logging"
 	"github.com/karlmutch/go-service/pkg/process"
 	"github.com/karlmutch/go-service/pkg/runtime"
 
@@ -20,7 +21,25 @@ import (
 // main is the standard entrypoint for when the test suite is not being run
 func main() {
 
-	serverID := "ping-server"
+	// Records are written as JSON to stdout, and exported using the OTel logs pipeline once
+	// initO11y has set the global logger provider
+	opts := serverOpts{
+		logger:   slog.New(logging.NewHandler(logging.Opts{Local: slog.NewJSONHandler(os.Stdout, nil)})),
+		startedC: make(chan any),
+	}
+
+	fs, printOnly, err := parseConfig(os.Args[1:], &opts)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	if printOnly {
+		if err = printConfig(fs, os.Stdout); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-1)
+		}
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -33,24 +52,20 @@ func main() {
 
 	if runtime.BuildInfo.OS != "darwin" {
 		// Check for single instances
-		if _, err := process.NewExclusive(ctx, serverID); err != nil {
-			fmt.Println(serverID+" already running", "error", err.Error())
+		if _, err := process.NewExclusive(ctx, opts.serviceID); err != nil {
+			fmt.Println(opts.serviceID+" already running", "error", err.Error())
 			os.Exit(-2)
 		}
 	}
 
-	tracer, err := initO11y(ctx)
+	// Only invalid telemetry options are fatal, the server continues without the exporters that
+	// could not be started
+	tracer, shutdownO11y, err := initO11y(ctx, &opts)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(-3)
 	}
-	opts := serverOpts{
-		serviceID:         serverID,
-		logger:            slog.New(slog.NewJSONHandler(os.Stdout, nil)),
-		prometheusRefresh: time.Duration(15 * time.Second),
-		startedC:          make(chan any),
-		otelTracer:        tracer,
-	}
+	opts.otelTracer = tracer
 
 	// func is used to allow for defer's and system wide shutdown when the EntryPoint function exits
 	func() {
@@ -71,9 +86,11 @@ func main() {
 		}
 	}()
 
-	cooldown := time.Duration(time.Second)
-	opts.logger.Debug("shutting down", "cooldown", cooldown.String())
+	opts.logger.Debug("shutting down", "cooldown", opts.cooldown.String())
+
+	// Flush the telemetry of the drained RPCs
+	shutdownO11y()
 
-	// Wait for any internal go routines etc to shut down
-	time.Sleep(cooldown)
+	// The RPCs have been drained by EntryPoint, wait for any internal go routines etc to shut down
+	time.Sleep(opts.cooldown)
 }
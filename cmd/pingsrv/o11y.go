@@ -1,17 +1,45 @@
 package main
 
+// This file contains the initialization of the OpenTelemetry traces, metrics, and logs
+// pipelines.  The exporter used by every signal is selected using the otel-exporter option,
+// or when it is empty by the standard OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER,
+// OTEL_LOGS_EXPORTER, and OTEL_EXPORTER_OTLP_PROTOCOL environment variables.  The OTLP
+// exporters also honour the OTEL_EXPORTER_OTLP_* variables for their endpoints, headers,
+// and so on, and the resource the OTEL_SERVICE_NAME, and OTEL_RESOURCE_ATTRIBUTES, variables.
+//
+// Telemetry is not needed to serve RPCs, an exporter that cannot be created leaves its signal
+// disabled, and failed exports are logged then dropped, so that the server continues in a
+// degraded mode when the collector is unreachable.
+
 import (
 	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-stack/stack"
+	"github.com/karlmutch/go-service/pkg/runtime"
 	"github.com/karlmutch/kv"
-	"golang.org/x/exp/slog"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
 
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -19,83 +47,301 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	tracer trace.Tracer
+const (
+	exporterOTLPGRPC = "otlp-grpc"
+	exporterOTLPHTTP = "otlp-http"
+	exporterStdout   = "stdout"
+	exporterFile     = "file"
+	exporterNone     = "none"
+
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+
+	// exportErrorInterval is the minimum time between the logging of failed exports
+	exportErrorInterval = time.Minute
 )
 
-func newMeterProvider(ctx context.Context, res *resource.Resource) (meterProvider *metric.MeterProvider, err kv.Error) {
-	metricExporter, errGo := otlpmetricgrpc.New(ctx)
-	if errGo != nil {
-		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+// resolveExporter returns the exporter of the signal, the option takes precedence over the
+// OTEL_<SIGNAL>_EXPORTER, and OTEL_EXPORTER_OTLP_[<SIGNAL>_]PROTOCOL, environment variables
+func resolveExporter(exporter string, signal string) (resolved string, err kv.Error) {
+	if len(exporter) == 0 {
+		envSignal := strings.ToUpper(signal)
+		switch value := os.Getenv("OTEL_" + envSignal + "_EXPORTER"); value {
+		case "", "otlp":
+			protocol := os.Getenv("OTEL_EXPORTER_OTLP_" + envSignal + "_PROTOCOL")
+			if len(protocol) == 0 {
+				protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+			}
+			switch protocol {
+			case "", "grpc":
+				exporter = exporterOTLPGRPC
+			case "http/protobuf":
+				exporter = exporterOTLPHTTP
+			default:
+				return "", kv.NewError("unsupported OTLP protocol").With("signal", signal, "protocol", protocol, "stack", stack.Trace().TrimRuntime())
+			}
+		case "console":
+			exporter = exporterStdout
+		case "none":
+			exporter = exporterNone
+		default:
+			return "", kv.NewError("unsupported exporter").With("signal", signal, "exporter", value, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+
+	switch exporter {
+	case exporterOTLPGRPC, exporterOTLPHTTP, exporterStdout, exporterFile, exporterNone:
+		return exporter, nil
 	}
+	return "", kv.NewError("unknown exporter, expected one of otlp-grpc, otlp-http, stdout, file, or none").With("exporter", exporter, "stack", stack.Trace().TrimRuntime())
+}
 
-	meterProvider = metric.NewMeterProvider(
-		metric.WithResource(res),
-		metric.WithReader(metric.NewPeriodicReader(metricExporter,
-			// Default is 1m. Set to 3s for demonstrative purposes.
-			metric.WithInterval(3*time.Second))),
-	)
+// newSampler returns the trace sampler, the name and its argument fall back to the
+// OTEL_TRACES_SAMPLER, and OTEL_TRACES_SAMPLER_ARG, environment variables when empty
+func newSampler(name string, arg string) (sampler sdktrace.Sampler, description string, err kv.Error) {
+	if len(name) == 0 {
+		name = os.Getenv("OTEL_TRACES_SAMPLER")
+	}
+	if len(arg) == 0 {
+		arg = os.Getenv("OTEL_TRACES_SAMPLER_ARG")
+	}
 
-	// Handle shutdown properly so nothing leaks.
-	go func() {
-		<-ctx.Done()
-		if errGo := meterProvider.Shutdown(context.Background()); errGo != nil {
-			slog.WarnCtx(ctx, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime()).Error())
+	ratio := 1.0
+	if len(arg) != 0 && strings.HasSuffix(name, "traceidratio") {
+		value, errGo := strconv.ParseFloat(arg, 64)
+		if errGo != nil || value < 0 || value > 1 {
+			return nil, "", kv.NewError("the sampler ratio must be between 0 and 1").With("sampler", name, "ratio", arg, "stack", stack.Trace().TrimRuntime())
 		}
-	}()
-
-	// Register as global meter provider so that it can be used via otel.Meter
-	// and accessed using otel.GetMeterProvider.
-	// Most instrumentation libraries use the global meter provider as default.
-	// If the global meter provider is not set then a no-op implementation
-	// is used, which fails to generate data.
-	otel.SetMeterProvider(meterProvider)
+		ratio = value
+	}
 
-	return meterProvider, nil
+	switch name {
+	case "", "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), "parentbased_always_on", nil
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample()), name, nil
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), name + "=" + strconv.FormatFloat(ratio, 'g', -1, 64), nil
+	case "always_on":
+		return sdktrace.AlwaysSample(), name, nil
+	case "always_off":
+		return sdktrace.NeverSample(), name, nil
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio), name + "=" + strconv.FormatFloat(ratio, 'g', -1, 64), nil
+	}
+	return nil, "", kv.NewError("unknown sampler").With("sampler", name, "stack", stack.Trace().TrimRuntime())
 }
 
-func initTracer(ctx context.Context) (tracer trace.Tracer, err kv.Error) {
-	exporter, errGo := otlptracegrpc.New(context.Background())
+// newResource describes the server, the service name defaults to the service-id option and is
+// overridden by the OTEL_SERVICE_NAME, and OTEL_RESOURCE_ATTRIBUTES, environment variables
+func newResource(ctx context.Context, opts *serverOpts) (res *resource.Resource) {
+	resOpts := []resource.Option{
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(opts.serviceID),
+			semconv.ServiceVersion(runtime.BuildInfo.ShortRevision),
+		),
+		resource.WithFromEnv(),
+	}
+	res, errGo := resource.New(ctx, resOpts...)
 	if errGo != nil {
-		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+		// Partial resources are still usable, missing attributes are logged and ignored
+		opts.logger.Warn("telemetry resource incomplete", "error", errGo.Error())
 	}
+	if res == nil {
+		res = resource.Default()
+	}
+	return res
+}
 
-	rsc := resource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceName("example/pingbuf"),
-		// any attributes you want to set on your resource
-	)
-
-	bsp := sdktrace.NewBatchSpanProcessor(exporter)
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithResource(rsc),
-		sdktrace.WithSpanProcessor(bsp),
-	)
+// exportErrorHandler logs the errors of the OpenTelemetry SDK, such as failed exports, no more
+// than once every exportErrorInterval so that an unreachable collector does not flood the logs
+type exportErrorHandler struct {
+	logger *slog.Logger
 
-	// Handle shutdown properly so nothing leaks.
-	go func() {
-		<-ctx.Done()
-		defer func() { _ = tp.Shutdown(ctx) }()
-	}()
+	last       time.Time
+	suppressed int
+	sync.Mutex
+}
 
-	otel.SetTracerProvider(tp)
+// Handle implements the otel.ErrorHandler interface
+func (handler *exportErrorHandler) Handle(errGo error) {
+	handler.Lock()
+	if time.Since(handler.last) < exportErrorInterval {
+		handler.suppressed++
+		handler.Unlock()
+		return
+	}
+	suppressed := handler.suppressed
+	handler.last = time.Now()
+	handler.suppressed = 0
+	handler.Unlock()
 
-	// Finally, set the tracer that can be used for this package.
-	tracer = tp.Tracer("main/pingbuf")
+	handler.logger.Warn("telemetry export failed, telemetry is being dropped", "error", errGo.Error(), "suppressed", suppressed)
+}
 
-	_, err = newMeterProvider(ctx, rsc)
-	if err != nil {
-		return nil, kv.Wrap(err).With("stack", stack.Trace().TrimRuntime())
+func newTraceExporter(ctx context.Context, exporter string, w io.Writer) (spanExporter sdktrace.SpanExporter, errGo error) {
+	switch exporter {
+	case exporterOTLPGRPC:
+		return otlptracegrpc.New(ctx)
+	case exporterOTLPHTTP:
+		return otlptracehttp.New(ctx)
+	case exporterStdout, exporterFile:
+		return stdouttrace.New(stdouttrace.WithWriter(w))
 	}
+	return nil, nil
+}
 
-	return tracer, nil
+func newMetricExporter(ctx context.Context, exporter string, w io.Writer) (metricExporter metric.Exporter, errGo error) {
+	switch exporter {
+	case exporterOTLPGRPC:
+		return otlpmetricgrpc.New(ctx)
+	case exporterOTLPHTTP:
+		return otlpmetrichttp.New(ctx)
+	case exporterStdout, exporterFile:
+		return stdoutmetric.New(stdoutmetric.WithWriter(w))
+	}
+	return nil, nil
 }
 
-func initO11y(ctx context.Context) (tp trace.Tracer, err kv.Error) {
+func newLogExporter(ctx context.Context, exporter string, w io.Writer) (logExporter sdklog.Exporter, errGo error) {
+	switch exporter {
+	case exporterOTLPGRPC:
+		return otlploggrpc.New(ctx)
+	case exporterOTLPHTTP:
+		return otlploghttp.New(ctx)
+	case exporterFile:
+		return stdoutlog.New(stdoutlog.WithWriter(w))
+	}
+	// The server logger already writes records to stdout
+	return nil, nil
+}
 
-	_, err = initTracer(ctx)
+// initO11y sets the global OpenTelemetry providers, and propagator, returning the tracer of the
+// server and a function that flushes, and stops, the pipelines.  Errors are only returned for
+// invalid options, exporters that cannot be created are logged and their signal disabled.
+func initO11y(ctx context.Context, opts *serverOpts) (tracer trace.Tracer, shutdown func(), err kv.Error) {
+	exporters := map[string]string{}
+	for _, signal := range []string{signalTraces, signalMetrics, signalLogs} {
+		if exporters[signal], err = resolveExporter(opts.otelExporter, signal); err != nil {
+			return nil, nil, err
+		}
+	}
+	sampler, samplerDesc, err := newSampler(opts.otelSampler, opts.otelSamplerArg)
 	if err != nil {
-		return nil, kv.Wrap(err).With("stack", stack.Trace().TrimRuntime())
+		return nil, nil, err
 	}
-	return tracer, nil
+
+	otel.SetErrorHandler(&exportErrorHandler{logger: opts.logger})
+
+	// The file exporter writes JSON lines for every signal to a single rotating file
+	var file *lumberjack.Logger
+	writerOf := func(exporter string) (w io.Writer) {
+		if exporter != exporterFile {
+			return os.Stdout
+		}
+		if file == nil {
+			file = &lumberjack.Logger{
+				Filename:   opts.otelFile,
+				MaxSize:    opts.otelFileMaxSize,
+				MaxBackups: opts.otelFileMaxBackups,
+			}
+		}
+		return file
+	}
+
+	res := newResource(ctx, opts)
+
+	// Spans are always recorded, even without an exporter, so that logs carry trace identifiers
+	traceOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+	if spanExporter, errGo := newTraceExporter(ctx, exporters[signalTraces], writerOf(exporters[signalTraces])); errGo != nil {
+		opts.logger.Warn("trace exporter unavailable, traces are disabled", "exporter", exporters[signalTraces], "error", errGo.Error())
+		exporters[signalTraces] = exporterNone
+	} else if spanExporter != nil {
+		traceOpts = append(traceOpts, sdktrace.WithBatcher(spanExporter))
+	}
+	tp := sdktrace.NewTracerProvider(traceOpts...)
+
+	metricOpts := []metric.Option{metric.WithResource(res)}
+	if metricExporter, errGo := newMetricExporter(ctx, exporters[signalMetrics], writerOf(exporters[signalMetrics])); errGo != nil {
+		opts.logger.Warn("metric exporter unavailable, metrics are disabled", "exporter", exporters[signalMetrics], "error", errGo.Error())
+		exporters[signalMetrics] = exporterNone
+	} else if metricExporter != nil {
+		// The interval defaults to the OTEL_METRIC_EXPORT_INTERVAL environment variable, or 1m
+		readerOpts := []metric.PeriodicReaderOption{}
+		if opts.otelMetricInterval != 0 {
+			readerOpts = append(readerOpts, metric.WithInterval(opts.otelMetricInterval))
+		}
+		metricOpts = append(metricOpts, metric.WithReader(metric.NewPeriodicReader(metricExporter, readerOpts...)))
+	}
+	mp := metric.NewMeterProvider(metricOpts...)
+
+	var lp *sdklog.LoggerProvider
+	if logExporter, errGo := newLogExporter(ctx, exporters[signalLogs], writerOf(exporters[signalLogs])); errGo != nil {
+		opts.logger.Warn("log exporter unavailable, logs are only written to stdout", "exporter", exporters[signalLogs], "error", errGo.Error())
+		exporters[signalLogs] = exporterNone
+	} else if logExporter != nil {
+		// Records are emitted by the logging.Handler of the server logger, which uses the
+		// global logger provider
+		lp = sdklog.NewLoggerProvider(
+			sdklog.WithResource(res),
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		)
+		global.SetLoggerProvider(lp)
+	}
+
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	// Baggage is propagated so that callers can scope the counters they use
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	opts.logger.Info("telemetry configured", "traces", exporters[signalTraces], "metrics", exporters[signalMetrics], "logs", exporters[signalLogs], "sampler", samplerDesc)
+
+	// Pipelines are flushed together within the cooldown so that an unreachable collector cannot
+	// delay the exit of the server
+	shutdown = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.cooldown)
+		defer cancel()
+
+		providers := map[string]func(context.Context) error{
+			signalTraces:  tp.Shutdown,
+			signalMetrics: mp.Shutdown,
+		}
+		if lp != nil {
+			providers[signalLogs] = lp.Shutdown
+		}
+
+		wg := sync.WaitGroup{}
+		for signal, providerShutdown := range providers {
+			wg.Add(1)
+			go func(signal string, providerShutdown func(context.Context) error) {
+				defer wg.Done()
+				if errGo := providerShutdown(ctx); errGo != nil {
+					opts.logger.Warn("telemetry not flushed during shutdown", "signal", signal, "error", errGo.Error())
+				}
+			}(signal, providerShutdown)
+		}
+
+		// Exports in progress are not always cancelled by the deadline, those still running
+		// after the cooldown are abandoned
+		doneC := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(doneC)
+		}()
+		select {
+		case <-doneC:
+			if file != nil {
+				file.Close()
+			}
+		case <-ctx.Done():
+		}
+	}
+
+	return tp.Tracer("main/pingbuf"), shutdown, nil
 }
@@ -0,0 +1,315 @@
+package main
+
+// This file contains tests of the configuration of the OpenTelemetry pipelines, covering the
+// selection of exporters using the otel-exporter option and the OTEL_* environment variables,
+// the parsing of the trace sampler, and the degraded mode used when the collector is
+// unreachable.
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// otelEnv lists the environment variables read when selecting exporters, and samplers, which
+// are cleared by the tests so that the environment of the test run cannot influence them
+var otelEnv = []string{
+	"OTEL_TRACES_EXPORTER", "OTEL_METRICS_EXPORTER", "OTEL_LOGS_EXPORTER",
+	"OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL",
+	"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL",
+	"OTEL_TRACES_SAMPLER", "OTEL_TRACES_SAMPLER_ARG",
+}
+
+// setOtelEnv clears the OTEL_* environment variables, then sets those supplied
+func setOtelEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for _, name := range otelEnv {
+		t.Setenv(name, "")
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+func TestResolveExporter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exporter string
+		signal   string
+		env      map[string]string
+		resolved string
+		isError  bool
+	}{
+		{name: "default", signal: signalTraces, resolved: exporterOTLPGRPC},
+		{name: "option", exporter: exporterFile, signal: signalLogs, resolved: exporterFile},
+		{name: "option over env", exporter: exporterStdout, signal: signalTraces, env: map[string]string{"OTEL_TRACES_EXPORTER": "none"}, resolved: exporterStdout},
+		{name: "unknown option", exporter: "jaeger", signal: signalTraces, isError: true},
+		{name: "env otlp", signal: signalMetrics, env: map[string]string{"OTEL_METRICS_EXPORTER": "otlp"}, resolved: exporterOTLPGRPC},
+		{name: "env console", signal: signalMetrics, env: map[string]string{"OTEL_METRICS_EXPORTER": "console"}, resolved: exporterStdout},
+		{name: "env none", signal: signalLogs, env: map[string]string{"OTEL_LOGS_EXPORTER": "none"}, resolved: exporterNone},
+		{name: "env of another signal", signal: signalTraces, env: map[string]string{"OTEL_METRICS_EXPORTER": "none"}, resolved: exporterOTLPGRPC},
+		{name: "unsupported env", signal: signalTraces, env: map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, isError: true},
+		{name: "http protocol", signal: signalTraces, env: map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}, resolved: exporterOTLPHTTP},
+		{
+			name:     "signal protocol over protocol",
+			signal:   signalTraces,
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc"},
+			resolved: exporterOTLPGRPC,
+		},
+		{
+			name:     "protocol of another signal",
+			signal:   signalLogs,
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf"},
+			resolved: exporterOTLPGRPC,
+		},
+		{name: "unsupported protocol", signal: signalTraces, env: map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, isError: true},
+		{
+			name:     "protocol ignored by the option",
+			exporter: exporterNone,
+			signal:   signalTraces,
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"},
+			resolved: exporterNone,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			setOtelEnv(t, tc.env)
+
+			resolved, err := resolveExporter(tc.exporter, tc.signal)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected the exporter to be refused, got %s", resolved)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if resolved != tc.resolved {
+				t.Fatalf("expected the exporter %s, got %s", tc.resolved, resolved)
+			}
+		})
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	testCases := []struct {
+		name        string
+		sampler     string
+		arg         string
+		env         map[string]string
+		description string
+		isError     bool
+	}{
+		{name: "default", description: "parentbased_always_on"},
+		{name: "always off", sampler: "always_off", description: "always_off"},
+		{name: "parent based always off", sampler: "parentbased_always_off", description: "parentbased_always_off"},
+		{name: "ratio", sampler: "traceidratio", arg: "0.25", description: "traceidratio=0.25"},
+		{name: "ratio defaults to every trace", sampler: "traceidratio", description: "traceidratio=1"},
+		{name: "parent based ratio", sampler: "parentbased_traceidratio", arg: "0", description: "parentbased_traceidratio=0"},
+		{name: "argument ignored", sampler: "always_on", arg: "not a ratio", description: "always_on"},
+		{
+			name:        "env",
+			env:         map[string]string{"OTEL_TRACES_SAMPLER": "parentbased_traceidratio", "OTEL_TRACES_SAMPLER_ARG": "0.5"},
+			description: "parentbased_traceidratio=0.5",
+		},
+		{
+			name:        "option over env",
+			sampler:     "traceidratio",
+			arg:         "0.1",
+			env:         map[string]string{"OTEL_TRACES_SAMPLER": "always_off", "OTEL_TRACES_SAMPLER_ARG": "0.5"},
+			description: "traceidratio=0.1",
+		},
+		{
+			name:        "env argument of the option",
+			sampler:     "traceidratio",
+			env:         map[string]string{"OTEL_TRACES_SAMPLER": "always_off", "OTEL_TRACES_SAMPLER_ARG": "0.5"},
+			description: "traceidratio=0.5",
+		},
+		{name: "ratio above 1", sampler: "traceidratio", arg: "1.5", isError: true},
+		{name: "negative ratio", sampler: "parentbased_traceidratio", arg: "-0.1", isError: true},
+		{name: "ratio not a number", sampler: "traceidratio", arg: "half", isError: true},
+		{name: "unknown", sampler: "jaeger_remote", isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			setOtelEnv(t, tc.env)
+
+			sampler, description, err := newSampler(tc.sampler, tc.arg)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected the sampler to be refused, got %s", description)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if description != tc.description {
+				t.Fatalf("expected the sampler %s, got %s", tc.description, description)
+			}
+			if sampler == nil {
+				t.Fatal("expected a sampler")
+			}
+		})
+	}
+}
+
+func TestExportErrorHandler(t *testing.T) {
+	log := &syncBuffer{}
+	handler := &exportErrorHandler{logger: slog.New(slog.NewTextHandler(log, nil))}
+
+	// Failures within the interval are counted rather than logged
+	for i := 0; i != 3; i++ {
+		handler.Handle(os.ErrDeadlineExceeded)
+	}
+	if logged := strings.Count(log.String(), "telemetry export failed"); logged != 1 {
+		t.Fatalf("expected a single failure to be logged, got\n%s", log.String())
+	}
+
+	handler.Lock()
+	handler.last = time.Now().Add(-exportErrorInterval)
+	handler.Unlock()
+	handler.Handle(os.ErrDeadlineExceeded)
+	if !strings.Contains(log.String(), "suppressed=2") {
+		t.Fatalf("expected the suppressed failures to be reported, got\n%s", log.String())
+	}
+}
+
+// restoreO11y returns the global OpenTelemetry providers to those in place before the test once
+// it completes
+func restoreO11y(t *testing.T) {
+	t.Helper()
+
+	tp := otel.GetTracerProvider()
+	mp := otel.GetMeterProvider()
+	lp := global.GetLoggerProvider()
+	propagator := otel.GetTextMapPropagator()
+	errorHandler := otel.GetErrorHandler()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tp)
+		otel.SetMeterProvider(mp)
+		global.SetLoggerProvider(lp)
+		otel.SetTextMapPropagator(propagator)
+		otel.SetErrorHandler(errorHandler)
+	})
+}
+
+// newO11yOpts returns the options of a server using the exporter, and its log
+func newO11yOpts(t *testing.T, exporter string) (opts *serverOpts, log *syncBuffer) {
+	t.Helper()
+
+	log = &syncBuffer{}
+	opts = &serverOpts{
+		serviceID:       "ping-test",
+		otelExporter:    exporter,
+		otelFile:        filepath.Join(t.TempDir(), "otel.jsonl"),
+		otelFileMaxSize: 1,
+		cooldown:        time.Second,
+		logger:          slog.New(slog.NewTextHandler(log, nil)),
+	}
+	return opts, log
+}
+
+func TestInitO11yFile(t *testing.T) {
+	restoreO11y(t)
+	setOtelEnv(t, nil)
+	opts, log := newO11yOpts(t, exporterFile)
+
+	tracer, shutdown, err := initO11y(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, span := tracer.Start(context.Background(), "o11y-file-test")
+	span.End()
+	shutdown()
+
+	if !strings.Contains(log.String(), "traces=file metrics=file logs=file") {
+		t.Fatalf("expected every signal to use the file exporter, got\n%s", log.String())
+	}
+	data, errGo := os.ReadFile(opts.otelFile)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	if !strings.Contains(string(data), "o11y-file-test") {
+		t.Fatalf("expected the span to be written to the file, got\n%s", data)
+	}
+}
+
+func TestInitO11yInvalid(t *testing.T) {
+	restoreO11y(t)
+
+	testCases := []struct {
+		name string
+		env  map[string]string
+		opts func(opts *serverOpts)
+	}{
+		{name: "exporter", opts: func(opts *serverOpts) { opts.otelExporter = "jaeger" }},
+		{name: "exporter env", env: map[string]string{"OTEL_LOGS_EXPORTER": "zipkin"}},
+		{name: "sampler", opts: func(opts *serverOpts) { opts.otelSampler = "sometimes" }},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			setOtelEnv(t, tc.env)
+			opts, _ := newO11yOpts(t, "")
+			if tc.opts != nil {
+				tc.opts(opts)
+			}
+			if _, _, err := initO11y(context.Background(), opts); err == nil {
+				t.Fatal("expected the options to be refused")
+			}
+		})
+	}
+}
+
+// TestInitO11yUnreachable checks that a server whose collector cannot be reached still starts,
+// and that the telemetry it cannot export does not delay its exit beyond the cooldown
+func TestInitO11yUnreachable(t *testing.T) {
+	restoreO11y(t)
+
+	// The port is closed once its address is known so that nothing is listening on it
+	ln, errGo := net.Listen("tcp", "127.0.0.1:0")
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	for _, exporter := range []string{exporterOTLPGRPC, exporterOTLPHTTP} {
+		exporter := exporter
+		t.Run(exporter, func(t *testing.T) {
+			setOtelEnv(t, nil)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://"+addr)
+			opts, log := newO11yOpts(t, exporter)
+
+			tracer, shutdown, err := initO11y(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			_, span := tracer.Start(context.Background(), "o11y-unreachable-test")
+			span.End()
+
+			started := time.Now()
+			shutdown()
+			if elapsed := time.Since(started); elapsed > opts.cooldown+time.Second {
+				t.Fatalf("expected the shutdown to complete within the cooldown of %s, it took %s", opts.cooldown, elapsed)
+			}
+			if !strings.Contains(log.String(), "telemetry configured") {
+				t.Fatalf("expected the telemetry to be configured, got\n%s", log.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+// This file contains tests of every PingService RPC made against pingsrv running in-process,
+// using each of the protocols supported by the client.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+	"github.com/karlmutch/buf-ping/pkg/pingtest"
+
+	"github.com/karlmutch/kv"
+)
+
+// startPingsrv runs pingsrv using the configuration of the test harness
+func startPingsrv(ctx context.Context, cfg *pingtest.Config) (errs []kv.Error) {
+	opts := &serverOpts{
+		serviceID:    "ping-test",
+		ipPort:       cfg.Addr,
+		certPemFn:    cfg.Certs.CertFn,
+		certKeyFn:    cfg.Certs.KeyFn,
+		drainTimeout: 5 * time.Second,
+		startedC:     cfg.StartedC,
+		logger:       cfg.Logger,
+	}
+	return EntryPoint(ctx, opts)
+}
+
+var protocols = []client.Protocol{client.ProtocolConnect, client.ProtocolGRPC, client.ProtocolGRPCWeb}
+
+// TestPingService runs a single server shared by the tests of every RPC, the tests use
+// counters named after the test case and protocol so that they do not see each others changes
+func TestPingService(t *testing.T) {
+	srv := pingtest.Start(t, startPingsrv)
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, srv *pingtest.Server, protocol client.Protocol)
+	}{
+		{"Ping", testPing},
+		{"Sum", testSum},
+		{"Generate", testGenerate},
+		{"Count", testCount},
+		{"Reset", testReset},
+		{"Set", testSet},
+		{"Watch", testWatch},
+		{"HardFail", testHardFail},
+	}
+	for _, protocol := range protocols {
+		protocol := protocol
+		t.Run(string(protocol), func(t *testing.T) {
+			for _, tc := range tests {
+				tc := tc
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+					tc.test(t, srv, protocol)
+				})
+			}
+		})
+	}
+}
+
+// newCounterClient returns a client using the protocol and a counter unique to the test case,
+// with the counter set to the initial value
+func newCounterClient(t *testing.T, srv *pingtest.Server, protocol client.Protocol, counter string, initial int32) (c *client.Client) {
+	t.Helper()
+
+	c = srv.NewClient(t, client.Opts{Protocol: protocol, Counter: string(protocol) + "." + counter})
+	if _, err := c.Set(context.Background(), int64(initial), nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// checkCode fails the test when the error does not carry the expected code, a code of zero
+// expects no error
+func checkCode(t *testing.T, err error, expected connect.Code) {
+	t.Helper()
+
+	switch {
+	case expected == 0 && err != nil:
+		t.Fatalf("unexpected error %v", err)
+	case expected != 0 && err == nil:
+		t.Fatalf("expected a %s error", expected)
+	case expected != 0 && connect.CodeOf(err) != expected:
+		t.Fatalf("expected a %s error, got %v", expected, err)
+	}
+}
+
+func testPing(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name    string
+		counter string
+		initial int32
+		sum     int64
+	}{
+		{name: "zero", counter: "ping-zero"},
+		{name: "positive", counter: "ping-positive", initial: 42, sum: 42},
+		{name: "negative", counter: "ping-negative", initial: -7, sum: -7},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			resp, err := c.Ping(context.Background())
+			checkCode(t, err, 0)
+			if resp.Sum64 != tc.sum || int64(resp.Sum) != tc.sum {
+				t.Fatalf("expected a sum of %d, got %d and %d", tc.sum, resp.Sum, resp.Sum64)
+			}
+			if since := time.Since(resp.Timestamp.AsTime()); since < -time.Minute || since > time.Minute {
+				t.Fatalf("server timestamp %v is not current", resp.Timestamp.AsTime())
+			}
+		})
+	}
+
+	t.Run("invalid counter", func(t *testing.T) {
+		c := srv.NewClient(t, client.Opts{Protocol: protocol, Counter: "not a valid counter name"})
+		_, err := c.Ping(context.Background())
+		checkCode(t, err, connect.CodeInvalidArgument)
+	})
+}
+
+func testSum(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name      string
+		counter   string
+		initial   int32
+		additions []int32
+		sum       int64
+	}{
+		{name: "single", counter: "sum-single", additions: []int32{5}, sum: 5},
+		{name: "several", counter: "sum-several", additions: []int32{1, 2, 3, 4}, sum: 10},
+		{name: "negative", counter: "sum-negative", additions: []int32{10, -4}, sum: 6},
+		{name: "existing total", counter: "sum-existing", initial: 100, additions: []int32{1, 1}, sum: 102},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			resp, err := c.Sum(context.Background(), tc.additions)
+			checkCode(t, err, 0)
+			if resp.Sum64 != tc.sum || int64(resp.Sum) != tc.sum {
+				t.Fatalf("expected a sum of %d, got %d and %d", tc.sum, resp.Sum, resp.Sum64)
+			}
+		})
+	}
+}
+
+func testGenerate(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name     string
+		counter  string
+		initial  int32
+		addition int32
+		progress []int64
+	}{
+		{name: "none", counter: "generate-none", addition: 0, progress: []int64{}},
+		{name: "from zero", counter: "generate-zero", addition: 3, progress: []int64{1, 2, 3}},
+		{name: "existing total", counter: "generate-existing", initial: 10, addition: 2, progress: []int64{11, 12}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			progress := []int64{}
+			err := c.Generate(context.Background(), tc.addition, func(resp *pingv1.GenerateResponse) error {
+				progress = append(progress, resp.Progress64)
+				return nil
+			})
+			checkCode(t, err, 0)
+			checkSequence(t, progress, tc.progress)
+		})
+	}
+}
+
+func testCount(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name      string
+		counter   string
+		initial   int32
+		additions []int32
+		sums      []int64
+	}{
+		{name: "empty", counter: "count-empty", additions: []int32{}, sums: []int64{}},
+		{name: "single", counter: "count-single", additions: []int32{3}, sums: []int64{1, 2, 3}},
+		{name: "several", counter: "count-several", additions: []int32{2, 0, 1}, sums: []int64{1, 2, 3}},
+		{name: "existing total", counter: "count-existing", initial: 5, additions: []int32{2}, sums: []int64{6, 7}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			sums := []int64{}
+			err := c.Count(context.Background(), tc.additions, func(resp *pingv1.CountResponse) error {
+				sums = append(sums, resp.Sum64)
+				return nil
+			})
+			checkCode(t, err, 0)
+			checkSequence(t, sums, tc.sums)
+		})
+	}
+}
+
+func testReset(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	expect := func(value int64) *int64 { return &value }
+
+	tests := []struct {
+		name     string
+		counter  string
+		initial  int32
+		expected *int64
+		code     connect.Code
+		sum      int64
+	}{
+		{name: "unconditional", counter: "reset-unconditional", initial: 9},
+		{name: "expected total", counter: "reset-expected", initial: 9, expected: expect(9)},
+		{name: "unexpected total", counter: "reset-unexpected", initial: 9, expected: expect(3), code: connect.CodeAborted, sum: 9},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			resp, err := c.Reset(context.Background(), tc.expected)
+			checkCode(t, err, tc.code)
+			if err == nil && resp.Sum64 != 0 {
+				t.Fatalf("expected a sum of 0, got %d", resp.Sum64)
+			}
+			checkTotal(t, c, tc.sum)
+		})
+	}
+
+	t.Run("unused counter", func(t *testing.T) {
+		c := srv.NewClient(t, client.Opts{Protocol: protocol, Counter: string(protocol) + ".reset-unused"})
+		_, err := c.Reset(context.Background(), expect(0))
+		checkCode(t, err, 0)
+		_, err = c.Reset(context.Background(), expect(5))
+		checkCode(t, err, connect.CodeAborted)
+	})
+}
+
+func testSet(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	expect := func(value int64) *int64 { return &value }
+
+	tests := []struct {
+		name     string
+		counter  string
+		initial  int32
+		value    int64
+		expected *int64
+		code     connect.Code
+		sum      int64
+	}{
+		{name: "unconditional", counter: "set-unconditional", initial: 1, value: 42, sum: 42},
+		{name: "negative", counter: "set-negative", value: -42, sum: -42},
+		{name: "expected total", counter: "set-expected", initial: 1, value: 42, expected: expect(1), sum: 42},
+		{name: "unexpected total", counter: "set-unexpected", initial: 1, value: 42, expected: expect(2), code: connect.CodeAborted, sum: 1},
+		{name: "beyond int32", counter: "set-int64", initial: 1, value: math.MaxInt32 + 1, sum: math.MaxInt32 + 1},
+		{name: "int64 limit", counter: "set-int64-limit", value: math.MinInt64, expected: expect(0), sum: math.MinInt64},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			resp, err := c.Set(context.Background(), tc.value, tc.expected)
+			checkCode(t, err, tc.code)
+			if err == nil && resp.Sum64 != tc.sum {
+				t.Fatalf("expected a sum of %d, got %d", tc.sum, resp.Sum64)
+			}
+			checkTotal(t, c, tc.sum)
+		})
+	}
+
+	t.Run("expected beyond int32", func(t *testing.T) {
+		c := newCounterClient(t, srv, protocol, "set-int64-expected", 0)
+		_, err := c.Set(context.Background(), math.MaxInt64, nil)
+		checkCode(t, err, 0)
+		// The total clamped to an int32 must not be mistaken for the total
+		_, err = c.Set(context.Background(), 1, expect(math.MaxInt32))
+		checkCode(t, err, connect.CodeAborted)
+		_, err = c.Set(context.Background(), 1, expect(math.MaxInt64))
+		checkCode(t, err, 0)
+		checkTotal(t, c, 1)
+	})
+}
+
+// errWatchDone ends a Watch RPC once the expected changes have been seen
+var errWatchDone = errors.New("watch done")
+
+func testWatch(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name    string
+		counter string
+		initial int32
+		// change is made using a second client once the watch has started
+		change  func(ctx context.Context, c *client.Client) error
+		changes []*pingv1.WatchResponse
+	}{
+		{
+			name:    "set",
+			counter: "watch-set",
+			initial: 5,
+			change: func(ctx context.Context, c *client.Client) (err error) {
+				_, err = c.Set(ctx, 8, nil)
+				return err
+			},
+			changes: []*pingv1.WatchResponse{
+				{Sum64: 5},
+				{Sum64: 8, Delta64: 3, Procedure: "/ping.v1.PingService/Set"},
+			},
+		},
+		{
+			name:    "sum",
+			counter: "watch-sum",
+			change: func(ctx context.Context, c *client.Client) (err error) {
+				_, err = c.Sum(ctx, []int32{2, -1})
+				return err
+			},
+			changes: []*pingv1.WatchResponse{
+				{Sum64: 0},
+				{Sum64: 2, Delta64: 2, Procedure: "/ping.v1.PingService/Sum"},
+				{Sum64: 1, Delta64: -1, Procedure: "/ping.v1.PingService/Sum"},
+			},
+		},
+		{
+			name:    "reset",
+			counter: "watch-reset",
+			initial: 3,
+			change: func(ctx context.Context, c *client.Client) (err error) {
+				_, err = c.Reset(ctx, nil)
+				return err
+			},
+			changes: []*pingv1.WatchResponse{
+				{Sum64: 3},
+				{Sum64: 0, Delta64: -3, Procedure: "/ping.v1.PingService/Reset"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			watcher := newCounterClient(t, srv, protocol, tc.counter, tc.initial)
+			changer := srv.NewClient(t, client.Opts{Protocol: protocol, Counter: string(protocol) + "." + tc.counter})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			wg := sync.WaitGroup{}
+			changeErrC := make(chan error, 1)
+			received := []*pingv1.WatchResponse{}
+			err := watcher.Watch(ctx, func(resp *pingv1.WatchResponse) error {
+				received = append(received, resp)
+				if len(received) == 1 {
+					// The change is only made once the watch is known to be in place
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						changeErrC <- tc.change(ctx, changer)
+					}()
+				}
+				if len(received) == len(tc.changes) {
+					return errWatchDone
+				}
+				return nil
+			})
+			wg.Wait()
+			if !errors.Is(err, errWatchDone) {
+				t.Fatalf("watch ended early, %v", err)
+			}
+			if errGo := <-changeErrC; errGo != nil {
+				t.Fatal(errGo)
+			}
+			for i, expected := range tc.changes {
+				actual := received[i]
+				if actual.Sum64 != expected.Sum64 || actual.Delta64 != expected.Delta64 || actual.Procedure != expected.Procedure || actual.Gap {
+					t.Fatalf("change %d expected sum %d, delta %d, procedure %q, got %v", i, expected.Sum64, expected.Delta64, expected.Procedure, actual)
+				}
+			}
+		})
+	}
+}
+
+func testHardFail(t *testing.T, srv *pingtest.Server, protocol client.Protocol) {
+	tests := []struct {
+		name    string
+		code    connect.Code
+		details []pingv1.ErrorDetail
+		types   []string
+	}{
+		{
+			name:  "default details",
+			code:  connect.CodeInternal,
+			types: []string{"google.rpc.ErrorInfo", "google.rpc.DebugInfo"},
+		},
+		{
+			name:    "retry info",
+			code:    connect.CodeUnavailable,
+			details: []pingv1.ErrorDetail{pingv1.ErrorDetail_ERROR_DETAIL_RETRY_INFO},
+			types:   []string{"google.rpc.RetryInfo"},
+		},
+		{
+			name:    "bad request",
+			code:    connect.CodeInvalidArgument,
+			details: []pingv1.ErrorDetail{pingv1.ErrorDetail_ERROR_DETAIL_BAD_REQUEST},
+			types:   []string{"google.rpc.BadRequest"},
+		},
+		{
+			name:  "permission denied",
+			code:  connect.CodePermissionDenied,
+			types: []string{"google.rpc.ErrorInfo", "google.rpc.DebugInfo"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := srv.NewClient(t, client.Opts{Protocol: protocol})
+			err := c.HardFail(context.Background(), tc.code, tc.details...)
+			checkCode(t, err, tc.code)
+
+			connectErr := &connect.Error{}
+			if !errors.As(err, &connectErr) {
+				t.Fatalf("expected a connect error, got %v", err)
+			}
+			types := []string{}
+			for _, detail := range connectErr.Details() {
+				types = append(types, detail.Type())
+			}
+			if len(types) != len(tc.types) {
+				t.Fatalf("expected details %v, got %v", tc.types, types)
+			}
+			for i := range types {
+				if types[i] != tc.types[i] {
+					t.Fatalf("expected details %v, got %v", tc.types, types)
+				}
+			}
+		})
+	}
+}
+
+// checkSequence fails the test when the values streamed by an RPC are not those expected
+func checkSequence(t *testing.T, actual []int64, expected []int64) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+// checkTotal fails the test when the counter of the client does not hold the expected total
+func checkTotal(t *testing.T, c *client.Client, expected int64) {
+	t.Helper()
+
+	resp, err := c.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Sum64 != expected {
+		t.Fatalf("expected a total of %d, got %d", expected, resp.Sum64)
+	}
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"connectrpc.com/connect"
@@ -12,49 +15,24 @@ import (
 	"connectrpc.com/otelconnect"
 
 	"github.com/go-stack/stack"
-	"github.com/rs/cors"
 
-	"buf.build/gen/go/karlmutch/buf-ping/connectrpc/go/ping/v1/pingv1connect"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
 
+	"github.com/karlmutch/buf-ping/pkg/admission"
+	"github.com/karlmutch/buf-ping/pkg/auth"
+	"github.com/karlmutch/buf-ping/pkg/fault"
+	"github.com/karlmutch/buf-ping/pkg/logging"
+	"github.com/karlmutch/buf-ping/pkg/openapi"
 	"github.com/karlmutch/buf-ping/pkg/ping"
+	"github.com/karlmutch/buf-ping/pkg/ping/store"
+	"github.com/karlmutch/buf-ping/pkg/transcode"
 	"github.com/karlmutch/go-service/pkg/components"
+	"github.com/karlmutch/go-service/pkg/runtime"
 
 	"github.com/karlmutch/kv"
 )
 
-// newCORS will setup the cors package for the server
-func newCORS() (coresProfile *cors.Cors) {
-	coresProfile = cors.New(cors.Options{
-		AllowedMethods: []string{
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPut,
-		},
-		AllowOriginFunc: func(origin string) bool {
-			// Allow all origins, a little too permissive for now
-			return true
-		},
-		AllowedHeaders: []string{"*"},
-		ExposedHeaders: []string{
-			"Accept",
-			"Accept-Encoding",
-			"Accept-Post",
-			"Connect-Accept-Encoding",
-			"Connect-Content-Encoding",
-			"Content-Encoding",
-			"Grpc-Accept-Encoding",
-			"Grpc-Encoding",
-			"Grpc-Message",
-			"Grpc-Status",
-			"Grpc-Status-Details-Bin",
-			"X-Grpc-Test-Echo-Initial",
-			"X-Grpc-Test-Echo-Trailing-Bin",
-		},
-	})
-	return coresProfile
-}
-
-func newTLSConfig() (tlsConfig *tls.Config) {
+func newTLSConfig(opts *serverOpts) (tlsConfig *tls.Config, err kv.Error) {
 
 	// For more information about the `Modern Compatability` being used
 	// please read https://wiki.mozilla.org/Security/Server_Side_TLS#Modern_compatibility.
@@ -69,12 +47,80 @@ func newTLSConfig() (tlsConfig *tls.Config) {
 			tls.TLS_CHACHA20_POLY1305_SHA256,
 		},
 	}
-	return tlsConfig
+
+	// When a client CA bundle is configured mutual TLS is enforced and every client
+	// must present a certificate issued by one of the bundles CAs
+	if len(opts.clientCAFn) != 0 {
+		pem, errGo := os.ReadFile(opts.clientCAFn)
+		if errGo != nil {
+			return nil, kv.Wrap(errGo).With("file", opts.clientCAFn, "stack", stack.Trace().TrimRuntime())
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, kv.NewError("no client CA certificates found").With("file", opts.clientCAFn, "stack", stack.Trace().TrimRuntime())
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
 }
 
 func startServer(ctx context.Context, opts *serverOpts, comps *components.Components) (err kv.Error) {
 
-	pingServer := ping.NewPingServer(*opts.logger)
+	// The fault administration service changes the outcome of every PingService RPC, so it is
+	// only served when callers can be authenticated
+	if opts.faultAdmin && len(opts.authKeysFn) == 0 {
+		return kv.NewError("the fault admin service requires authentication, configure auth-keys to enable it").With("stack", stack.Trace().TrimRuntime())
+	}
+
+	// The running total is persisted when a state directory is configured
+	var stateStore store.Store
+	var disk *store.Disk
+	if len(opts.stateDir) != 0 {
+		disk, err = store.NewDisk(store.DiskOpts{
+			Dir:              opts.stateDir,
+			Fsync:            store.FsyncPolicy(opts.stateFsync),
+			FsyncInterval:    opts.stateFsyncInterval,
+			SnapshotInterval: opts.stateSnapshotInterval,
+			Logger:           opts.logger,
+		})
+		if err != nil {
+			return err
+		}
+		// The store is closed by the shutdown goroutine once the server is running, until then
+		// any failure to start closes it so that the log is not left open
+		defer func() {
+			if err != nil {
+				if errClose := disk.Close(); errClose != nil {
+					opts.logger.Warn("counter state store close failed", "error", errClose.Error())
+				}
+			}
+		}()
+		stateStore = disk
+		opts.logger.Info("counter state persisted", "dir", opts.stateDir, "fsync", opts.stateFsync)
+	}
+
+	pingServer, err := ping.NewPingServer(*opts.logger, ping.PingServerOpts{
+		Store:       stateStore,
+		Scope:       ping.CounterScope(opts.counterScope),
+		TenantClaim: opts.counterTenantClaim,
+		BaggageKey:  opts.counterBaggageKey,
+		MaxCounters: opts.maxCounters,
+		Overflow:    ping.OverflowPolicy(opts.counterOverflow),
+
+		WatchBuffer:  opts.watchBuffer,
+		SlowConsumer: ping.SlowConsumerPolicy(opts.watchSlowConsumer),
+	})
+	if err != nil {
+		return err
+	}
+	// Like the store the ping server is closed by the shutdown goroutine, or by a failure to start
+	defer func() {
+		if err != nil {
+			if errClose := pingServer.Close(); errClose != nil {
+				opts.logger.Warn("ping server close failed", "error", errClose.Error())
+			}
+		}
+	}()
 
 	compress1KB := connect.WithCompressMinBytes(1024)
 
@@ -82,11 +128,111 @@ func startServer(ctx context.Context, opts *serverOpts, comps *components.Compon
 	// metrics to both clients and handlers. By default, it uses OpenTelemetry's
 	// global TracerProvider and MeterProvider, which you can configure by
 	// following the OpenTelemetry documentation.
-	interceptors := connect.WithInterceptors(otelconnect.NewInterceptor(otelconnect.WithTrustRemote()))
+	drain := newDrainer(opts.logger)
+	handlerInterceptors := []connect.Interceptor{
+		otelconnect.NewInterceptor(otelconnect.WithTrustRemote()),
+		drain,
+		auth.NewIdentityInterceptor(),
+		// Handlers log using a logger from the context annotated with the procedure, and peer
+		logging.NewInterceptor(opts.logger),
+	}
+
+	// Bearer token authentication is placed after the OTel interceptor so that rejected
+	// requests are still traced
+	if len(opts.authKeysFn) != 0 {
+		authInterceptor, err := auth.NewInterceptor(auth.Opts{
+			KeysFn:   opts.authKeysFn,
+			Issuer:   opts.authIssuer,
+			Audience: opts.authAudience,
+			Leeway:   time.Minute,
+		})
+		if err != nil {
+			return err
+		}
+		handlerInterceptors = append(handlerInterceptors, authInterceptor)
+	} else {
+		opts.logger.Warn("authentication disabled, no token verification keys were configured")
+	}
+	interceptors := connect.WithInterceptors(handlerInterceptors...)
+
+	// Rate limiting, admission control, and faults, only apply to the PingService, leaving the
+	// administration of the rules and the other services unaffected by them.  Rate limiting is
+	// applied first so that callers over their limit do not occupy the concurrency limits.
+	pingHandlerInterceptors := append([]connect.Interceptor{}, handlerInterceptors...)
+
+	// Latency, and stream, metrics are recorded ahead of rate limiting, admission control, and
+	// fault injection so that their rejections appear in the metrics using their codes.  RPCs
+	// refused while draining, or for lacking authentication, are rejected by the shared
+	// interceptors before reaching it and are only measured by otelconnect.
+	pingHandlerInterceptors = append(pingHandlerInterceptors, ping.NewMetricsInterceptor())
+	if len(opts.rateLimits) != 0 {
+		limits, err := ping.ParseRateLimits(opts.rateLimits)
+		if err != nil {
+			return err
+		}
+		rateLimiter, err := ping.NewRateLimiter(ping.RateLimitOpts{
+			Limits: limits,
+			Key:    ping.RateLimitKey(opts.rateLimitKey),
+			Header: opts.rateLimitHeader,
+		})
+		if err != nil {
+			return err
+		}
+		pingHandlerInterceptors = append(pingHandlerInterceptors, rateLimiter)
+		opts.logger.Info("rate limiting enabled", "limits", opts.rateLimits, "key", opts.rateLimitKey)
+	}
+	var controller *admission.Controller
+	if opts.admissionMaxInflight != 0 || len(opts.admissionLimits) != 0 || opts.admissionAdaptive {
+		limits, err := admission.ParseLimits(opts.admissionLimits)
+		if err != nil {
+			return err
+		}
+		if controller, err = admission.NewController(admission.Opts{
+			MaxInflight: opts.admissionMaxInflight,
+			Limits:      limits,
+			Adaptive:    opts.admissionAdaptive,
+			RetryAfter:  opts.admissionRetryAfter,
+		}); err != nil {
+			return err
+		}
+		pingHandlerInterceptors = append(pingHandlerInterceptors, controller)
+		opts.logger.Info("admission control enabled", "max_inflight", opts.admissionMaxInflight, "limits", opts.admissionLimits, "adaptive", opts.admissionAdaptive)
+	}
+	// Like the ping server the controller is closed by the shutdown goroutine, or by a failure to start
+	defer func() {
+		if err != nil && controller != nil {
+			if errClose := controller.Close(); errClose != nil {
+				opts.logger.Warn("admission controller close failed", "error", errClose.Error())
+			}
+		}
+	}()
+
+	var injector *fault.Injector
+	if len(opts.faultRulesFn) != 0 || opts.faultAdmin {
+		if injector, err = fault.NewInjector(fault.Opts{
+			RulesFn:     opts.faultRulesFn,
+			TenantClaim: opts.counterTenantClaim,
+		}); err != nil {
+			return err
+		}
+		pingHandlerInterceptors = append(pingHandlerInterceptors, injector)
+		opts.logger.Warn("fault injection enabled", "rules", len(injector.Rules()), "admin", opts.faultAdmin)
+	}
 
 	// Combine everything into a single handler for nthe ping service route
 	mux := http.NewServeMux()
-	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer, interceptors, compress1KB))
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer, connect.WithInterceptors(pingHandlerInterceptors...), compress1KB))
+
+	// The fault administration service uses the same authentication as the PingService, and
+	// is only available to callers granted the admin scope
+	if opts.faultAdmin {
+		scopeInterceptor, err := auth.NewScopeInterceptor(opts.faultAdminScope)
+		if err != nil {
+			return err.With("option", "fault-admin-scope")
+		}
+		faultInterceptors := connect.WithInterceptors(append(append([]connect.Interceptor{}, handlerInterceptors...), scopeInterceptor)...)
+		mux.Handle(pingv1connect.NewFaultServiceHandler(fault.NewAdminServer(*opts.logger, injector), faultInterceptors, compress1KB))
+	}
 
 	// For more information please see, https://github.com/bufbuild/connect-grpchealth-go
 	// The health checker is not given authentication checking
@@ -96,36 +242,112 @@ func startServer(ctx context.Context, opts *serverOpts, comps *components.Compon
 	AddStaticChecker(ctx, pingv1connect.PingServiceName)
 
 	// Reflection will use authentication
+	services := []string{pingv1connect.PingServiceName}
+	if opts.faultAdmin {
+		AddStaticChecker(ctx, pingv1connect.FaultServiceName)
+		services = append(services, pingv1connect.FaultServiceName)
+	}
 	mux.Handle(grpcreflect.NewHandlerV1(
-		grpcreflect.NewStaticReflector(pingv1connect.PingServiceName),
+		grpcreflect.NewStaticReflector(services...),
 		compress1KB,
 		interceptors,
 	))
 	mux.Handle(grpcreflect.NewHandlerV1Alpha(
-		grpcreflect.NewStaticReflector(pingv1connect.PingServiceName),
+		grpcreflect.NewStaticReflector(services...),
 		compress1KB,
 		interceptors,
 	))
 
-	srvr := &http.Server{
-		Addr:              opts.ipPort,
-		ReadHeaderTimeout: time.Second,
-		ReadTimeout:       5 * time.Minute,
-		WriteTimeout:      5 * time.Minute,
-		MaxHeaderBytes:    8 * 1024, // 8KiB
-		TLSConfig:         newTLSConfig(),
-		Handler:           newCORS().Handler(mux),
-	}
-	opts.logger.Info("TLS listener starting", "address", opts.ipPort)
-	errGo := srvr.ListenAndServeTLS(opts.certPemFn, opts.certKeyFn)
-	if errGo != nil {
-		opts.errorC <- kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
-	}
-
-	comps.SetModule(opts.serviceID, false)
-	func() {
-		defer recover()
-		close(opts.errorC)
+	// TLS can be disabled when the server is only reached using h2c, or a Unix socket
+	var tlsConfig *tls.Config
+	if !opts.noTLS {
+		if tlsConfig, err = newTLSConfig(opts); err != nil {
+			return err
+		}
+		if tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+			opts.logger.Info("mutual TLS enabled", "client_ca", opts.clientCAFn)
+		}
+
+		if opts.devCerts {
+			if err = ensureDevCerts(opts); err != nil {
+				return err
+			}
+		}
+
+		// The certificate is served from the reloader so that rotated certificates are
+		// picked up without restarting the server
+		reloader, err := newCertReloader(ctx, opts)
+		if err != nil {
+			return err
+		}
+		tlsConfig.GetCertificate = reloader.GetCertificate
+	}
+
+	// The OpenAPI document, and explorer, describe the same services as reflection and are
+	// served without authentication as they hold nothing beyond the protobuf definitions
+	if len(opts.openapiPath) != 0 {
+		explorerPath := strings.TrimSuffix(opts.openapiPath, "/") + "/"
+		explorer, err := openapi.NewHandler(explorerPath, openapi.Opts{
+			Title:    "ping.v1",
+			Version:  runtime.BuildInfo.ShortRevision,
+			Services: services,
+			REST:     !opts.noREST,
+		})
+		if err != nil {
+			return err
+		}
+		mux.Handle(explorerPath, explorer)
+		opts.logger.Info("API explorer enabled", "path", explorerPath)
+	}
+
+	// REST/JSON requests are transcoded using the HTTP annotations of the services and
+	// passed to the mux, so they are handled exactly as Connect requests are
+	handler := http.Handler(mux)
+	if !opts.noREST {
+		transcoder, err := transcode.NewHandler(mux, transcode.Opts{Services: services})
+		if err != nil {
+			return err
+		}
+		handler = transcoder
+		opts.logger.Info("REST transcoding enabled", "routes", transcoder.Routes())
+	}
+
+	corsHandler, err := newCORS(opts, auth.NewIdentityHandler(handler))
+	if err != nil {
+		return err
+	}
+	listeners, err := openListeners(opts, corsHandler, tlsConfig)
+	if err != nil {
+		return err
+	}
+	for _, l := range listeners {
+		l.serve(opts)
+	}
+	for _, service := range services {
+		serverHealth.SetStatus(service, grpchealth.StatusServing)
+	}
+
+	// Once the server is asked to stop the RPCs in flight are drained before the state
+	// they change is closed
+	go func() {
+		<-ctx.Done()
+		drainServer(opts, listeners, drain, services)
+
+		if err := pingServer.Close(); err != nil {
+			opts.logger.Warn("ping server close failed", "error", err.Error())
+		}
+		if controller != nil {
+			if err := controller.Close(); err != nil {
+				opts.logger.Warn("admission controller close failed", "error", err.Error())
+			}
+		}
+		if disk != nil {
+			if err := disk.Close(); err != nil {
+				opts.logger.Warn("counter state store close failed", "error", err.Error())
+			}
+		}
+		comps.SetModule(opts.serviceID, false)
+		close(opts.stoppedC)
 	}()
 
 	return nil
@@ -0,0 +1,97 @@
+package main
+
+// This file contains tests of the checks made by the server before it starts serving, and of
+// the authorization of the services it serves.
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+	"github.com/karlmutch/buf-ping/pkg/pingtest"
+
+	"github.com/karlmutch/kv"
+)
+
+// TestFaultAdminRequiresAuth checks that the fault admin service, which can fail any RPC, is not
+// served to unauthenticated callers
+func TestFaultAdminRequiresAuth(t *testing.T) {
+	opts := &serverOpts{
+		serviceID:  "ping-test",
+		faultAdmin: true,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	err := startServer(context.Background(), opts, nil)
+	if err == nil {
+		t.Fatal("expected the server to refuse the fault admin service without authentication")
+	}
+	if !strings.Contains(err.Error(), "auth-keys") {
+		t.Errorf("expected the error to name the auth-keys option, got %s", err.Error())
+	}
+}
+
+// TestFaultAdminScope checks that the fault admin service is only available to callers whose
+// bearer token grants the admin scope, while the PingService accepts any valid token
+func TestFaultAdminScope(t *testing.T) {
+	secret := []byte("a shared secret used by the tests")
+	keysFn := filepath.Join(t.TempDir(), "auth.key")
+	if errGo := os.WriteFile(keysFn, secret, 0o600); errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	srv := pingtest.Start(t, func(ctx context.Context, cfg *pingtest.Config) (errs []kv.Error) {
+		opts := &serverOpts{
+			serviceID:       "ping-test",
+			ipPort:          cfg.Addr,
+			certPemFn:       cfg.Certs.CertFn,
+			certKeyFn:       cfg.Certs.KeyFn,
+			authKeysFn:      keysFn,
+			faultAdmin:      true,
+			faultAdminScope: "ping.fault.admin",
+			drainTimeout:    time.Second,
+			startedC:        cfg.StartedC,
+			logger:          cfg.Logger,
+		}
+		return EntryPoint(ctx, opts)
+	})
+
+	testCases := []struct {
+		name   string
+		claims jwt.MapClaims
+		code   connect.Code
+	}{
+		{name: "scope granted", claims: jwt.MapClaims{"scope": "openid ping.fault.admin"}},
+		{name: "scope not granted", claims: jwt.MapClaims{"scope": "openid"}, code: connect.CodePermissionDenied},
+		{name: "no scopes", claims: jwt.MapClaims{}, code: connect.CodePermissionDenied},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.claims["sub"] = "tester"
+			tc.claims["exp"] = time.Now().Add(time.Hour).Unix()
+			token, errGo := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString(secret)
+			if errGo != nil {
+				t.Fatal(errGo)
+			}
+			c := srv.NewClient(t, client.Opts{Token: token})
+
+			_, err := c.GetFaultRules(context.Background())
+			checkCode(t, err, tc.code)
+			err = c.SetFaultRules(context.Background(), nil)
+			checkCode(t, err, tc.code)
+
+			// The scope is only required by the fault admin service
+			_, err = c.Ping(context.Background())
+			checkCode(t, err, 0)
+		})
+	}
+}
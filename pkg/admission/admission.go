@@ -0,0 +1,288 @@
+package admission
+
+// This file contains a connectrpc interceptor that performs admission control for
+// the RPCs handled by the server.  The number of RPCs running at once is limited
+// for the server as a whole and for each procedure, RPCs arriving once a limit has
+// been reached are shed immediately with resource_exhausted rather than queued, and
+// carry a hint of when clients should retry.  The limits of unary procedures can
+// optionally adapt to the latency of the RPCs, shrinking when latency climbs above
+// that seen when the server was lightly loaded.
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+const (
+	// DefaultRetryAfter is the delay clients are advised to wait before retrying a shed RPC
+	DefaultRetryAfter = time.Second
+
+	// adaptiveCeiling is the limit adaptive procedures start from when no limit was configured
+	adaptiveCeiling = 1000
+)
+
+var (
+	admissionMeter           = otel.GetMeterProvider().Meter("bufping/admission")
+	admissionRejectedCounter metric.Int64Counter
+	admissionInflight        metric.Int64UpDownCounter
+	admissionLimitGauge      metric.Int64ObservableGauge
+)
+
+func init() {
+	admissionRejectedCounter, _ = admissionMeter.Int64Counter(
+		"pingbuf.admission.rejected.counter",
+		metric.WithDescription("Number of RPCs shed by admission control."),
+		metric.WithUnit("{call}"),
+	)
+	admissionInflight, _ = admissionMeter.Int64UpDownCounter(
+		"pingbuf.admission.inflight",
+		metric.WithDescription("Number of RPCs admitted and still running."),
+		metric.WithUnit("{call}"),
+	)
+	admissionLimitGauge, _ = admissionMeter.Int64ObservableGauge(
+		"pingbuf.admission.limit",
+		metric.WithDescription("The current concurrency limit of each procedure."),
+		metric.WithUnit("{call}"),
+	)
+}
+
+// Limit is the maximum number of RPCs of a procedure that may run at once
+type Limit struct {
+	// Procedure is a procedure name, or a path.Match glob such as /ping.v1.PingService/*
+	Procedure string
+	// Max is the maximum number of concurrent RPCs, zero leaves the procedure unlimited
+	Max int
+}
+
+// ParseLimits parses a comma separated list of procedure=max limits, for example
+// "/ping.v1.PingService/Generate=16,/ping.v1.PingService/*=256"
+func ParseLimits(spec string) (limits []Limit, err kv.Error) {
+	limits = []Limit{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		procedure, value, isPresent := strings.Cut(item, "=")
+		if !isPresent {
+			return nil, kv.NewError("limits must be of the form procedure=max").With("limit", item, "stack", stack.Trace().TrimRuntime())
+		}
+		if _, errGo := path.Match(procedure, ""); errGo != nil {
+			return nil, kv.Wrap(errGo).With("procedure", procedure, "stack", stack.Trace().TrimRuntime())
+		}
+		max, errGo := strconv.Atoi(value)
+		if errGo != nil || max < 0 {
+			return nil, kv.NewError("limits must be a non-negative integer").With("limit", item, "stack", stack.Trace().TrimRuntime())
+		}
+		limits = append(limits, Limit{Procedure: procedure, Max: max})
+	}
+	return limits, nil
+}
+
+// Opts contains the options used when creating a Controller
+type Opts struct {
+	// MaxInflight is the maximum number of RPCs running at once across all procedures, zero is unlimited
+	MaxInflight int
+	// Limits are the per procedure limits, the first limit matching a procedure is used
+	Limits []Limit
+	// Adaptive enables the adjustment of the limits of unary procedures using their latency
+	Adaptive bool
+	// MinLimit is the lowest limit adaptive procedures are reduced to, default 1
+	MinLimit int
+	// RetryAfter is the delay clients are advised to wait before retrying a shed RPC, default DefaultRetryAfter
+	RetryAfter time.Duration
+}
+
+// Controller is a connectrpc interceptor that admits, or sheds, RPCs using the configured limits
+type Controller struct {
+	opts Opts
+
+	inflight   int
+	procedures map[string]*limiter
+	sync.Mutex
+
+	// registration reports the limits of the procedures to the gauge until the controller is closed
+	registration metric.Registration
+}
+
+// NewController returns an admission controller using the options supplied
+func NewController(opts Opts) (controller *Controller, err kv.Error) {
+	if opts.MaxInflight < 0 {
+		return nil, kv.NewError("the maximum inflight RPCs must not be negative").With("max_inflight", opts.MaxInflight, "stack", stack.Trace().TrimRuntime())
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = DefaultRetryAfter
+	}
+	for _, limit := range opts.Limits {
+		if limit.Max < 0 {
+			return nil, kv.NewError("limits must not be negative").With("procedure", limit.Procedure, "max", limit.Max, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+
+	controller = &Controller{
+		opts:       opts,
+		procedures: map[string]*limiter{},
+	}
+	registration, errGo := admissionMeter.RegisterCallback(controller.observe, admissionLimitGauge)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	controller.registration = registration
+	return controller, nil
+}
+
+// Close stops the reporting of the limits of the procedures, it is called once the server is no
+// longer handling RPCs and can be called more than once
+func (controller *Controller) Close() (err kv.Error) {
+	controller.Lock()
+	registration := controller.registration
+	controller.registration = nil
+	controller.Unlock()
+
+	if registration == nil {
+		return nil
+	}
+	if errGo := registration.Unregister(); errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return nil
+}
+
+// limiter returns the limiter of a procedure, creating it on first use
+func (controller *Controller) limiter(procedure string, isUnary bool) (l *limiter) {
+	controller.Lock()
+	defer controller.Unlock()
+
+	if l, isPresent := controller.procedures[procedure]; isPresent {
+		return l
+	}
+
+	max := 0
+	for _, limit := range controller.opts.Limits {
+		if isMatch, _ := path.Match(limit.Procedure, procedure); isMatch {
+			max = limit.Max
+			break
+		}
+	}
+	l = newLimiter(max, controller.opts.MinLimit, controller.opts.Adaptive && isUnary)
+	controller.procedures[procedure] = l
+	return l
+}
+
+// admit reserves a place for an RPC of the procedure, the returned function must be called
+// with the latency of the RPC once it completes
+func (controller *Controller) admit(ctx context.Context, procedure string, isUnary bool) (done func(latency time.Duration), err error) {
+	l := controller.limiter(procedure, isUnary)
+
+	controller.Lock()
+	if controller.opts.MaxInflight != 0 && controller.inflight >= controller.opts.MaxInflight {
+		controller.Unlock()
+		return nil, controller.reject(ctx, procedure, "server", controller.opts.MaxInflight)
+	}
+	if limit, isAdmitted := l.acquire(); !isAdmitted {
+		controller.Unlock()
+		return nil, controller.reject(ctx, procedure, "procedure", limit)
+	}
+	controller.inflight++
+	controller.Unlock()
+
+	attrs := metric.WithAttributes(attribute.String("rpc.procedure", procedure))
+	admissionInflight.Add(ctx, 1, attrs)
+
+	return func(latency time.Duration) {
+		l.release(latency)
+
+		controller.Lock()
+		controller.inflight--
+		controller.Unlock()
+
+		admissionInflight.Add(ctx, -1, attrs)
+	}, nil
+}
+
+// reject returns the error used to shed an RPC, advising the client when to retry
+func (controller *Controller) reject(ctx context.Context, procedure string, scope string, limit int) (err error) {
+	admissionRejectedCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("rpc.procedure", procedure),
+		attribute.String("pingbuf.admission.scope", scope),
+	))
+
+	connectErr := rpcerr.AddRetryInfo(rpcerr.New(connect.CodeResourceExhausted, "CONCURRENCY_LIMIT_REACHED",
+		kv.NewError("concurrency limit reached").With("procedure", procedure, "scope", scope, "limit", limit, "stack", stack.Trace().TrimRuntime())),
+		controller.opts.RetryAfter)
+
+	// HTTP clients, and proxies, that do not decode error details still see the hint
+	retryAfter := int((controller.opts.RetryAfter + time.Second - 1) / time.Second)
+	connectErr.Meta().Set("Retry-After", strconv.Itoa(retryAfter))
+	return connectErr
+}
+
+// observe reports the current limit of every procedure that has a limit
+func (controller *Controller) observe(ctx context.Context, observer metric.Observer) (errGo error) {
+	controller.Lock()
+	defer controller.Unlock()
+
+	for procedure, l := range controller.procedures {
+		if limit := l.current(); limit != 0 {
+			observer.ObserveInt64(admissionLimitGauge, int64(limit), metric.WithAttributes(attribute.String("rpc.procedure", procedure)))
+		}
+	}
+	return nil
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (controller *Controller) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		done, err := controller.admit(ctx, req.Spec().Procedure, true)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		defer func() {
+			done(time.Since(start))
+		}()
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (controller *Controller) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs, the
+// duration of a stream is decided by the client so streams do not adapt their limits
+func (controller *Controller) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		done, err := controller.admit(ctx, conn.Spec().Procedure, false)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		defer func() {
+			done(time.Since(start))
+		}()
+		return next(ctx, conn)
+	}
+}
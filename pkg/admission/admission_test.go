@@ -0,0 +1,347 @@
+package admission
+
+// This file contains tests of the shedding of RPCs once the server, or procedure, limits have
+// been reached, of the adjustment of adaptive limits by latency, and of the reporting of the
+// limits.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+)
+
+// blockingService holds Ping RPCs until released, every other RPC returns immediately
+type blockingService struct {
+	pingv1connect.UnimplementedPingServiceHandler
+
+	enteredC chan struct{}
+	releaseC chan struct{}
+}
+
+func (svc *blockingService) Ping(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	svc.enteredC <- struct{}{}
+	<-svc.releaseC
+	return connect.NewResponse(&pingv1.PingResponse{}), nil
+}
+
+func (svc *blockingService) Set(ctx context.Context, req *connect.Request[pingv1.SetRequest]) (*connect.Response[pingv1.SetResponse], error) {
+	return connect.NewResponse(&pingv1.SetResponse{}), nil
+}
+
+// newTestController returns a controller using the options that is closed once the test completes
+func newTestController(t *testing.T, opts Opts) (controller *Controller) {
+	t.Helper()
+
+	controller, err := NewController(opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() {
+		if err := controller.Close(); err != nil {
+			t.Error(err.Error())
+		}
+	})
+	return controller
+}
+
+// newTestService serves the blocking service through an admission controller using the
+// options, returning a client for it along with the service
+func newTestService(t *testing.T, opts Opts) (client pingv1connect.PingServiceClient, svc *blockingService) {
+	t.Helper()
+
+	controller := newTestController(t, opts)
+	svc = &blockingService{
+		enteredC: make(chan struct{}),
+		releaseC: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(svc, connect.WithInterceptors(controller)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return pingv1connect.NewPingServiceClient(server.Client(), server.URL), svc
+}
+
+// blockPings starts count Ping RPCs and waits for them to be admitted, the returned channel
+// receives the result of each once the service is released
+func blockPings(t *testing.T, client pingv1connect.PingServiceClient, svc *blockingService, count int) (errC chan error) {
+	t.Helper()
+
+	errC = make(chan error, count)
+	for i := 0; i != count; i++ {
+		go func() {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			errC <- err
+		}()
+		select {
+		case <-svc.enteredC:
+		case err := <-errC:
+			t.Fatalf("expected the RPC to be admitted, %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("the RPC was not admitted")
+		}
+	}
+	return errC
+}
+
+// checkShed fails the test unless the error sheds the RPC advising a retry after the delay
+func checkShed(t *testing.T, err error, retryAfter string) {
+	t.Helper()
+
+	connectErr := &connect.Error{}
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("expected the RPC to be shed, got %v", err)
+	}
+	if connectErr.Code() != connect.CodeResourceExhausted {
+		t.Fatalf("expected %s, got %s", connect.CodeResourceExhausted, connectErr.Code())
+	}
+	if header := connectErr.Meta().Get("Retry-After"); header != retryAfter {
+		t.Fatalf("expected a Retry-After of %q, got %q", retryAfter, header)
+	}
+	for _, detail := range connectErr.Details() {
+		if value, _ := detail.Value(); value != nil {
+			if _, isRetryInfo := value.(*errdetails.RetryInfo); isRetryInfo {
+				return
+			}
+		}
+	}
+	t.Fatal("expected the error to carry retry info")
+}
+
+func TestMaxInflight(t *testing.T) {
+	client, svc := newTestService(t, Opts{MaxInflight: 2, RetryAfter: 1500 * time.Millisecond})
+
+	errC := blockPings(t, client, svc, 2)
+
+	// Once the server is full RPCs of every procedure are shed
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	checkShed(t, err, "2")
+	_, err = client.Set(context.Background(), connect.NewRequest(&pingv1.SetRequest{}))
+	checkShed(t, err, "2")
+
+	close(svc.releaseC)
+	for i := 0; i != 2; i++ {
+		if err = <-errC; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The places of completed RPCs are freed
+	if _, err = client.Set(context.Background(), connect.NewRequest(&pingv1.SetRequest{})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcedureLimit(t *testing.T) {
+	client, svc := newTestService(t, Opts{
+		Limits: []Limit{
+			{Procedure: pingv1connect.PingServicePingProcedure, Max: 1},
+			{Procedure: "/ping.v1.PingService/*", Max: 0},
+		},
+	})
+
+	errC := blockPings(t, client, svc, 1)
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	checkShed(t, err, "1")
+
+	// Other procedures have limits of their own
+	if _, err = client.Set(context.Background(), connect.NewRequest(&pingv1.SetRequest{})); err != nil {
+		t.Fatal(err)
+	}
+
+	close(svc.releaseC)
+	if err = <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected []Limit
+		isError  bool
+	}{
+		{spec: "", expected: []Limit{}},
+		{spec: "/a/B=1", expected: []Limit{{Procedure: "/a/B", Max: 1}}},
+		{spec: " /a/B=1 , /a/*=0 ,", expected: []Limit{{Procedure: "/a/B", Max: 1}, {Procedure: "/a/*", Max: 0}}},
+		{spec: "/a/B", isError: true},
+		{spec: "/a/B=-1", isError: true},
+		{spec: "/a/B=x", isError: true},
+		{spec: "/a/[=1", isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			limits, err := ParseLimits(tc.spec)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected %q to be refused, got %v", tc.spec, limits)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if len(limits) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, limits)
+			}
+			for i := range limits {
+				if limits[i] != tc.expected[i] {
+					t.Fatalf("expected %v, got %v", tc.expected, limits)
+				}
+			}
+		})
+	}
+}
+
+// complete runs count RPCs one after another through the limiter, each taking the latency
+func complete(t *testing.T, l *limiter, count int, latency time.Duration) {
+	t.Helper()
+
+	for i := 0; i != count; i++ {
+		if _, isAdmitted := l.acquire(); !isAdmitted {
+			t.Fatal("expected the RPC to be admitted")
+		}
+		l.release(latency)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	l := newLimiter(100, 20, true)
+
+	// Latency at the baseline leaves the limit at its ceiling
+	complete(t, l, 50, 10*time.Millisecond)
+	if limit := l.current(); limit != 100 {
+		t.Fatalf("expected the limit to remain at 100, got %d", limit)
+	}
+
+	// Latency well above the baseline shrinks the limit, but not below the minimum
+	previous := l.current()
+	for i := 0; i != 10; i++ {
+		complete(t, l, 1, time.Second)
+		if limit := l.current(); limit > previous {
+			t.Fatalf("expected the limit to shrink, it grew from %d to %d", previous, limit)
+		}
+		previous = l.current()
+	}
+	if previous >= 100 {
+		t.Fatalf("expected the limit to have shrunk, got %d", previous)
+	}
+	complete(t, l, 90, time.Second)
+	if limit := l.current(); limit != 20 {
+		t.Fatalf("expected the limit to shrink to the minimum of 20, got %d", limit)
+	}
+
+	// The limit grows back to its ceiling once latency recovers
+	complete(t, l, 10, 10*time.Millisecond)
+	if limit := l.current(); limit <= 20 {
+		t.Fatalf("expected the limit to grow, got %d", limit)
+	}
+	complete(t, l, 500, 10*time.Millisecond)
+	if limit := l.current(); limit != 100 {
+		t.Fatalf("expected the limit to grow back to 100, got %d", limit)
+	}
+}
+
+func TestAdaptiveLimitEnforced(t *testing.T) {
+	l := newLimiter(100, 1, true)
+	complete(t, l, 1, time.Millisecond)
+	complete(t, l, 50, time.Second)
+
+	limit := l.current()
+	if limit >= 100 {
+		t.Fatalf("expected the limit to have shrunk, got %d", limit)
+	}
+	for i := 0; i != limit; i++ {
+		if _, isAdmitted := l.acquire(); !isAdmitted {
+			t.Fatalf("expected %d RPCs to be admitted", limit)
+		}
+	}
+	if _, isAdmitted := l.acquire(); isAdmitted {
+		t.Fatalf("expected RPCs beyond the limit of %d to be shed", limit)
+	}
+}
+
+func TestStreamsDoNotAdapt(t *testing.T) {
+	controller := newTestController(t, Opts{Adaptive: true, Limits: []Limit{{Procedure: "/*/*", Max: 10}}})
+
+	unary := controller.limiter(pingv1connect.PingServicePingProcedure, true)
+	stream := controller.limiter(pingv1connect.PingServiceGenerateProcedure, false)
+	complete(t, unary, 1, time.Millisecond)
+	complete(t, stream, 1, time.Millisecond)
+	complete(t, unary, 100, time.Second)
+	complete(t, stream, 100, time.Second)
+
+	if limit := unary.current(); limit >= 10 {
+		t.Errorf("expected the unary limit to shrink, got %d", limit)
+	}
+	if limit := stream.current(); limit != 10 {
+		t.Errorf("expected the stream limit to remain at 10, got %d", limit)
+	}
+}
+
+// limitOf returns the limit reported by the gauge for the procedure, and whether it was reported
+func limitOf(t *testing.T, reader *sdkmetric.ManualReader, procedure string) (limit int64, isPresent bool) {
+	t.Helper()
+
+	rm := metricdata.ResourceMetrics{}
+	if errGo := reader.Collect(context.Background(), &rm); errGo != nil {
+		t.Fatal(errGo)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "pingbuf.admission.limit" {
+				continue
+			}
+			gauge, isGauge := m.Data.(metricdata.Gauge[int64])
+			if !isGauge {
+				t.Fatalf("metric %s is not an int64 gauge", m.Name)
+			}
+			for _, dp := range gauge.DataPoints {
+				if v, isFound := dp.Attributes.Value("rpc.procedure"); isFound && v.AsString() == procedure {
+					return dp.Value, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestLimitGauge(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	controller, err := NewController(Opts{Limits: []Limit{{Procedure: "/ping.v1.PingService/*", Max: 5}}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	controller.limiter(pingv1connect.PingServicePingProcedure, true)
+
+	if limit, isPresent := limitOf(t, reader, pingv1connect.PingServicePingProcedure); !isPresent || limit != 5 {
+		t.Fatalf("expected a limit of 5 to be reported, got %d, %t", limit, isPresent)
+	}
+
+	// Once closed the controller no longer reports its limits, and closing it again does nothing
+	for i := 0; i != 2; i++ {
+		if err := controller.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if limit, isPresent := limitOf(t, reader, pingv1connect.PingServicePingProcedure); isPresent {
+		t.Fatalf("expected no limit to be reported once the controller is closed, got %d", limit)
+	}
+}
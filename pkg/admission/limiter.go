@@ -0,0 +1,97 @@
+package admission
+
+// This file contains the concurrency limit of a single procedure.  Adaptive limits
+// follow a gradient approach, the ratio of the latency seen when the procedure
+// was lightly loaded to the latency of each completed RPC scales the limit down
+// once queuing inflates latency, while a square root allowance lets the limit grow
+// back towards its ceiling when latency recovers.
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// tolerance is how far latency may rise above the baseline before the limit is reduced
+	tolerance = 2.0
+	// smoothing is the weight given to each new limit, damping the reaction to single slow RPCs
+	smoothing = 0.2
+	// baselineDrift is the number of RPCs over which the baseline moves up to the latency
+	// being seen, allowing the baseline to follow genuine changes in the cost of a procedure
+	baselineDrift = 500
+)
+
+// limiter holds the concurrency limit, and the RPCs running, for a single procedure
+type limiter struct {
+	adaptive bool
+	min      float64
+	max      float64
+
+	// limit is zero when the procedure is unlimited
+	limit    float64
+	inflight int
+
+	// baseline is the latency of the procedure when it is not queuing
+	baseline time.Duration
+	sync.Mutex
+}
+
+// newLimiter returns the limiter of a procedure with a maximum of max RPCs running at once, zero
+// being unlimited.  Adaptive limiters start at the maximum and are never reduced below min.
+func newLimiter(max int, min int, adaptive bool) (l *limiter) {
+	if adaptive && max == 0 {
+		max = adaptiveCeiling
+	}
+	if min > max {
+		min = max
+	}
+	return &limiter{
+		adaptive: adaptive,
+		min:      float64(min),
+		max:      float64(max),
+		limit:    float64(max),
+	}
+}
+
+// acquire reserves a place for an RPC, when the limit has been reached false is returned
+// along with the limit in force
+func (l *limiter) acquire() (limit int, isAdmitted bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	limit = int(l.limit)
+	if limit != 0 && l.inflight >= limit {
+		return limit, false
+	}
+	l.inflight++
+	return limit, true
+}
+
+// release frees the place of a completed RPC, the latency of which adjusts adaptive limits
+func (l *limiter) release(latency time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.inflight--
+	if !l.adaptive || latency <= 0 {
+		return
+	}
+
+	if l.baseline == 0 || latency < l.baseline {
+		l.baseline = latency
+	} else {
+		l.baseline += (latency - l.baseline) / baselineDrift
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, tolerance*float64(l.baseline)/float64(latency)))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit*(1-smoothing)+next*smoothing))
+}
+
+// current returns the limit in force, zero when the procedure is unlimited
+func (l *limiter) current() (limit int) {
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit)
+}
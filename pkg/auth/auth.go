@@ -0,0 +1,126 @@
+package auth
+
+// This file contains a connectrpc interceptor that validates bearer tokens
+// presented by clients in the authorization header and makes the validated
+// claims available to handlers using the request context.
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+type claimsKey struct{}
+
+// Opts contains the options used to validate bearer tokens
+type Opts struct {
+	// KeysFn is the file containing the verification keys, a JWKS document, PEM encoded
+	// public keys or certificates, or a shared HMAC secret
+	KeysFn string
+	// Issuer, and Audience when set must match the iss, and aud claims of tokens
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew tolerated when checking the exp, and nbf claims
+	Leeway time.Duration
+}
+
+// Interceptor is a connectrpc interceptor that rejects requests lacking a valid bearer token
+type Interceptor struct {
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+// NewInterceptor loads the verification keys and returns an interceptor using them
+func NewInterceptor(opts Opts) (interceptor *Interceptor, err kv.Error) {
+	keys, err := LoadKeys(opts.KeysFn)
+	if err != nil {
+		return nil, err
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithLeeway(opts.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if len(opts.Issuer) != 0 {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if len(opts.Audience) != 0 {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	return &Interceptor{
+		keys:   keys,
+		parser: jwt.NewParser(parserOpts...),
+	}, nil
+}
+
+// ClaimsFromContext returns the validated claims of the bearer token presented with the request
+func ClaimsFromContext(ctx context.Context) (claims jwt.MapClaims, isPresent bool) {
+	claims, isPresent = ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims, isPresent
+}
+
+// ContextWithClaims returns a child context carrying the claims
+func ContextWithClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// authenticate validates the token in the authorization header and returns a context containing its claims
+func (interceptor *Interceptor) authenticate(ctx context.Context, authorization string) (context.Context, error) {
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || len(token) == 0 {
+		return ctx, unauthenticated("TOKEN_MISSING", kv.NewError("bearer token missing").With("stack", stack.Trace().TrimRuntime()))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, errGo := interceptor.parser.ParseWithClaims(strings.TrimSpace(token), claims, interceptor.keys.keyFunc); errGo != nil {
+		return ctx, unauthenticated("TOKEN_INVALID", kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime()))
+	}
+	return ContextWithClaims(ctx, claims), nil
+}
+
+func unauthenticated(reason string, err kv.Error) (connectErr *connect.Error) {
+	connectErr = rpcerr.New(connect.CodeUnauthenticated, reason, err)
+	connectErr.Meta().Set("WWW-Authenticate", "Bearer")
+	return connectErr
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (interceptor *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		// Outbound requests from clients sharing these interceptors are not checked
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, err := interceptor.authenticate(ctx, req.Header().Get("Authorization"))
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (interceptor *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (interceptor *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := interceptor.authenticate(ctx, conn.RequestHeader().Get("Authorization"))
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
@@ -0,0 +1,341 @@
+package auth
+
+// This file contains tests of the loading of verification keys, the validation of bearer tokens
+// signed using each supported algorithm, the resolution of the tenant of a caller, and the
+// authorization of callers using the scopes of their tokens.
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys holds a key of each supported type along with the files publishing them
+type testKeys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+
+	// rsaPEM is the PEM encoded RSA public key
+	rsaPEM []byte
+}
+
+func newTestKeys(t *testing.T) (keys *testKeys) {
+	t.Helper()
+
+	keys = &testKeys{secret: []byte("a shared secret used by the tests")}
+
+	var errGo error
+	if keys.rsa, errGo = rsa.GenerateKey(rand.Reader, 2048); errGo != nil {
+		t.Fatal(errGo)
+	}
+	if keys.ec, errGo = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); errGo != nil {
+		t.Fatal(errGo)
+	}
+	der, errGo := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	keys.rsaPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return keys
+}
+
+func segment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwks returns a JWKS document containing every key of the set, using the key IDs hs, rs, and es
+func (keys *testKeys) jwks(t *testing.T) (data []byte) {
+	t.Helper()
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	doc := map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": segment(keys.secret)},
+		{"kty": "RSA", "kid": "rs", "use": "sig", "n": segment(keys.rsa.N.Bytes()), "e": segment(big.NewInt(int64(keys.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": segment(keys.ec.X.FillBytes(x)), "y": segment(keys.ec.Y.FillBytes(y))},
+		// Encryption keys are not used to verify signatures
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": segment(keys.rsa.N.Bytes()), "e": "AQAB"},
+	}}
+	data, errGo := json.Marshal(doc)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	return data
+}
+
+func writeKeys(t *testing.T, data []byte) (fn string) {
+	t.Helper()
+
+	fn = filepath.Join(t.TempDir(), "keys")
+	if errGo := os.WriteFile(fn, data, 0o600); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return fn
+}
+
+// sign returns a token signed using the method and key, with the key ID in its header when not empty
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) (token string) {
+	t.Helper()
+
+	unsigned := jwt.NewWithClaims(method, claims)
+	if len(kid) != 0 {
+		unsigned.Header["kid"] = kid
+	}
+	token, errGo := unsigned.SignedString(key)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	return token
+}
+
+func TestLoadKeys(t *testing.T) {
+	keys := newTestKeys(t)
+
+	cases := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "shared secret", data: append(keys.secret, '\n'), want: 1},
+		{name: "PEM public keys", data: append(keys.rsaPEM, keys.rsaPEM...), want: 2},
+		{name: "JWKS", data: keys.jwks(t), want: 3},
+		{name: "JWKS without signing keys", data: []byte(`{"keys": [{"kty": "oct", "use": "enc", "k": "c2VjcmV0"}]}`), wantErr: true},
+		{name: "JWKS EC key off the curve", data: []byte(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`), wantErr: true},
+		{name: "PEM private key only", data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}), wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keySet, err := LoadKeys(writeKeys(t, tc.data))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("error %v, expected an error %v", err, tc.wantErr)
+			}
+			if err == nil && len(keySet.keys) != tc.want {
+				t.Fatalf("%d keys loaded, expected %d", len(keySet.keys), tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+
+	jwksFn := writeKeys(t, keys.jwks(t))
+	pemFn := writeKeys(t, keys.rsaPEM)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "tester", "iss": "issuer", "aud": "ping", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	with := func(name string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	cases := []struct {
+		name          string
+		keysFn        string
+		authorization string
+		wantErr       bool
+	}{
+		{name: "HS256", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", valid())},
+		{name: "RS256", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodRS256, keys.rsa, "rs", valid())},
+		{name: "ES256", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodES256, keys.ec, "es", valid())},
+		{name: "without key ID", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodES256, keys.ec, "", valid())},
+		{name: "PEM key", keysFn: pemFn, authorization: "bearer " + sign(t, jwt.SigningMethodRS256, keys.rsa, "", valid())},
+		{name: "unknown key ID", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodRS256, keys.rsa, "other", valid()), wantErr: true},
+		{name: "key ID of another key", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodRS256, keys.rsa, "es", valid()), wantErr: true},
+		{name: "encryption key", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodRS256, keys.rsa, "enc", valid()), wantErr: true},
+		{name: "alg none", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid()), wantErr: true},
+		{name: "alg not allowed", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS384, keys.secret, "hs", valid()), wantErr: true},
+		// A token signed using HMAC with the public key as the secret must not be verified using the RSA key
+		{name: "alg confusion", keysFn: pemFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.rsaPEM, "", valid()), wantErr: true},
+		{name: "wrong secret", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, []byte("another secret"), "hs", valid()), wantErr: true},
+		{name: "expired", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: true},
+		{name: "without expiry", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", with("exp", nil)), wantErr: true},
+		{name: "not yet valid", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", with("nbf", time.Now().Add(time.Hour).Unix())), wantErr: true},
+		{name: "wrong issuer", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", with("iss", "other")), wantErr: true},
+		{name: "wrong audience", keysFn: jwksFn, authorization: "Bearer " + sign(t, jwt.SigningMethodHS256, keys.secret, "hs", with("aud", "other")), wantErr: true},
+		{name: "missing", keysFn: jwksFn, authorization: "", wantErr: true},
+		{name: "basic scheme", keysFn: jwksFn, authorization: "Basic dXNlcjpwYXNz", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			interceptor, err := NewInterceptor(Opts{KeysFn: tc.keysFn, Issuer: "issuer", Audience: "ping"})
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			ctx, errGo := interceptor.authenticate(context.Background(), tc.authorization)
+			if gotErr := errGo != nil; gotErr != tc.wantErr {
+				t.Fatalf("error %v, expected an error %v", errGo, tc.wantErr)
+			}
+			if errGo != nil {
+				connectErr, isConnect := errGo.(*connect.Error)
+				if !isConnect || connectErr.Code() != connect.CodeUnauthenticated || connectErr.Meta().Get("WWW-Authenticate") != "Bearer" {
+					t.Fatalf("expected an unauthenticated error challenging for a bearer token, got %v", errGo)
+				}
+				return
+			}
+			if claims, isPresent := ClaimsFromContext(ctx); !isPresent || claims["sub"] != "tester" {
+				t.Fatalf("expected the claims of the token, got %v", claims)
+			}
+		})
+	}
+}
+
+func TestTenant(t *testing.T) {
+	spiffe, errGo := url.Parse("spiffe://example.org/ns/ping/sa/client")
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client", Organization: []string{"example"}}, URIs: []*url.URL{spiffe}}
+	spiffeID := IdentityFromCertificate(cert)
+	cert.URIs = nil
+	commonName := IdentityFromCertificate(cert)
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "unauthenticated", ctx: context.Background()},
+		{name: "claim", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"tenant": "acme"}), want: "acme"},
+		{name: "claim that is not a string", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"tenant": 7})},
+		{name: "SPIFFE ID", ctx: ContextWithIdentity(context.Background(), spiffeID), want: "spiffe://example.org/ns/ping/sa/client"},
+		{name: "common name", ctx: ContextWithIdentity(context.Background(), commonName), want: "client"},
+		{
+			name: "claim before identity",
+			ctx:  ContextWithClaims(ContextWithIdentity(context.Background(), commonName), jwt.MapClaims{"tenant": "acme"}),
+			want: "acme",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Tenant(tc.ctx, ""); got != tc.want {
+				t.Fatalf("tenant %q, expected %q", got, tc.want)
+			}
+		})
+	}
+
+	if commonName.Subject != "CN=client,O=example" {
+		t.Fatalf("subject %q, expected the distinguished name of the certificate", commonName.Subject)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}
+	identity := IdentityFromCertificate(cert)
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "unauthenticated", ctx: context.Background()},
+		{name: "claim", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"sub": "tester"}), want: "tester"},
+		{name: "claim that is not a string", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"sub": 7})},
+		{name: "tenant is not the subject", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"tenant": "acme"})},
+		{name: "identity", ctx: ContextWithIdentity(context.Background(), identity), want: "client"},
+		{
+			name: "claim before identity",
+			ctx:  ContextWithClaims(ContextWithIdentity(context.Background(), identity), jwt.MapClaims{"sub": "tester"}),
+			want: "tester",
+		},
+		{
+			name: "identity when the token has no subject",
+			ctx:  ContextWithClaims(ContextWithIdentity(context.Background(), identity), jwt.MapClaims{"tenant": "acme"}),
+			want: "client",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Subject(tc.ctx); got != tc.want {
+				t.Fatalf("subject %q, expected %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		scope  string
+		isHeld bool
+	}{
+		{name: "unauthenticated", ctx: context.Background(), scope: "ping.fault.admin"},
+		{name: "scope claim", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": "openid ping.fault.admin"}), scope: "ping.fault.admin", isHeld: true},
+		{name: "scope claim without the scope", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": "openid ping.fault"}), scope: "ping.fault.admin"},
+		{name: "scp list", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scp": []any{"openid", "ping.fault.admin"}}), scope: "ping.fault.admin", isHeld: true},
+		{name: "scp string", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scp": "ping.fault.admin"}), scope: "ping.fault.admin", isHeld: true},
+		{name: "scope that is not a string", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": 7}), scope: "ping.fault.admin"},
+		{name: "empty scope", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": ""}), scope: ""},
+		{name: "other claim", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"roles": "ping.fault.admin"}), scope: "ping.fault.admin"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if isHeld := HasScope(tc.ctx, tc.scope); isHeld != tc.isHeld {
+				t.Fatalf("expected the scope %q to be held to be %t", tc.scope, tc.isHeld)
+			}
+		})
+	}
+}
+
+func TestScopeInterceptor(t *testing.T) {
+	for _, scope := range []string{"", "ping.fault.admin openid"} {
+		if _, err := NewScopeInterceptor(scope); err == nil {
+			t.Errorf("expected the scope %q to be refused", scope)
+		}
+	}
+
+	interceptor, err := NewScopeInterceptor("ping.fault.admin")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return nil, nil
+	})
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		code connect.Code
+	}{
+		{name: "granted", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": "ping.fault.admin"})},
+		{name: "not granted", ctx: ContextWithClaims(context.Background(), jwt.MapClaims{"scope": "openid"}), code: connect.CodePermissionDenied},
+		{name: "unauthenticated", ctx: context.Background(), code: connect.CodePermissionDenied},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := unary(tc.ctx, connect.NewRequest(&struct{}{}))
+			switch {
+			case tc.code == 0 && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tc.code != 0 && connect.CodeOf(err) != tc.code:
+				t.Fatalf("expected a %s error, got %v", tc.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+// This file contains the extraction of client identities from verified mutual TLS
+// peer certificates, using either the SPIFFE ID or the subject common name.
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type identityKey struct{}
+
+// Identity is the identity of a client established using its TLS certificate
+type Identity struct {
+	// SPIFFEID is the spiffe:// URI SAN of the certificate, if present
+	SPIFFEID string
+	// CommonName is the common name of the certificate subject
+	CommonName string
+	// Subject is the full distinguished name of the certificate subject
+	Subject string
+}
+
+// String returns the SPIFFE ID of the identity when present, otherwise the common name
+func (id Identity) String() string {
+	if len(id.SPIFFEID) != 0 {
+		return id.SPIFFEID
+	}
+	return id.CommonName
+}
+
+// IdentityFromCertificate extracts the identity from a client certificate
+func IdentityFromCertificate(cert *x509.Certificate) (id Identity) {
+	id = Identity{
+		CommonName: cert.Subject.CommonName,
+		Subject:    cert.Subject.String(),
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			id.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return id
+}
+
+// IdentityFromContext returns the identity of the TLS client that made the request
+func IdentityFromContext(ctx context.Context) (id Identity, isPresent bool) {
+	id, isPresent = ctx.Value(identityKey{}).(Identity)
+	return id, isPresent
+}
+
+// ContextWithIdentity returns a child context carrying the identity
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// NewIdentityHandler returns a handler that places the identity from any verified client
+// certificate into the request context before passing the request to next
+func NewIdentityHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && len(r.TLS.VerifiedChains[0]) != 0 {
+			id := IdentityFromCertificate(r.TLS.VerifiedChains[0][0])
+			r = r.WithContext(ContextWithIdentity(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IdentityInterceptor records the identity of TLS clients on the OTel span of the
+// RPC, it must be placed after the otelconnect interceptor
+type IdentityInterceptor struct{}
+
+// NewIdentityInterceptor returns an interceptor that annotates spans with client identities
+func NewIdentityInterceptor() *IdentityInterceptor {
+	return &IdentityInterceptor{}
+}
+
+func annotateSpan(ctx context.Context) {
+	id, isPresent := IdentityFromContext(ctx)
+	if !isPresent {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("tls.client.subject", id.Subject),
+	}
+	if len(id.SPIFFEID) != 0 {
+		attrs = append(attrs, attribute.String("spiffe.id", id.SPIFFEID))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (interceptor *IdentityInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			annotateSpan(ctx)
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (interceptor *IdentityInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (interceptor *IdentityInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		annotateSpan(ctx)
+		return next(ctx, conn)
+	}
+}
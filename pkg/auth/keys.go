@@ -0,0 +1,211 @@
+package auth
+
+// This file contains the loading of the keys used to verify bearer tokens.  Keys
+// can be supplied as a JWKS document, PEM encoded public keys or certificates, or
+// as a raw shared secret for HMAC signed tokens.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// verificationKey is a single key that can be used to verify a token signature
+type verificationKey struct {
+	kid string
+	key crypto.PublicKey // []byte for HMAC secrets, *rsa.PublicKey or *ecdsa.PublicKey otherwise
+}
+
+// KeySet contains the keys accepted for verifying token signatures
+type KeySet struct {
+	keys []verificationKey
+}
+
+// jwk is the subset of RFC 7517 JSON Web Key fields needed for HS256, RS256, and ES256
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadKeys reads the verification keys from a local file, the file format is detected
+// from its contents
+func LoadKeys(fn string) (keySet *KeySet, err kv.Error) {
+	data, errGo := os.ReadFile(fn)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		keySet, err = parseJWKS(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		keySet, err = parsePEM(trimmed)
+	default:
+		keySet = &KeySet{keys: []verificationKey{{key: trimmed}}}
+	}
+	if err != nil {
+		return nil, err.With("file", fn)
+	}
+	if len(keySet.keys) == 0 {
+		return nil, kv.NewError("no usable keys found").With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	return keySet, nil
+}
+
+func parsePEM(data []byte) (keySet *KeySet, err kv.Error) {
+	keySet = &KeySet{}
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return keySet, nil
+		}
+		data = rest
+
+		var key crypto.PublicKey
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, errGo := x509.ParseCertificate(block.Bytes)
+			if errGo != nil {
+				return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+			}
+			key = cert.PublicKey
+		case "PUBLIC KEY":
+			pub, errGo := x509.ParsePKIXPublicKey(block.Bytes)
+			if errGo != nil {
+				return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+			}
+			key = pub
+		case "RSA PUBLIC KEY":
+			pub, errGo := x509.ParsePKCS1PublicKey(block.Bytes)
+			if errGo != nil {
+				return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+			}
+			key = pub
+		default:
+			continue
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keySet.keys = append(keySet.keys, verificationKey{key: key})
+		}
+	}
+}
+
+func parseJWKS(data []byte) (keySet *KeySet, err kv.Error) {
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if errGo := json.Unmarshal(data, &doc); errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+
+	keySet = &KeySet{}
+	for _, item := range doc.Keys {
+		if item.Use != "" && item.Use != "sig" {
+			continue
+		}
+		key, err := item.publicKey()
+		if err != nil {
+			return nil, err.With("kid", item.Kid)
+		}
+		if key == nil {
+			continue
+		}
+		keySet.keys = append(keySet.keys, verificationKey{kid: item.Kid, key: key})
+	}
+	return keySet, nil
+}
+
+// publicKey converts the JWK into a key usable by the jwt package, unsupported key
+// types result in a nil key being returned
+func (item *jwk) publicKey() (key crypto.PublicKey, err kv.Error) {
+	switch item.Kty {
+	case "oct":
+		return decodeSegment(item.K)
+	case "RSA":
+		n, err := decodeSegment(item.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(item.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if item.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeSegment(item.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(item.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, kv.NewError("invalid EC key").With("stack", stack.Trace().TrimRuntime())
+		}
+		return pub, nil
+	}
+	return nil, nil
+}
+
+func decodeSegment(segment string) (data []byte, err kv.Error) {
+	data, errGo := base64.RawURLEncoding.DecodeString(segment)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return data, nil
+}
+
+// keyFunc selects the key for a token using the key ID, when present, and the
+// signing method of the token
+func (keySet *KeySet) keyFunc(token *jwt.Token) (key interface{}, errGo error) {
+	kid, _ := token.Header["kid"].(string)
+
+	for _, candidate := range keySet.keys {
+		if kid != "" && candidate.kid != "" && kid != candidate.kid {
+			continue
+		}
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if secret, isOK := candidate.key.([]byte); isOK {
+				return secret, nil
+			}
+		case *jwt.SigningMethodRSA:
+			if pub, isOK := candidate.key.(*rsa.PublicKey); isOK {
+				return pub, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if pub, isOK := candidate.key.(*ecdsa.PublicKey); isOK {
+				return pub, nil
+			}
+		}
+	}
+	return nil, kv.NewError("no matching key").With("kid", kid, "alg", token.Method.Alg())
+}
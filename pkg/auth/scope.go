@@ -0,0 +1,94 @@
+package auth
+
+// This file contains the authorization of callers using the scopes granted to their
+// bearer tokens, and a connectrpc interceptor that rejects callers lacking a scope.
+
+import (
+	"context"
+	"strings"
+
+	"connectrpc.com/connect"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// HasScope is true when the validated bearer token of the caller grants the scope.  Scopes
+// are read from the space separated scope claim of RFC 8693, or from a scp claim holding
+// either a list of scopes or a space separated string.
+func HasScope(ctx context.Context, scope string) bool {
+	claims, isPresent := ClaimsFromContext(ctx)
+	if !isPresent || len(scope) == 0 {
+		return false
+	}
+	for _, claim := range []string{"scope", "scp"} {
+		switch value := claims[claim].(type) {
+		case string:
+			for _, granted := range strings.Fields(value) {
+				if granted == scope {
+					return true
+				}
+			}
+		case []any:
+			for _, granted := range value {
+				if granted == scope {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ScopeInterceptor is a connectrpc interceptor that rejects callers whose bearer token
+// does not grant a scope, it must be placed after the Interceptor validating the token
+type ScopeInterceptor struct {
+	scope string
+}
+
+// NewScopeInterceptor returns an interceptor requiring callers to have been granted the scope
+func NewScopeInterceptor(scope string) (interceptor *ScopeInterceptor, err kv.Error) {
+	if len(scope) == 0 || strings.ContainsAny(scope, " \t") {
+		return nil, kv.NewError("scope must be a single non-empty scope").With("scope", scope, "stack", stack.Trace().TrimRuntime())
+	}
+	return &ScopeInterceptor{scope: scope}, nil
+}
+
+// authorize returns a permission denied error unless the caller has been granted the scope
+func (interceptor *ScopeInterceptor) authorize(ctx context.Context, procedure string) (err error) {
+	if HasScope(ctx, interceptor.scope) {
+		return nil
+	}
+	return rpcerr.New(connect.CodePermissionDenied, "SCOPE_MISSING",
+		kv.NewError("scope not granted").With("scope", interceptor.scope, "procedure", procedure, "stack", stack.Trace().TrimRuntime()))
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (interceptor *ScopeInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := interceptor.authorize(ctx, req.Spec().Procedure); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (interceptor *ScopeInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (interceptor *ScopeInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := interceptor.authorize(ctx, conn.Spec().Procedure); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
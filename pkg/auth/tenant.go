@@ -0,0 +1,44 @@
+package auth
+
+// This file contains the resolution of the subject of an authenticated caller, and of the
+// tenant the caller belongs to.
+
+import (
+	"context"
+)
+
+// DefaultTenantClaim is the bearer token claim used for the tenant when no other claim is configured
+const DefaultTenantClaim = "tenant"
+
+// Subject returns the subject of the authenticated caller.  The sub claim of a validated
+// bearer token is used when present, falling back to the identity of a mutual TLS client.
+// An empty string is returned for callers that are not authenticated.
+func Subject(ctx context.Context) (subject string) {
+	if claims, isPresent := ClaimsFromContext(ctx); isPresent {
+		if subject, errGo := claims.GetSubject(); errGo == nil && len(subject) != 0 {
+			return subject
+		}
+	}
+	if id, isPresent := IdentityFromContext(ctx); isPresent {
+		return id.String()
+	}
+	return ""
+}
+
+// Tenant returns the tenant of the authenticated caller.  The claim of a validated
+// bearer token is used when present, falling back to the identity of a mutual TLS
+// client.  An empty string is returned for callers that are not authenticated.
+func Tenant(ctx context.Context, claim string) (tenant string) {
+	if len(claim) == 0 {
+		claim = DefaultTenantClaim
+	}
+	if claims, isPresent := ClaimsFromContext(ctx); isPresent {
+		if tenant, isOK := claims[claim].(string); isOK && len(tenant) != 0 {
+			return tenant
+		}
+	}
+	if id, isPresent := IdentityFromContext(ctx); isPresent {
+		return id.String()
+	}
+	return ""
+}
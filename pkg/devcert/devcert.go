@@ -0,0 +1,286 @@
+package devcert
+
+// This file contains the generation of the self-signed certificates used during development.
+// A private ECDSA CA is generated and written out, so that clients can be given the CA to
+// trust, and a server certificate is issued by it for the hosts the server is reached
+// using.  Both are reused on later runs, the server certificate is reissued by the same CA
+// once it nears expiry, or no longer covers every host, and the CA is only replaced once it
+// nears expiry itself.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+const (
+	// DefaultCAValidity, and DefaultValidity, are the lifetimes of generated CA, and server,
+	// certificates
+	DefaultCAValidity = 365 * 24 * time.Hour
+	DefaultValidity   = 90 * 24 * time.Hour
+	// DefaultRenewBefore is the time before expiry that certificates are replaced
+	DefaultRenewBefore = 7 * 24 * time.Hour
+)
+
+// Opts contains the files, and hosts, of the development certificates
+type Opts struct {
+	// CertFn, and KeyFn, are the server certificate and private key
+	CertFn string
+	KeyFn  string
+	// CAFn is the CA certificate given to clients, the private key of the CA is kept
+	// alongside it using the .key extension
+	CAFn string
+	// Hosts are the DNS names, and IP addresses, the server certificate is issued for
+	Hosts []string
+
+	// CAValidity, Validity, and RenewBefore default to the package defaults when zero
+	CAValidity  time.Duration
+	Validity    time.Duration
+	RenewBefore time.Duration
+}
+
+// Result describes the certificates in place once Ensure has returned
+type Result struct {
+	// IsUserManaged is set when the server certificate was not generated by this package and
+	// was left untouched
+	IsUserManaged bool
+	// IsCAGenerated, and IsIssued, are set when the CA, and the server certificate, were
+	// replaced rather than reused
+	IsCAGenerated bool
+	IsIssued      bool
+	// NotAfter is the expiry of the server certificate
+	NotAfter time.Time
+}
+
+// CAKeyFn returns the file holding the private key of the CA
+func CAKeyFn(caFn string) string {
+	return strings.TrimSuffix(caFn, filepath.Ext(caFn)) + ".key"
+}
+
+// Ensure makes certain that development certificates for the hosts are present, generating
+// any that are missing, near expiry, or no longer valid.  Existing server certificates that
+// were not generated by this package, detected by the absence of the CA key, are left alone.
+func Ensure(opts Opts) (result *Result, err kv.Error) {
+	if len(opts.Hosts) == 0 {
+		return nil, kv.NewError("at least one host is needed for a server certificate").With("stack", stack.Trace().TrimRuntime())
+	}
+	if opts.CAValidity == 0 {
+		opts.CAValidity = DefaultCAValidity
+	}
+	if opts.Validity == 0 {
+		opts.Validity = DefaultValidity
+	}
+	if opts.RenewBefore == 0 {
+		opts.RenewBefore = DefaultRenewBefore
+	}
+	caKeyFn := CAKeyFn(opts.CAFn)
+
+	result = &Result{}
+	if exists(opts.CertFn) && exists(opts.KeyFn) && !exists(caKeyFn) {
+		result.IsUserManaged = true
+		return result, nil
+	}
+
+	// A CA that will expire before a server certificate issued now is replaced
+	now := time.Now()
+	ca, caKey := loadCA(opts.CAFn, caKeyFn)
+	if ca == nil || ca.NotAfter.Before(now.Add(opts.Validity+opts.RenewBefore)) {
+		if ca, caKey, err = newCA(opts.CAFn, caKeyFn, opts.CAValidity); err != nil {
+			return nil, err
+		}
+		result.IsCAGenerated = true
+	}
+
+	if leaf := loadLeaf(opts.CertFn, opts.KeyFn); leaf != nil && isUsable(leaf, ca, opts.Hosts, now.Add(opts.RenewBefore)) {
+		result.NotAfter = leaf.NotAfter
+		return result, nil
+	}
+
+	leaf, err := issue(opts, ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+	result.IsIssued = true
+	result.NotAfter = leaf.NotAfter
+	return result, nil
+}
+
+func exists(fn string) bool {
+	_, errGo := os.Stat(fn)
+	return !errors.Is(errGo, fs.ErrNotExist)
+}
+
+// loadCA returns the CA, and its key, or nil when either cannot be loaded
+func loadCA(caFn string, caKeyFn string) (ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	pair, errGo := tls.LoadX509KeyPair(caFn, caKeyFn)
+	if errGo != nil {
+		return nil, nil
+	}
+	key, isECDSA := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !isECDSA {
+		return nil, nil
+	}
+	if ca, errGo = x509.ParseCertificate(pair.Certificate[0]); errGo != nil || !ca.IsCA {
+		return nil, nil
+	}
+	return ca, key
+}
+
+// loadLeaf returns the server certificate, or nil when it cannot be loaded along with its key
+func loadLeaf(certFn string, keyFn string) (leaf *x509.Certificate) {
+	pair, errGo := tls.LoadX509KeyPair(certFn, keyFn)
+	if errGo != nil {
+		return nil
+	}
+	if leaf, errGo = x509.ParseCertificate(pair.Certificate[0]); errGo != nil {
+		return nil
+	}
+	return leaf
+}
+
+// isUsable returns true when the server certificate was issued by the CA, remains valid
+// beyond the renewal time, and covers every host
+func isUsable(leaf *x509.Certificate, ca *x509.Certificate, hosts []string, renewAt time.Time) bool {
+	if leaf.NotAfter.Before(renewAt) || leaf.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func newSerial() (serial *big.Int, err kv.Error) {
+	serial, errGo := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return serial, nil
+}
+
+// newCA generates a CA and writes it, along with its key, to the files
+func newCA(caFn string, caKeyFn string, validity time.Duration) (ca *x509.Certificate, caKey *ecdsa.PrivateKey, err kv.Error) {
+	caKey, errGo := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errGo != nil {
+		return nil, nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"buf-ping development"}, CommonName: "buf-ping development CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, errGo := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if errGo != nil {
+		return nil, nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	if ca, errGo = x509.ParseCertificate(der); errGo != nil {
+		return nil, nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	if err = writeKey(caKeyFn, caKey); err != nil {
+		return nil, nil, err
+	}
+	if err = writePEM(caFn, "CERTIFICATE", der, 0o644); err != nil {
+		return nil, nil, err
+	}
+	return ca, caKey, nil
+}
+
+// issue generates a server certificate for the hosts using the CA and writes it, along with
+// its key, to the files
+func issue(opts Opts, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (leaf *x509.Certificate, err kv.Error) {
+	key, errGo := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(opts.Validity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"buf-ping development"}, CommonName: opts.Hosts[0]},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, errGo := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	if leaf, errGo = x509.ParseCertificate(der); errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	if err = writeKey(opts.KeyFn, key); err != nil {
+		return nil, err
+	}
+	if err = writePEM(opts.CertFn, "CERTIFICATE", der, 0o644); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+func writeKey(fn string, key *ecdsa.PrivateKey) (err kv.Error) {
+	der, errGo := x509.MarshalPKCS8PrivateKey(key)
+	if errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return writePEM(fn, "PRIVATE KEY", der, 0o600)
+}
+
+// writePEM replaces the file using a rename so that readers never see a partially written file
+func writePEM(fn string, blockType string, der []byte, perm fs.FileMode) (err kv.Error) {
+	if dir := filepath.Dir(fn); !exists(dir) {
+		if errGo := os.MkdirAll(dir, 0o700); errGo != nil {
+			return kv.Wrap(errGo).With("dir", dir, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	tmp := fn + ".tmp"
+	if errGo := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm); errGo != nil {
+		return kv.Wrap(errGo).With("file", tmp, "stack", stack.Trace().TrimRuntime())
+	}
+	if errGo := os.Rename(tmp, fn); errGo != nil {
+		os.Remove(tmp)
+		return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package devcert
+
+// This file contains tests of the generation of development certificates, covering the hosts the
+// server certificate is issued for, the permissions of the files written, the reuse of an
+// existing CA, and server certificate, and their replacement as they near expiry.
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testOpts returns options writing the certificates into a fresh directory
+func testOpts(t *testing.T, hosts ...string) (opts Opts) {
+	t.Helper()
+
+	dir := t.TempDir()
+	return Opts{
+		CertFn: filepath.Join(dir, "server.crt"),
+		KeyFn:  filepath.Join(dir, "server.key"),
+		CAFn:   filepath.Join(dir, "ca.crt"),
+		Hosts:  hosts,
+	}
+}
+
+// ensure calls Ensure, failing the test on an error
+func ensure(t *testing.T, opts Opts) (result *Result) {
+	t.Helper()
+
+	result, err := Ensure(opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return result
+}
+
+// readCert returns the certificate held in the PEM file
+func readCert(t *testing.T, fn string) (cert *x509.Certificate) {
+	t.Helper()
+
+	data, errGo := os.ReadFile(fn)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s does not contain a PEM block", fn)
+	}
+	if cert, errGo = x509.ParseCertificate(block.Bytes); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return cert
+}
+
+func TestEnsureIssue(t *testing.T) {
+	opts := testOpts(t, "localhost", "127.0.0.1", "::1", "ping.example")
+
+	result := ensure(t, opts)
+	if !result.IsCAGenerated || !result.IsIssued || result.IsUserManaged {
+		t.Fatalf("expected a CA to be generated, and a certificate issued, got %+v", result)
+	}
+
+	ca := readCert(t, opts.CAFn)
+	leaf := readCert(t, opts.CertFn)
+	if !ca.IsCA {
+		t.Fatal("expected the CA certificate to be a CA")
+	}
+	if errGo := leaf.CheckSignatureFrom(ca); errGo != nil {
+		t.Fatal(errGo)
+	}
+	if !leaf.NotAfter.Equal(result.NotAfter) {
+		t.Fatalf("expected the result to hold the expiry %s, got %s", leaf.NotAfter, result.NotAfter)
+	}
+
+	// Host names are DNS SANs, and addresses are IP SANs
+	if len(leaf.DNSNames) != 2 || leaf.DNSNames[0] != "localhost" || leaf.DNSNames[1] != "ping.example" {
+		t.Fatalf("expected the DNS names localhost, and ping.example, got %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 2 || !leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) || !leaf.IPAddresses[1].Equal(net.IPv6loopback) {
+		t.Fatalf("expected the IP addresses 127.0.0.1, and ::1, got %v", leaf.IPAddresses)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, host := range opts.Hosts {
+		if _, errGo := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); errGo != nil {
+			t.Fatalf("expected the certificate to be valid for %s, %v", host, errGo)
+		}
+	}
+
+	// Private keys are only readable by their owner
+	for _, fn := range []string{opts.KeyFn, CAKeyFn(opts.CAFn)} {
+		info, errGo := os.Stat(fn)
+		if errGo != nil {
+			t.Fatal(errGo)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("expected %s to have the permissions 0600, got %#o", fn, perm)
+		}
+	}
+}
+
+func TestEnsureReuse(t *testing.T) {
+	testCases := []struct {
+		name string
+		// first, and second, adjust the options of the first, and second, calls to Ensure
+		first         func(opts *Opts)
+		second        func(opts *Opts)
+		isCAGenerated bool
+		isIssued      bool
+	}{
+		{name: "unchanged"},
+		{
+			name:   "fewer hosts",
+			second: func(opts *Opts) { opts.Hosts = opts.Hosts[:1] },
+		},
+		{
+			name:     "host added",
+			second:   func(opts *Opts) { opts.Hosts = append(opts.Hosts, "added.example") },
+			isIssued: true,
+		},
+		{
+			name:     "certificate near expiry",
+			first:    func(opts *Opts) { opts.Validity = 2 * time.Hour },
+			isIssued: true,
+		},
+		{
+			// The CA expires before a server certificate issued by it would
+			name:          "CA near expiry",
+			first:         func(opts *Opts) { opts.CAValidity = 30 * 24 * time.Hour },
+			isCAGenerated: true,
+			isIssued:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOpts(t, "localhost", "127.0.0.1")
+			first := opts
+			if tc.first != nil {
+				tc.first(&first)
+			}
+			ensure(t, first)
+			ca := readCert(t, opts.CAFn)
+			leaf := readCert(t, opts.CertFn)
+
+			second := opts
+			if tc.second != nil {
+				tc.second(&second)
+			}
+			result := ensure(t, second)
+			if result.IsCAGenerated != tc.isCAGenerated || result.IsIssued != tc.isIssued || result.IsUserManaged {
+				t.Fatalf("expected a generated CA %t, and an issued certificate %t, got %+v", tc.isCAGenerated, tc.isIssued, result)
+			}
+
+			if isCAKept := bytes.Equal(readCert(t, opts.CAFn).Raw, ca.Raw); isCAKept == tc.isCAGenerated {
+				t.Fatalf("expected the CA to be kept to be %t", !tc.isCAGenerated)
+			}
+			reissued := readCert(t, opts.CertFn)
+			if isLeafKept := bytes.Equal(reissued.Raw, leaf.Raw); isLeafKept == tc.isIssued {
+				t.Fatalf("expected the certificate to be kept to be %t", !tc.isIssued)
+			}
+			if errGo := reissued.CheckSignatureFrom(readCert(t, opts.CAFn)); errGo != nil {
+				t.Fatal(errGo)
+			}
+			for _, host := range second.Hosts {
+				if errGo := reissued.VerifyHostname(host); errGo != nil {
+					t.Fatal(errGo)
+				}
+			}
+		})
+	}
+}
+
+// TestEnsureUserManaged checks that certificates without a CA key alongside the CA are left alone
+func TestEnsureUserManaged(t *testing.T) {
+	opts := testOpts(t, "localhost")
+	ensure(t, opts)
+	if errGo := os.Remove(CAKeyFn(opts.CAFn)); errGo != nil {
+		t.Fatal(errGo)
+	}
+	leaf := readCert(t, opts.CertFn)
+
+	// Not even a certificate missing a host is replaced
+	opts.Hosts = append(opts.Hosts, "added.example")
+	result := ensure(t, opts)
+	if !result.IsUserManaged || result.IsCAGenerated || result.IsIssued {
+		t.Fatalf("expected the certificate to be treated as user managed, got %+v", result)
+	}
+	if !bytes.Equal(readCert(t, opts.CertFn).Raw, leaf.Raw) {
+		t.Fatal("expected the certificate to be left untouched")
+	}
+}
+
+func TestEnsureNoHosts(t *testing.T) {
+	if _, err := Ensure(testOpts(t)); err == nil {
+		t.Fatal("expected a certificate without hosts to be refused")
+	}
+}
@@ -0,0 +1,55 @@
+package fault
+
+// This file contains the FaultService used to administer the rules of an Injector at runtime.
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"connectrpc.com/connect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// AdminServer implements the FaultService RPCs using connectrpc receivers
+type AdminServer struct {
+	logger   slog.Logger
+	injector *Injector
+}
+
+// NewAdminServer returns a FaultService implementation administering the injector
+func NewAdminServer(logger slog.Logger, injector *Injector) (server *AdminServer) {
+	return &AdminServer{
+		logger:   logger,
+		injector: injector,
+	}
+}
+
+// SetFaultRules replaces the rules of the injector, invalid rules are rejected leaving the existing rules in place
+func (server *AdminServer) SetFaultRules(ctx context.Context, req *connect.Request[pingv1.SetFaultRulesRequest],
+) (resp *connect.Response[pingv1.SetFaultRulesResponse], err error) {
+
+	if err := server.injector.SetRules(req.Msg.Rules); err != nil {
+		connectErr := rpcerr.New(connect.CodeInvalidArgument, "INVALID_FAULT_RULE", err)
+		field := "rules"
+		if index, isPresent := rpcerr.Field(err, "rule"); isPresent {
+			field = fmt.Sprintf("rules[%s]", index)
+			if name, isPresent := rpcerr.Field(err, "field"); isPresent {
+				field += "." + name
+			}
+		}
+		return nil, rpcerr.AddBadRequest(connectErr, field, rpcerr.Text(err))
+	}
+	server.logger.Info("fault injection rules replaced", "rules", len(req.Msg.Rules))
+	return connect.NewResponse(&pingv1.SetFaultRulesResponse{}), nil
+}
+
+// GetFaultRules returns the rules in use by the injector
+func (server *AdminServer) GetFaultRules(ctx context.Context, req *connect.Request[pingv1.GetFaultRulesRequest],
+) (resp *connect.Response[pingv1.GetFaultRulesResponse], err error) {
+
+	return connect.NewResponse(&pingv1.GetFaultRulesResponse{Rules: server.injector.Rules()}), nil
+}
@@ -0,0 +1,90 @@
+package fault
+
+// This file contains tests of the FaultService, covering the replacement of the rules in use and
+// the rejection of invalid rules with a BadRequest naming the field at fault.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+)
+
+func TestSetFaultRules(t *testing.T) {
+	valid := &pingv1.FaultRule{Name: "valid", ErrorPercent: 10, ErrorCode: int32(connect.CodeUnavailable)}
+
+	testCases := []struct {
+		name  string
+		rules []*pingv1.FaultRule
+		// field is the field named by the BadRequest of a refused request
+		field string
+	}{
+		{name: "valid", rules: []*pingv1.FaultRule{valid, {Name: "other", Procedure: "/ping.v1.PingService/*"}}},
+		{name: "no rules"},
+		{name: "error percent", rules: []*pingv1.FaultRule{valid, {Name: "bad", ErrorPercent: 110, ErrorCode: 14}}, field: "rules[1].error_percent"},
+		{name: "error code", rules: []*pingv1.FaultRule{{Name: "bad", ErrorPercent: 10}}, field: "rules[0].error_code"},
+		{name: "header name", rules: []*pingv1.FaultRule{{Name: "bad", Headers: []*pingv1.FaultHeader{{Value: "on"}}}}, field: "rules[0].headers[0].name"},
+		{name: "procedure", rules: []*pingv1.FaultRule{valid, valid, {Name: "bad", Procedure: "["}}, field: "rules[2].procedure"},
+		{name: "missing rule", rules: []*pingv1.FaultRule{valid, nil}, field: "rules[1]"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			injector := newTestInjector(t, valid)
+			server := NewAdminServer(*slog.New(slog.NewTextHandler(io.Discard, nil)), injector)
+
+			_, err := server.SetFaultRules(context.Background(), connect.NewRequest(&pingv1.SetFaultRulesRequest{Rules: tc.rules}))
+			if len(tc.field) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := server.GetFaultRules(context.Background(), connect.NewRequest(&pingv1.GetFaultRulesRequest{}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Msg.Rules) != len(tc.rules) {
+					t.Fatalf("expected %d rules, got %d", len(tc.rules), len(resp.Msg.Rules))
+				}
+				return
+			}
+
+			if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+				t.Fatalf("expected a %s error, got %v", connect.CodeInvalidArgument, err)
+			}
+			if reason := reasonOf(t, err); reason != "INVALID_FAULT_RULE" {
+				t.Fatalf("expected the reason INVALID_FAULT_RULE, got %q", reason)
+			}
+			connectErr := &connect.Error{}
+			if !errors.As(err, &connectErr) {
+				t.Fatalf("expected a connect error, got %v", err)
+			}
+			fields := []string{}
+			for _, detail := range connectErr.Details() {
+				value, errGo := detail.Value()
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				if badRequest, isBadRequest := value.(*errdetails.BadRequest); isBadRequest {
+					for _, violation := range badRequest.GetFieldViolations() {
+						fields = append(fields, violation.GetField())
+					}
+				}
+			}
+			if len(fields) != 1 || fields[0] != tc.field {
+				t.Fatalf("expected a BadRequest naming %s, got %v", tc.field, fields)
+			}
+
+			// Invalid rules leave the existing rules in place
+			if rules := injector.Rules(); len(rules) != 1 || rules[0].Name != valid.Name {
+				t.Fatalf("expected the existing rules to be kept, got %v", rules)
+			}
+		})
+	}
+}
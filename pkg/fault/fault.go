@@ -0,0 +1,233 @@
+package fault
+
+// This file contains a connectrpc interceptor that injects faults into RPCs
+// handled by the server.  It is used to exercise the retry, deadline, and
+// circuit breaker logic of clients.  RPCs are matched against an ordered list of
+// rules that can be replaced at runtime, the first matching rule supplies the
+// latency, errors, mid-stream aborts, and stream resets injected into the RPC.
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+var (
+	faultMeter           = otel.GetMeterProvider().Meter("bufping/fault")
+	faultInjectedCounter metric.Int64Counter
+)
+
+func init() {
+	faultInjectedCounter, _ = faultMeter.Int64Counter(
+		"pingbuf.fault.injected.counter",
+		metric.WithDescription("Number of faults injected into RPCs."),
+		metric.WithUnit("{fault}"),
+	)
+}
+
+// Opts contains the options used when creating an Injector
+type Opts struct {
+	// RulesFn is an optional JSON file containing a SetFaultRulesRequest with the initial rules
+	RulesFn string
+	// TenantClaim is the bearer token claim used to match the tenant of rules, default auth.DefaultTenantClaim
+	TenantClaim string
+}
+
+// Injector is a connectrpc interceptor that applies the fault injection rules to RPCs
+type Injector struct {
+	tenantClaim string
+
+	rules []*rule
+	sync.RWMutex
+}
+
+// NewInjector returns an injector using the rules in the rules file, when no file is
+// supplied the injector starts without any rules
+func NewInjector(opts Opts) (injector *Injector, err kv.Error) {
+	injector = &Injector{
+		tenantClaim: opts.TenantClaim,
+	}
+	if len(opts.RulesFn) == 0 {
+		return injector, nil
+	}
+
+	data, errGo := os.ReadFile(opts.RulesFn)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", opts.RulesFn, "stack", stack.Trace().TrimRuntime())
+	}
+	req := &pingv1.SetFaultRulesRequest{}
+	if errGo = protojson.Unmarshal(data, req); errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", opts.RulesFn, "stack", stack.Trace().TrimRuntime())
+	}
+	if err = injector.SetRules(req.Rules); err != nil {
+		return nil, err.With("file", opts.RulesFn)
+	}
+	return injector, nil
+}
+
+// SetRules validates and then replaces the rules of the injector
+func (injector *Injector) SetRules(specs []*pingv1.FaultRule) (err kv.Error) {
+	rules := make([]*rule, 0, len(specs))
+	for i, spec := range specs {
+		r, err := newRule(spec)
+		if err != nil {
+			return err.With("rule", i)
+		}
+		rules = append(rules, r)
+	}
+
+	injector.Lock()
+	defer injector.Unlock()
+	injector.rules = rules
+	return nil
+}
+
+// Rules returns a copy of the rules used by the injector
+func (injector *Injector) Rules() (specs []*pingv1.FaultRule) {
+	injector.RLock()
+	defer injector.RUnlock()
+
+	specs = make([]*pingv1.FaultRule, 0, len(injector.rules))
+	for _, r := range injector.rules {
+		specs = append(specs, proto.Clone(r.spec).(*pingv1.FaultRule))
+	}
+	return specs
+}
+
+// match returns the first rule matching the RPC, or nil
+func (injector *Injector) match(ctx context.Context, procedure string, header http.Header) (r *rule) {
+	injector.RLock()
+	defer injector.RUnlock()
+
+	if len(injector.rules) == 0 {
+		return nil
+	}
+	tenant := auth.Tenant(ctx, injector.tenantClaim)
+	for _, r := range injector.rules {
+		if r.matches(procedure, header, tenant) {
+			return r
+		}
+	}
+	return nil
+}
+
+// inject applies the faults of a rule that occur before the RPC is handled, an error is
+// returned when the RPC is to fail rather than be handled
+func (injector *Injector) inject(ctx context.Context, r *rule, procedure string) (err error) {
+	if delay := r.delay(); delay > 0 {
+		record(ctx, r, procedure, "latency")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return connect.NewError(connect.CodeDeadlineExceeded, ctx.Err())
+		}
+	}
+
+	if r.spec.ResetPercent > 0 && rand.Float64()*100 < r.spec.ResetPercent {
+		record(ctx, r, procedure, "reset")
+		// The HTTP server recovers this panic silently and resets the stream, or for
+		// HTTP/1.1 closes the connection, without a response being sent
+		panic(http.ErrAbortHandler)
+	}
+
+	if r.spec.ErrorCode != 0 && r.spec.ErrorPercent > 0 && rand.Float64()*100 < r.spec.ErrorPercent {
+		record(ctx, r, procedure, "error")
+		return rpcerr.New(connect.Code(r.spec.ErrorCode), "FAULT_INJECTED",
+			kv.NewError("injected fault").With("rule", r.spec.Name, "procedure", procedure, "stack", stack.Trace().TrimRuntime()))
+	}
+	return nil
+}
+
+// record counts an injected fault and adds it as an event to the span of the RPC
+func record(ctx context.Context, r *rule, procedure string, kind string) {
+	attrs := []attribute.KeyValue{
+		attribute.String("pingbuf.fault.rule", r.spec.Name),
+		attribute.String("pingbuf.fault.kind", kind),
+	}
+	faultInjectedCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
+	trace.SpanFromContext(ctx).AddEvent("fault injected", trace.WithAttributes(append(attrs, attribute.String("rpc.procedure", procedure))...))
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (injector *Injector) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		procedure := req.Spec().Procedure
+		if r := injector.match(ctx, procedure, req.Header()); r != nil {
+			if err := injector.inject(ctx, r, procedure); err != nil {
+				return nil, err
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (injector *Injector) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (injector *Injector) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		procedure := conn.Spec().Procedure
+		r := injector.match(ctx, procedure, conn.RequestHeader())
+		if r == nil {
+			return next(ctx, conn)
+		}
+		if err := injector.inject(ctx, r, procedure); err != nil {
+			return err
+		}
+		if r.spec.AbortAfter != 0 && conn.Spec().StreamType&connect.StreamTypeServer != 0 {
+			conn = &abortingConn{StreamingHandlerConn: conn, ctx: ctx, rule: r, remaining: r.spec.AbortAfter}
+		}
+		return next(ctx, conn)
+	}
+}
+
+// abortingConn fails the sending of messages once the abort_after limit of its rule has
+// been reached, handlers return the error which then ends the RPC
+type abortingConn struct {
+	connect.StreamingHandlerConn
+	ctx       context.Context
+	rule      *rule
+	remaining uint32
+}
+
+// Send implements the connect.StreamingHandlerConn interface
+func (conn *abortingConn) Send(msg any) error {
+	if conn.remaining == 0 {
+		procedure := conn.Spec().Procedure
+		record(conn.ctx, conn.rule, procedure, "abort")
+		code := connect.Code(conn.rule.spec.AbortCode)
+		if code == 0 {
+			code = connect.CodeAborted
+		}
+		return rpcerr.New(code, "STREAM_ABORTED",
+			kv.NewError("injected stream abort").With("rule", conn.rule.spec.Name, "procedure", procedure, "stack", stack.Trace().TrimRuntime()))
+	}
+	conn.remaining--
+	return conn.StreamingHandlerConn.Send(msg)
+}
@@ -0,0 +1,323 @@
+package fault
+
+// This file contains tests of the injection of faults into RPCs, covering the selection of the
+// rule applied to an RPC, injected latency, errors, stream aborts, and stream resets.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+)
+
+// newTestInjector returns an injector using the rules
+func newTestInjector(t *testing.T, rules ...*pingv1.FaultRule) (injector *Injector) {
+	t.Helper()
+
+	injector, err := NewInjector(Opts{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = injector.SetRules(rules); err != nil {
+		t.Fatal(err.Error())
+	}
+	return injector
+}
+
+// reasonOf returns the reason of the ErrorInfo detail carried by the error
+func reasonOf(t *testing.T, err error) (reason string) {
+	t.Helper()
+
+	connectErr := &connect.Error{}
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("expected a connect error, got %v", err)
+	}
+	for _, detail := range connectErr.Details() {
+		value, errGo := detail.Value()
+		if errGo != nil {
+			t.Fatal(errGo)
+		}
+		if info, isInfo := value.(*errdetails.ErrorInfo); isInfo {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+func TestMatch(t *testing.T) {
+	injector := newTestInjector(t,
+		&pingv1.FaultRule{Name: "tenant", Procedure: "/ping.v1.PingService/Ping", Tenant: "acme"},
+		&pingv1.FaultRule{Name: "header", Procedure: "/ping.v1.PingService/*", Headers: []*pingv1.FaultHeader{{Name: "X-Fault", Value: "on"}}},
+		&pingv1.FaultRule{Name: "watch", Procedure: "/ping.v1.PingService/Watch"},
+	)
+
+	acme := auth.ContextWithClaims(context.Background(), jwt.MapClaims{"tenant": "acme"})
+	testCases := []struct {
+		name      string
+		ctx       context.Context
+		procedure string
+		header    http.Header
+		rule      string
+	}{
+		{name: "tenant", ctx: acme, procedure: "/ping.v1.PingService/Ping", rule: "tenant"},
+		{name: "tenant before header", ctx: acme, procedure: "/ping.v1.PingService/Ping", header: http.Header{"X-Fault": []string{"on"}}, rule: "tenant"},
+		{name: "header", ctx: context.Background(), procedure: "/ping.v1.PingService/Ping", header: http.Header{"X-Fault": []string{"on"}}, rule: "header"},
+		{name: "header before procedure", ctx: acme, procedure: "/ping.v1.PingService/Watch", header: http.Header{"X-Fault": []string{"on"}}, rule: "header"},
+		{name: "procedure", ctx: context.Background(), procedure: "/ping.v1.PingService/Watch", rule: "watch"},
+		{name: "no match", ctx: context.Background(), procedure: "/ping.v1.PingService/Ping"},
+		{name: "other service", ctx: acme, procedure: "/ping.v1.FaultService/GetFaultRules", header: http.Header{"X-Fault": []string{"on"}}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			header := tc.header
+			if header == nil {
+				header = http.Header{}
+			}
+			r := injector.match(tc.ctx, tc.procedure, header)
+			switch {
+			case len(tc.rule) == 0 && r != nil:
+				t.Fatalf("expected no rule to match, %s matched", r.spec.Name)
+			case len(tc.rule) != 0 && r == nil:
+				t.Fatalf("expected %s to match", tc.rule)
+			case len(tc.rule) != 0 && r.spec.Name != tc.rule:
+				t.Fatalf("expected %s to match, %s matched", tc.rule, r.spec.Name)
+			}
+		})
+	}
+}
+
+// testUnary calls the unary handler wrapped by the injector, returning true when the request
+// reached the handler
+func testUnary(ctx context.Context, injector *Injector) (isHandled bool, err error) {
+	unary := injector.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		isHandled = true
+		return connect.NewResponse(&pingv1.PingResponse{}), nil
+	})
+	_, err = unary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	return isHandled, err
+}
+
+func TestErrorPercent(t *testing.T) {
+	const rpcs = 2000
+
+	testCases := []struct {
+		name    string
+		percent float64
+		min     int
+		max     int
+	}{
+		{name: "none", percent: 0, min: 0, max: 0},
+		{name: "half", percent: 50, min: rpcs * 45 / 100, max: rpcs * 55 / 100},
+		{name: "every", percent: 100, min: rpcs, max: rpcs},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			injector := newTestInjector(t, &pingv1.FaultRule{Name: tc.name, ErrorPercent: tc.percent, ErrorCode: int32(connect.CodeUnavailable)})
+
+			failed := 0
+			for i := 0; i != rpcs; i++ {
+				isHandled, err := testUnary(context.Background(), injector)
+				if err == nil {
+					if !isHandled {
+						t.Fatal("expected an RPC that was not failed to be handled")
+					}
+					continue
+				}
+				if isHandled {
+					t.Fatal("expected a failed RPC not to be handled")
+				}
+				if code := connect.CodeOf(err); code != connect.CodeUnavailable {
+					t.Fatalf("expected a %s error, got %v", connect.CodeUnavailable, err)
+				}
+				if reason := reasonOf(t, err); reason != "FAULT_INJECTED" {
+					t.Fatalf("expected the reason FAULT_INJECTED, got %q", reason)
+				}
+				failed++
+			}
+			if failed < tc.min || failed > tc.max {
+				t.Fatalf("expected between %d and %d of %d RPCs to fail, %d failed", tc.min, tc.max, rpcs, failed)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	injector := newTestInjector(t, &pingv1.FaultRule{
+		Name:    "latency",
+		Latency: &pingv1.FaultLatency{Base: durationpb.New(50 * time.Millisecond)},
+	})
+
+	started := time.Now()
+	if _, err := testUnary(context.Background(), injector); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the RPC to be delayed by 50ms, it took %s", elapsed)
+	}
+
+	// The delay is cut short by the deadline of the RPC
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	isHandled, err := testUnary(ctx, injector)
+	if code := connect.CodeOf(err); code != connect.CodeDeadlineExceeded || isHandled {
+		t.Fatalf("expected the RPC to fail with %s before being handled, got %v", connect.CodeDeadlineExceeded, err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	testCases := []struct {
+		name    string
+		percent float64
+		isReset bool
+	}{
+		{name: "none", percent: 0},
+		{name: "every", percent: 100, isReset: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			injector := newTestInjector(t, &pingv1.FaultRule{Name: tc.name, ResetPercent: tc.percent})
+
+			// The HTTP server recovers the panic and resets the stream
+			var recovered any
+			isHandled := false
+			func() {
+				defer func() {
+					recovered = recover()
+				}()
+				isHandled, _ = testUnary(context.Background(), injector)
+			}()
+			switch {
+			case tc.isReset && recovered != http.ErrAbortHandler:
+				t.Fatalf("expected the RPC to be reset, recovered %v", recovered)
+			case tc.isReset && isHandled:
+				t.Fatal("expected a reset RPC not to be handled")
+			case !tc.isReset && (recovered != nil || !isHandled):
+				t.Fatalf("expected the RPC to be handled, recovered %v", recovered)
+			}
+		})
+	}
+}
+
+// testStreamConn is the connection of a server streaming RPC that counts the messages sent
+type testStreamConn struct {
+	connect.StreamingHandlerConn
+	sent int
+}
+
+func (conn *testStreamConn) Spec() connect.Spec {
+	return connect.Spec{Procedure: "/ping.v1.PingService/Generate", StreamType: connect.StreamTypeServer}
+}
+func (conn *testStreamConn) RequestHeader() http.Header { return http.Header{} }
+func (conn *testStreamConn) Send(any) error {
+	conn.sent++
+	return nil
+}
+
+func TestAbortAfter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		abortAfter uint32
+		abortCode  connect.Code
+		sent       int
+		code       connect.Code
+	}{
+		{name: "not aborted", sent: 5},
+		{name: "after the first message", abortAfter: 1, sent: 1, code: connect.CodeAborted},
+		{name: "after several messages", abortAfter: 3, sent: 3, code: connect.CodeAborted},
+		{name: "after every message", abortAfter: 5, sent: 5},
+		{name: "abort code", abortAfter: 2, abortCode: connect.CodeUnavailable, sent: 2, code: connect.CodeUnavailable},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			injector := newTestInjector(t, &pingv1.FaultRule{Name: tc.name, AbortAfter: tc.abortAfter, AbortCode: int32(tc.abortCode)})
+
+			// The handler sends 5 messages, returning the first error as handlers do
+			handler := injector.WrapStreamingHandler(func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+				for i := 0; i != 5; i++ {
+					if err := conn.Send(&pingv1.GenerateResponse{}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			conn := &testStreamConn{}
+			err := handler(context.Background(), conn)
+
+			if conn.sent != tc.sent {
+				t.Fatalf("expected %d messages to be sent, %d were sent", tc.sent, conn.sent)
+			}
+			switch {
+			case tc.code == 0 && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tc.code == 0:
+				return
+			case connect.CodeOf(err) != tc.code:
+				t.Fatalf("expected a %s error, got %v", tc.code, err)
+			}
+			if reason := reasonOf(t, err); reason != "STREAM_ABORTED" {
+				t.Fatalf("expected the reason STREAM_ABORTED, got %q", reason)
+			}
+		})
+	}
+}
+
+func TestNewInjector(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name     string
+		contents string
+		rules    int
+		isError  bool
+	}{
+		{name: "rules", contents: `{"rules": [{"name": "a", "errorPercent": 10, "errorCode": 14}, {"name": "b", "procedure": "/ping.v1.PingService/*"}]}`, rules: 2},
+		{name: "no rules", contents: `{}`},
+		{name: "invalid rule", contents: `{"rules": [{"name": "a", "errorPercent": 110, "errorCode": 14}]}`, isError: true},
+		{name: "not JSON", contents: `rules: []`, isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fn := filepath.Join(dir, tc.name+".json")
+			if errGo := os.WriteFile(fn, []byte(tc.contents), 0o600); errGo != nil {
+				t.Fatal(errGo)
+			}
+			injector, err := NewInjector(Opts{RulesFn: fn})
+			switch {
+			case tc.isError && err == nil:
+				t.Fatal("expected the rules to be refused")
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if rules := injector.Rules(); len(rules) != tc.rules {
+				t.Fatalf("expected %d rules, got %d", tc.rules, len(rules))
+			}
+		})
+	}
+
+	if _, err := NewInjector(Opts{RulesFn: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Fatal("expected a missing rules file to be refused")
+	}
+}
@@ -0,0 +1,118 @@
+package fault
+
+// This file contains the matching of RPCs against fault injection rules and the
+// sampling of the latency they inject.
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+)
+
+// rule is a validated fault injection rule
+type rule struct {
+	spec *pingv1.FaultRule
+
+	base   time.Duration
+	spread time.Duration
+}
+
+// newRule validates the specification of a rule
+func newRule(spec *pingv1.FaultRule) (r *rule, err kv.Error) {
+	if spec == nil {
+		return nil, kv.NewError("rule missing").With("stack", stack.Trace().TrimRuntime())
+	}
+	if _, errGo := path.Match(spec.Procedure, ""); errGo != nil {
+		return nil, kv.Wrap(errGo).With("field", "procedure", "value", spec.Procedure, "stack", stack.Trace().TrimRuntime())
+	}
+	for i, header := range spec.Headers {
+		if len(header.GetName()) == 0 {
+			return nil, kv.NewError("header name missing").With("name", spec.Name, "field", fmt.Sprintf("headers[%d].name", i), "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	if spec.ErrorPercent < 0 || spec.ErrorPercent > 100 {
+		return nil, kv.NewError("error_percent must be between 0 and 100").With("name", spec.Name, "field", "error_percent", "value", spec.ErrorPercent, "stack", stack.Trace().TrimRuntime())
+	}
+	if spec.ResetPercent < 0 || spec.ResetPercent > 100 {
+		return nil, kv.NewError("reset_percent must be between 0 and 100").With("name", spec.Name, "field", "reset_percent", "value", spec.ResetPercent, "stack", stack.Trace().TrimRuntime())
+	}
+	if spec.ErrorPercent > 0 && !validCode(spec.ErrorCode) {
+		return nil, kv.NewError("error_code must be a valid code other than ok").With("name", spec.Name, "field", "error_code", "code", spec.ErrorCode, "stack", stack.Trace().TrimRuntime())
+	}
+	if spec.AbortCode != 0 && !validCode(spec.AbortCode) {
+		return nil, kv.NewError("abort_code must be a valid code other than ok").With("name", spec.Name, "field", "abort_code", "code", spec.AbortCode, "stack", stack.Trace().TrimRuntime())
+	}
+
+	// The rule keeps its own copy so that the caller cannot change it while it is in use
+	r = &rule{spec: proto.Clone(spec).(*pingv1.FaultRule)}
+	if latency := spec.Latency; latency != nil {
+		if errGo := latency.Base.CheckValid(); latency.Base != nil && errGo != nil {
+			return nil, kv.Wrap(errGo).With("name", spec.Name, "field", "latency.base", "stack", stack.Trace().TrimRuntime())
+		}
+		if errGo := latency.Spread.CheckValid(); latency.Spread != nil && errGo != nil {
+			return nil, kv.Wrap(errGo).With("name", spec.Name, "field", "latency.spread", "stack", stack.Trace().TrimRuntime())
+		}
+		r.base = latency.Base.AsDuration()
+		r.spread = latency.Spread.AsDuration()
+		if r.base < 0 || r.spread < 0 {
+			return nil, kv.NewError("latency durations must not be negative").With("name", spec.Name, "field", "latency", "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	return r, nil
+}
+
+func validCode(code int32) bool {
+	return code >= int32(connect.CodeCanceled) && code <= int32(connect.CodeUnauthenticated)
+}
+
+// matches is true when the procedure, headers, and tenant of an RPC satisfy the rule
+func (r *rule) matches(procedure string, header http.Header, tenant string) bool {
+	if len(r.spec.Procedure) != 0 {
+		if isMatch, _ := path.Match(r.spec.Procedure, procedure); !isMatch {
+			return false
+		}
+	}
+	for _, h := range r.spec.Headers {
+		if header.Get(h.Name) != h.Value {
+			return false
+		}
+	}
+	if len(r.spec.Tenant) != 0 && r.spec.Tenant != tenant {
+		return false
+	}
+	return true
+}
+
+// delay samples the latency distribution of the rule, negative samples are treated as zero
+func (r *rule) delay() (delay time.Duration) {
+	if r.spec.Latency == nil {
+		return 0
+	}
+	switch r.spec.Latency.Distribution {
+	case pingv1.FaultLatency_DISTRIBUTION_UNIFORM:
+		delay = r.base
+		if r.spread > 0 {
+			delay += time.Duration(rand.Int63n(int64(r.spread) + 1))
+		}
+	case pingv1.FaultLatency_DISTRIBUTION_NORMAL:
+		delay = r.base + time.Duration(rand.NormFloat64()*float64(r.spread))
+	case pingv1.FaultLatency_DISTRIBUTION_EXPONENTIAL:
+		delay = time.Duration(rand.ExpFloat64() * float64(r.base))
+	default:
+		delay = r.base
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
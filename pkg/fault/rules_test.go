@@ -0,0 +1,243 @@
+package fault
+
+// This file contains tests of the validation of fault injection rules, the matching of RPCs
+// against them, and the sampling of their latency distributions.
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+)
+
+func TestNewRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		spec    *pingv1.FaultRule
+		isError bool
+	}{
+		{name: "empty", spec: &pingv1.FaultRule{}},
+		{name: "missing", spec: nil, isError: true},
+		{name: "procedure glob", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/*"}},
+		{name: "invalid procedure glob", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/["}, isError: true},
+		{name: "header", spec: &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Name: "X-Fault", Value: "on"}}}},
+		{name: "header without a name", spec: &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Value: "on"}}}, isError: true},
+		{name: "errors", spec: &pingv1.FaultRule{ErrorPercent: 100, ErrorCode: 14}},
+		{name: "error percent above 100", spec: &pingv1.FaultRule{ErrorPercent: 101, ErrorCode: 14}, isError: true},
+		{name: "negative error percent", spec: &pingv1.FaultRule{ErrorPercent: -1, ErrorCode: 14}, isError: true},
+		{name: "errors without a code", spec: &pingv1.FaultRule{ErrorPercent: 50}, isError: true},
+		{name: "error code beyond the codes", spec: &pingv1.FaultRule{ErrorPercent: 50, ErrorCode: 17}, isError: true},
+		{name: "reset percent above 100", spec: &pingv1.FaultRule{ResetPercent: 100.5}, isError: true},
+		{name: "abort code", spec: &pingv1.FaultRule{AbortAfter: 2, AbortCode: 10}},
+		{name: "invalid abort code", spec: &pingv1.FaultRule{AbortAfter: 2, AbortCode: -1}, isError: true},
+		{
+			name: "latency",
+			spec: &pingv1.FaultRule{Latency: &pingv1.FaultLatency{Base: durationpb.New(time.Millisecond), Spread: durationpb.New(time.Millisecond)}},
+		},
+		{
+			name:    "negative latency",
+			spec:    &pingv1.FaultRule{Latency: &pingv1.FaultLatency{Base: durationpb.New(-time.Millisecond)}},
+			isError: true,
+		},
+		{
+			name:    "invalid latency",
+			spec:    &pingv1.FaultRule{Latency: &pingv1.FaultLatency{Spread: &durationpb.Duration{Seconds: 1, Nanos: -1}}},
+			isError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newRule(tc.spec)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatal("expected the rule to be refused")
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	testCases := []struct {
+		name      string
+		spec      *pingv1.FaultRule
+		procedure string
+		header    http.Header
+		tenant    string
+		isMatch   bool
+	}{
+		{name: "every RPC", spec: &pingv1.FaultRule{}, procedure: "/ping.v1.PingService/Ping", isMatch: true},
+		{name: "exact procedure", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/Ping"}, procedure: "/ping.v1.PingService/Ping", isMatch: true},
+		{name: "other procedure", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/Ping"}, procedure: "/ping.v1.PingService/Sum"},
+		{name: "service glob", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/*"}, procedure: "/ping.v1.PingService/Watch", isMatch: true},
+		{name: "glob of another service", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/*"}, procedure: "/ping.v1.FaultService/GetFaultRules"},
+		{name: "method glob", spec: &pingv1.FaultRule{Procedure: "/ping.v1.PingService/[GW]*"}, procedure: "/ping.v1.PingService/Generate", isMatch: true},
+		{
+			name:      "header",
+			spec:      &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Name: "X-Fault", Value: "on"}}},
+			procedure: "/ping.v1.PingService/Ping",
+			header:    http.Header{"X-Fault": []string{"on"}},
+			isMatch:   true,
+		},
+		{
+			name:      "header name in another case",
+			spec:      &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Name: "x-fault", Value: "on"}}},
+			procedure: "/ping.v1.PingService/Ping",
+			header:    http.Header{"X-Fault": []string{"on"}},
+			isMatch:   true,
+		},
+		{
+			name:      "header value differs",
+			spec:      &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Name: "X-Fault", Value: "on"}}},
+			procedure: "/ping.v1.PingService/Ping",
+			header:    http.Header{"X-Fault": []string{"off"}},
+		},
+		{
+			name:      "header missing",
+			spec:      &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{{Name: "X-Fault", Value: "on"}}},
+			procedure: "/ping.v1.PingService/Ping",
+			header:    http.Header{},
+		},
+		{
+			name: "one of several headers missing",
+			spec: &pingv1.FaultRule{Headers: []*pingv1.FaultHeader{
+				{Name: "X-Fault", Value: "on"},
+				{Name: "X-Region", Value: "west"},
+			}},
+			procedure: "/ping.v1.PingService/Ping",
+			header:    http.Header{"X-Fault": []string{"on"}},
+		},
+		{name: "tenant", spec: &pingv1.FaultRule{Tenant: "acme"}, procedure: "/ping.v1.PingService/Ping", tenant: "acme", isMatch: true},
+		{name: "other tenant", spec: &pingv1.FaultRule{Tenant: "acme"}, procedure: "/ping.v1.PingService/Ping", tenant: "globex"},
+		{name: "no tenant", spec: &pingv1.FaultRule{Tenant: "acme"}, procedure: "/ping.v1.PingService/Ping"},
+		{name: "any tenant", spec: &pingv1.FaultRule{}, procedure: "/ping.v1.PingService/Ping", tenant: "globex", isMatch: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRule(tc.spec)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			header := tc.header
+			if header == nil {
+				header = http.Header{}
+			}
+			if isMatch := r.matches(tc.procedure, header, tc.tenant); isMatch != tc.isMatch {
+				t.Fatalf("expected the rule to match to be %t", tc.isMatch)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	const samples = 2000
+
+	testCases := []struct {
+		name       string
+		latency    *pingv1.FaultLatency
+		min        time.Duration
+		max        time.Duration
+		meanMin    time.Duration
+		meanMax    time.Duration
+		isConstant bool
+	}{
+		{name: "no latency", min: 0, max: 0, isConstant: true},
+		{
+			name:       "unspecified is fixed",
+			latency:    &pingv1.FaultLatency{Base: durationpb.New(10 * time.Millisecond), Spread: durationpb.New(time.Second)},
+			min:        10 * time.Millisecond,
+			max:        10 * time.Millisecond,
+			isConstant: true,
+		},
+		{
+			name: "fixed",
+			latency: &pingv1.FaultLatency{
+				Distribution: pingv1.FaultLatency_DISTRIBUTION_FIXED,
+				Base:         durationpb.New(10 * time.Millisecond),
+			},
+			min:        10 * time.Millisecond,
+			max:        10 * time.Millisecond,
+			isConstant: true,
+		},
+		{
+			name: "uniform",
+			latency: &pingv1.FaultLatency{
+				Distribution: pingv1.FaultLatency_DISTRIBUTION_UNIFORM,
+				Base:         durationpb.New(10 * time.Millisecond),
+				Spread:       durationpb.New(10 * time.Millisecond),
+			},
+			min:     10 * time.Millisecond,
+			max:     20 * time.Millisecond,
+			meanMin: 14 * time.Millisecond,
+			meanMax: 16 * time.Millisecond,
+		},
+		{
+			name: "normal",
+			latency: &pingv1.FaultLatency{
+				Distribution: pingv1.FaultLatency_DISTRIBUTION_NORMAL,
+				Base:         durationpb.New(100 * time.Millisecond),
+				Spread:       durationpb.New(10 * time.Millisecond),
+			},
+			min:     0,
+			max:     time.Second,
+			meanMin: 98 * time.Millisecond,
+			meanMax: 102 * time.Millisecond,
+		},
+		{
+			// Samples below zero are treated as no delay
+			name: "normal about zero",
+			latency: &pingv1.FaultLatency{
+				Distribution: pingv1.FaultLatency_DISTRIBUTION_NORMAL,
+				Spread:       durationpb.New(10 * time.Millisecond),
+			},
+			min: 0,
+			max: time.Second,
+		},
+		{
+			name: "exponential",
+			latency: &pingv1.FaultLatency{
+				Distribution: pingv1.FaultLatency_DISTRIBUTION_EXPONENTIAL,
+				Base:         durationpb.New(10 * time.Millisecond),
+			},
+			min:     0,
+			max:     time.Second,
+			meanMin: 8 * time.Millisecond,
+			meanMax: 12 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRule(&pingv1.FaultRule{Latency: tc.latency})
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			total := time.Duration(0)
+			first := r.delay()
+			isVaried := false
+			for i := 0; i != samples; i++ {
+				delay := r.delay()
+				if delay < tc.min || delay > tc.max {
+					t.Fatalf("expected delays between %s and %s, got %s", tc.min, tc.max, delay)
+				}
+				total += delay
+				isVaried = isVaried || delay != first
+			}
+			if isVaried == tc.isConstant {
+				t.Fatalf("expected the delays to vary to be %t", !tc.isConstant)
+			}
+			if mean := total / samples; tc.meanMax != 0 && (mean < tc.meanMin || mean > tc.meanMax) {
+				t.Fatalf("expected a mean delay between %s and %s, got %s", tc.meanMin, tc.meanMax, mean)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package logging
+
+// This file contains the logger carried within the context of RPCs, annotated with the
+// procedure, and the peer, of the RPC.
+
+import (
+	"context"
+	"log/slog"
+
+	"connectrpc.com/connect"
+)
+
+type loggerKey struct{}
+
+// LoggerFromContext returns the logger within the context, or the fallback when there is none
+func LoggerFromContext(ctx context.Context, fallback *slog.Logger) (logger *slog.Logger) {
+	if logger, isPresent := ctx.Value(loggerKey{}).(*slog.Logger); isPresent {
+		return logger
+	}
+	return fallback
+}
+
+// ContextWithLogger returns a child context carrying the logger
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Interceptor places a logger annotated with the procedure, and peer, of each RPC into
+// the context of the RPC
+type Interceptor struct {
+	logger *slog.Logger
+}
+
+// NewInterceptor returns an interceptor that places loggers derived from the logger into the
+// context of the RPCs it handles
+func NewInterceptor(logger *slog.Logger) (interceptor *Interceptor) {
+	return &Interceptor{logger: logger}
+}
+
+func (interceptor *Interceptor) with(ctx context.Context, spec connect.Spec, peer connect.Peer) context.Context {
+	return ContextWithLogger(ctx, interceptor.logger.With("rpc.procedure", spec.Procedure, "peer", peer.Addr))
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (interceptor *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		return next(interceptor.with(ctx, req.Spec(), req.Peer()), req)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (interceptor *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (interceptor *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return next(interceptor.with(ctx, conn.Spec(), conn.Peer()), conn)
+	}
+}
@@ -0,0 +1,110 @@
+package logging
+
+// This file contains a slog handler that writes records to a local handler, typically JSON on
+// stdout, and also emits them as OpenTelemetry log records.  Records logged with a context
+// holding a span are given the trace_id, and span_id, of the span so that they can be
+// correlated with the traces of the RPC they were logged by.
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultScope is the instrumentation scope of the emitted OpenTelemetry log records
+const DefaultScope = "github.com/karlmutch/buf-ping"
+
+// Opts contains the options used when creating a Handler
+type Opts struct {
+	// Local is the handler records are written to locally, records are not written locally when nil
+	Local slog.Handler
+
+	// Provider is the OpenTelemetry logger provider records are emitted to, the global provider
+	// when nil.  The global provider discards records until one is set by SetLoggerProvider.
+	Provider log.LoggerProvider
+	// Scope is the instrumentation scope of the emitted records, default DefaultScope
+	Scope string
+	// Level is the minimum level of emitted records, default slog.LevelInfo
+	Level slog.Leveler
+}
+
+// Handler is a slog.Handler writing records to both a local handler, and OpenTelemetry
+type Handler struct {
+	local slog.Handler
+	otel  *otelHandler
+}
+
+// NewHandler returns a handler writing records to the local handler, and to OpenTelemetry
+func NewHandler(opts Opts) (handler *Handler) {
+	if opts.Provider == nil {
+		opts.Provider = global.GetLoggerProvider()
+	}
+	if len(opts.Scope) == 0 {
+		opts.Scope = DefaultScope
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	return &Handler{
+		local: opts.Local,
+		otel: &otelHandler{
+			logger: opts.Provider.Logger(opts.Scope),
+			level:  opts.Level,
+		},
+	}
+}
+
+// Enabled implements the slog.Handler interface
+func (handler *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if handler.local != nil && handler.local.Enabled(ctx, level) {
+		return true
+	}
+	return handler.otel.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface, the trace_id, and span_id, of the span within
+// the context are added to records written locally, inside any groups opened using WithGroup.
+// OpenTelemetry records carry the span within the record itself.
+func (handler *Handler) Handle(ctx context.Context, record slog.Record) (errGo error) {
+	if handler.local != nil && handler.local.Enabled(ctx, record.Level) {
+		local := record
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+			local = record.Clone()
+			local.AddAttrs(
+				slog.String("trace_id", spanCtx.TraceID().String()),
+				slog.String("span_id", spanCtx.SpanID().String()),
+			)
+		}
+		errGo = handler.local.Handle(ctx, local)
+	}
+	if handler.otel.Enabled(ctx, record.Level) {
+		if errOTel := handler.otel.Handle(ctx, record); errGo == nil {
+			errGo = errOTel
+		}
+	}
+	return errGo
+}
+
+// WithAttrs implements the slog.Handler interface
+func (handler *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &Handler{otel: handler.otel.withAttrs(attrs)}
+	if handler.local != nil {
+		clone.local = handler.local.WithAttrs(attrs)
+	}
+	return clone
+}
+
+// WithGroup implements the slog.Handler interface
+func (handler *Handler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return handler
+	}
+	clone := &Handler{otel: handler.otel.withGroup(name)}
+	if handler.local != nil {
+		clone.local = handler.local.WithGroup(name)
+	}
+	return clone
+}
@@ -0,0 +1,249 @@
+package logging
+
+// This file contains tests of the conversion of slog records into OpenTelemetry log records, and
+// of the trace correlation, and groups, of records written by the Handler.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recorder is an OpenTelemetry log processor retaining the records it is given
+type recorder struct {
+	records []sdklog.Record
+	sync.Mutex
+}
+
+func (r *recorder) OnEmit(_ context.Context, record *sdklog.Record) (errGo error) {
+	r.Lock()
+	defer r.Unlock()
+	r.records = append(r.records, record.Clone())
+	return nil
+}
+
+func (r *recorder) Shutdown(context.Context) (errGo error) { return nil }
+
+func (r *recorder) ForceFlush(context.Context) (errGo error) { return nil }
+
+func (r *recorder) last(t *testing.T) (record *sdklog.Record) {
+	t.Helper()
+
+	r.Lock()
+	defer r.Unlock()
+	if len(r.records) == 0 {
+		t.Fatal("expected a record to have been emitted")
+	}
+	return &r.records[len(r.records)-1]
+}
+
+// newTestLogger returns a logger whose records are written as JSON to the returned buffer, and
+// emitted to the returned recorder when at, or above, the level
+func newTestLogger(level slog.Level) (logger *slog.Logger, local *bytes.Buffer, r *recorder) {
+	local = &bytes.Buffer{}
+	r = &recorder{}
+	handler := NewHandler(Opts{
+		Local:    slog.NewJSONHandler(local, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		Provider: sdklog.NewLoggerProvider(sdklog.WithProcessor(r)),
+		Level:    level,
+	})
+	return slog.New(handler), local, r
+}
+
+// attrsOf returns the attributes of the record by name
+func attrsOf(record *sdklog.Record) (attrs map[string]log.Value) {
+	attrs = map[string]log.Value{}
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	return attrs
+}
+
+// lastLine decodes the last JSON record written locally
+func lastLine(t *testing.T, local *bytes.Buffer) (line map[string]any) {
+	t.Helper()
+
+	lines := bytes.Split(bytes.TrimSpace(local.Bytes()), []byte("\n"))
+	if errGo := json.Unmarshal(lines[len(lines)-1], &line); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return line
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+type valuer struct{}
+
+func (valuer) LogValue() slog.Value { return slog.IntValue(42) }
+
+func TestConvertAttr(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		attr     slog.Attr
+		expected []log.KeyValue
+	}{
+		{name: "string", attr: slog.String("k", "v"), expected: []log.KeyValue{log.String("k", "v")}},
+		{name: "int", attr: slog.Int("k", -3), expected: []log.KeyValue{log.Int64("k", -3)}},
+		{name: "uint", attr: slog.Uint64("k", 3), expected: []log.KeyValue{log.Int64("k", 3)}},
+		{name: "uint beyond int64", attr: slog.Uint64("k", math.MaxUint64), expected: []log.KeyValue{log.String("k", "18446744073709551615")}},
+		{name: "float", attr: slog.Float64("k", 1.5), expected: []log.KeyValue{log.Float64("k", 1.5)}},
+		{name: "bool", attr: slog.Bool("k", true), expected: []log.KeyValue{log.Bool("k", true)}},
+		{name: "duration", attr: slog.Duration("k", time.Second), expected: []log.KeyValue{log.Int64("k", int64(time.Second))}},
+		{name: "time", attr: slog.Time("k", now), expected: []log.KeyValue{log.Int64("k", now.UnixNano())}},
+		{name: "error", attr: slog.Any("k", errors.New("failed")), expected: []log.KeyValue{log.String("k", "failed")}},
+		{name: "bytes", attr: slog.Any("k", []byte{1, 2}), expected: []log.KeyValue{log.Bytes("k", []byte{1, 2})}},
+		{name: "stringer", attr: slog.Any("k", stringer{}), expected: []log.KeyValue{log.String("k", "stringer")}},
+		{name: "other", attr: slog.Any("k", struct{ A int }{A: 1}), expected: []log.KeyValue{log.String("k", "{A:1}")}},
+		{name: "valuer", attr: slog.Any("k", valuer{}), expected: []log.KeyValue{log.Int64("k", 42)}},
+		{name: "address", attr: slog.Any("k", netip.MustParseAddr("127.0.0.1")), expected: []log.KeyValue{log.String("k", "127.0.0.1")}},
+		{name: "empty", attr: slog.Attr{}},
+		{
+			name:     "group",
+			attr:     slog.Group("g", slog.Int("a", 1), slog.Group("h", slog.String("b", "c"))),
+			expected: []log.KeyValue{log.Map("g", log.Int64("a", 1), log.Map("h", log.String("b", "c")))},
+		},
+		{
+			name:     "inline group",
+			attr:     slog.Group("", slog.Int("a", 1), slog.Int("b", 2)),
+			expected: []log.KeyValue{log.Int64("a", 1), log.Int64("b", 2)},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			kvs := convertAttr("", tc.attr)
+			if len(kvs) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, kvs)
+			}
+			for i, kv := range kvs {
+				if !kv.Equal(tc.expected[i]) {
+					t.Fatalf("expected %v, got %v", tc.expected[i], kv)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerGroups(t *testing.T) {
+	logger, local, r := newTestLogger(slog.LevelInfo)
+
+	parent := logger.With("a", 1).WithGroup("g")
+	child := parent.With("b", 2).WithGroup("h")
+	child.Info("child", "c", 3)
+
+	attrs := attrsOf(r.last(t))
+	for key, expected := range map[string]log.Value{"a": log.Int64Value(1), "g.b": log.Int64Value(2), "g.h.c": log.Int64Value(3)} {
+		if !attrs[key].Equal(expected) {
+			t.Errorf("expected %s to be %v, got %v", key, expected, attrs[key])
+		}
+	}
+	if len(attrs) != 3 {
+		t.Errorf("expected 3 attributes, got %v", attrs)
+	}
+	if body := r.last(t).Body().AsString(); body != "child" {
+		t.Errorf("expected the message as the body, got %q", body)
+	}
+
+	line := lastLine(t, local)
+	g, _ := line["g"].(map[string]any)
+	h, _ := g["h"].(map[string]any)
+	if line["a"] != 1.0 || g["b"] != 2.0 || h["c"] != 3.0 {
+		t.Errorf("expected the local record to hold nested groups, got %v", line)
+	}
+
+	// Chained handlers do not alter the handlers they were derived from
+	parent.Info("parent", "c", 3)
+
+	attrs = attrsOf(r.last(t))
+	if _, isPresent := attrs["g.b"]; isPresent {
+		t.Errorf("expected the parent to be unaffected by the attributes of the child, got %v", attrs)
+	}
+	if !attrs["g.c"].Equal(log.Int64Value(3)) {
+		t.Errorf("expected g.c to be 3, got %v", attrs)
+	}
+}
+
+func TestHandlerTraceCorrelation(t *testing.T) {
+	logger, local, r := newTestLogger(slog.LevelInfo)
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+
+	logger.WithGroup("g").InfoContext(ctx, "traced")
+
+	record := r.last(t)
+	if record.TraceID() != spanCtx.TraceID() || record.SpanID() != spanCtx.SpanID() {
+		t.Errorf("expected the record to carry trace %s span %s, got %s %s",
+			spanCtx.TraceID(), spanCtx.SpanID(), record.TraceID(), record.SpanID())
+	}
+
+	line := lastLine(t, local)
+	g, _ := line["g"].(map[string]any)
+	if g["trace_id"] != spanCtx.TraceID().String() || g["span_id"] != spanCtx.SpanID().String() {
+		t.Errorf("expected the local record to carry trace_id, and span_id, within its group, got %v", line)
+	}
+
+	// Records logged without a span are not given ids
+	logger.Info("untraced")
+
+	if record = r.last(t); record.TraceID().IsValid() {
+		t.Errorf("expected no trace, got %s", record.TraceID())
+	}
+	line = lastLine(t, local)
+	if _, isPresent := line["trace_id"]; isPresent {
+		t.Errorf("expected no trace_id, got %v", line)
+	}
+}
+
+func TestHandlerLevel(t *testing.T) {
+	logger, local, r := newTestLogger(slog.LevelWarn)
+
+	// Records below the level of the handler are only written locally
+	logger.Info("local")
+	if len(r.records) != 0 {
+		t.Fatalf("expected no records to be emitted below the level, got %d", len(r.records))
+	}
+	if line := lastLine(t, local); line["msg"] != "local" {
+		t.Fatalf("expected the record to be written locally, got %v", line)
+	}
+
+	testCases := []struct {
+		level    slog.Level
+		severity log.Severity
+	}{
+		{level: slog.LevelWarn, severity: log.SeverityWarn},
+		{level: slog.LevelError, severity: log.SeverityError},
+		{level: slog.LevelError + 1, severity: log.SeverityError2},
+	}
+	for _, tc := range testCases {
+		logger.Log(context.Background(), tc.level, "emitted")
+		record := r.last(t)
+		if record.Severity() != tc.severity {
+			t.Errorf("expected level %s to have severity %s, got %s", tc.level, tc.severity, record.Severity())
+		}
+		if record.SeverityText() != tc.level.String() {
+			t.Errorf("expected severity text %s, got %s", tc.level, record.SeverityText())
+		}
+	}
+}
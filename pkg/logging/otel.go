@@ -0,0 +1,128 @@
+package logging
+
+// This file contains the conversion of slog records into OpenTelemetry log records.  Groups
+// opened using WithGroup are flattened into dotted attribute names, groups within records are
+// converted into maps.
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"go.opentelemetry.io/otel/log"
+)
+
+// severityOffset maps the slog levels onto the OpenTelemetry severities, slog.LevelDebug
+// becoming log.SeverityDebug, slog.LevelInfo log.SeverityInfo and so on
+const severityOffset = slog.Level(log.SeverityDebug) - slog.LevelDebug
+
+type otelHandler struct {
+	logger log.Logger
+	level  slog.Leveler
+
+	// attrs were added using WithAttrs, prefix holds the groups opened using WithGroup
+	attrs  []log.KeyValue
+	prefix string
+}
+
+func (handler *otelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level < handler.level.Level() {
+		return false
+	}
+	return handler.logger.Enabled(ctx, log.EnabledParameters{Severity: log.Severity(level + severityOffset)})
+}
+
+func (handler *otelHandler) Handle(ctx context.Context, record slog.Record) (errGo error) {
+	rec := log.Record{}
+	rec.SetTimestamp(record.Time)
+	rec.SetSeverity(log.Severity(record.Level + severityOffset))
+	rec.SetSeverityText(record.Level.String())
+	rec.SetBody(log.StringValue(record.Message))
+
+	rec.AddAttributes(handler.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		rec.AddAttributes(convertAttr(handler.prefix, attr)...)
+		return true
+	})
+
+	handler.logger.Emit(ctx, rec)
+	return nil
+}
+
+func (handler *otelHandler) withAttrs(attrs []slog.Attr) (clone *otelHandler) {
+	clone = &otelHandler{
+		logger: handler.logger,
+		level:  handler.level,
+		attrs:  make([]log.KeyValue, 0, len(handler.attrs)+len(attrs)),
+		prefix: handler.prefix,
+	}
+	clone.attrs = append(clone.attrs, handler.attrs...)
+	for _, attr := range attrs {
+		clone.attrs = append(clone.attrs, convertAttr(handler.prefix, attr)...)
+	}
+	return clone
+}
+
+func (handler *otelHandler) withGroup(name string) (clone *otelHandler) {
+	return &otelHandler{
+		logger: handler.logger,
+		level:  handler.level,
+		attrs:  handler.attrs,
+		prefix: handler.prefix + name + ".",
+	}
+}
+
+// convertAttr returns the attribute as OpenTelemetry key values, groups without a key are
+// inlined, and empty attributes ignored, as described by slog.Handler
+func convertAttr(prefix string, attr slog.Attr) (kvs []log.KeyValue) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return nil
+	}
+	if attr.Value.Kind() == slog.KindGroup && len(attr.Key) == 0 {
+		for _, member := range attr.Value.Group() {
+			kvs = append(kvs, convertAttr(prefix, member)...)
+		}
+		return kvs
+	}
+	return []log.KeyValue{{Key: prefix + attr.Key, Value: convertValue(attr.Value)}}
+}
+
+func convertValue(value slog.Value) log.Value {
+	switch value.Kind() {
+	case slog.KindString:
+		return log.StringValue(value.String())
+	case slog.KindInt64:
+		return log.Int64Value(value.Int64())
+	case slog.KindUint64:
+		if value.Uint64() > math.MaxInt64 {
+			return log.StringValue(value.String())
+		}
+		return log.Int64Value(int64(value.Uint64()))
+	case slog.KindFloat64:
+		return log.Float64Value(value.Float64())
+	case slog.KindBool:
+		return log.BoolValue(value.Bool())
+	case slog.KindDuration:
+		return log.Int64Value(int64(value.Duration()))
+	case slog.KindTime:
+		return log.Int64Value(value.Time().UnixNano())
+	case slog.KindGroup:
+		kvs := []log.KeyValue{}
+		for _, member := range value.Group() {
+			kvs = append(kvs, convertAttr("", member)...)
+		}
+		return log.MapValue(kvs...)
+	}
+
+	switch v := value.Any().(type) {
+	case error:
+		return log.StringValue(v.Error())
+	case []byte:
+		return log.BytesValue(v)
+	case fmt.Stringer:
+		return log.StringValue(v.String())
+	}
+	return log.StringValue(fmt.Sprintf("%+v", value.Any()))
+}
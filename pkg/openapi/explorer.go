@@ -0,0 +1,54 @@
+package openapi
+
+// This file contains the http.Handler serving the OpenAPI document along with a
+// single page explorer, embedded within the server, that lists the operations of the
+// document and sends requests to them from the browser.
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+//go:embed explorer.html
+var explorerHTML []byte
+
+// NewHandler returns a handler serving the OpenAPI document of the services at openapi.json, and
+// the explorer, beneath the path prefix, for example /explorer/
+func NewHandler(prefix string, opts Opts) (handler http.Handler, err kv.Error) {
+	doc, err := NewDocument(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, errGo := json.MarshalIndent(doc, "", "  ")
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		switch r.URL.Path {
+		case prefix:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+			_, _ = w.Write(explorerHTML)
+		case prefix + "openapi.json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}), nil
+}
@@ -0,0 +1,427 @@
+package openapi
+
+// This file contains the generation of an OpenAPI v3 description of services from
+// their protobuf descriptors.  Every unary RPC is described in the form used by the
+// Connect protocol, a POST of the JSON request message to the procedure, and when
+// REST transcoding is enabled every route of the google.api.http annotations is also
+// described.  Message schemas follow the protobuf JSON mapping, so 64-bit integers
+// are strings and the well known types use their JSON forms.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// object is a JSON object within the document
+type object = map[string]any
+
+// errorSchema is the name of the schema of the JSON errors of the Connect protocol
+const errorSchema = "connect.Error"
+
+// pathVariable matches the variables of path templates, for example {counter} or {counter=*}
+var pathVariable = regexp.MustCompile(`{([^}=]+)(=[^}]*)?}`)
+
+// Opts contains the options used when generating a document
+type Opts struct {
+	// Title, and Version, are used for the info section of the document
+	Title   string
+	Version string
+	// Services are the fully qualified names of the services described, they must be
+	// registered with the global protobuf registry by importing their generated code
+	Services []string
+	// REST includes the routes of the google.api.http annotations of the services
+	REST bool
+}
+
+// generator holds the state used while generating a document
+type generator struct {
+	paths   object
+	schemas object
+}
+
+// NewDocument returns the OpenAPI v3 document describing the services
+func NewDocument(opts Opts) (doc object, err kv.Error) {
+	g := &generator{
+		paths:   object{},
+		schemas: object{errorSchema: connectErrorSchema()},
+	}
+
+	tags := []any{}
+	for _, name := range opts.Services {
+		desc, errGo := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if errGo != nil {
+			return nil, kv.Wrap(errGo).With("service", name, "stack", stack.Trace().TrimRuntime())
+		}
+		service, isService := desc.(protoreflect.ServiceDescriptor)
+		if !isService {
+			return nil, kv.NewError("not a service").With("service", name, "stack", stack.Trace().TrimRuntime())
+		}
+		tags = append(tags, object{"name": name})
+		if err = g.addService(service, opts.REST); err != nil {
+			return nil, err.With("service", name)
+		}
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   opts.Title,
+			"version": opts.Version,
+		},
+		"servers": []any{object{"url": "/"}},
+		"tags":    tags,
+		"paths":   g.paths,
+		"components": object{
+			"schemas": g.schemas,
+			"securitySchemes": object{
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		// Authentication is only required when the server is configured with token keys
+		"security": []any{object{}, object{"bearerAuth": []any{}}},
+	}, nil
+}
+
+// addService adds the operations of every method of the service
+func (g *generator) addService(service protoreflect.ServiceDescriptor, isREST bool) (err kv.Error) {
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		if !md.IsStreamingClient() && !md.IsStreamingServer() {
+			g.addConnect(md)
+		}
+		if !isREST {
+			continue
+		}
+		rule, _ := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if rule == nil {
+			continue
+		}
+		for n, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			if err = g.addREST(md, binding, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addOperation adds an operation to the path, failing if the path already has an operation
+// using the method
+func (g *generator) addOperation(path string, method string, op object) (err kv.Error) {
+	item, _ := g.paths[path].(object)
+	if item == nil {
+		item = object{}
+		g.paths[path] = item
+	}
+	if _, isPresent := item[method]; isPresent {
+		return kv.NewError("duplicate operation").With("path", path, "method", method, "stack", stack.Trace().TrimRuntime())
+	}
+	item[method] = op
+	return nil
+}
+
+// addConnect adds the Connect protocol form of a unary method
+func (g *generator) addConnect(md protoreflect.MethodDescriptor) {
+	service := string(md.Parent().FullName())
+	path := "/" + service + "/" + string(md.Name())
+	_ = g.addOperation(path, "post", object{
+		"tags":        []any{service},
+		"operationId": "connect." + service + "." + string(md.Name()),
+		"summary":     string(md.Name()) + " using the Connect protocol",
+		"parameters": []any{
+			object{
+				"name":     "Connect-Protocol-Version",
+				"in":       "header",
+				"required": false,
+				"schema":   object{"type": "string", "enum": []any{"1"}},
+			},
+		},
+		"requestBody": object{
+			"required": true,
+			"content":  object{"application/json": object{"schema": g.ref(md.Input())}},
+		},
+		"responses": g.responses(md, object{"application/json": object{"schema": g.ref(md.Output())}}),
+	})
+}
+
+// addREST adds the route of an HTTP rule of a method
+func (g *generator) addREST(md protoreflect.MethodDescriptor, rule *annotations.HttpRule, n int) (err kv.Error) {
+	method, path := "", ""
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, path = "get", pattern.Get
+	case *annotations.HttpRule_Put:
+		method, path = "put", pattern.Put
+	case *annotations.HttpRule_Post:
+		method, path = "post", pattern.Post
+	case *annotations.HttpRule_Delete:
+		method, path = "delete", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, path = "patch", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		method, path = strings.ToLower(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return kv.NewError("HTTP rule has no pattern").With("procedure", md.FullName(), "stack", stack.Trace().TrimRuntime())
+	}
+
+	service := string(md.Parent().FullName())
+	operationID := "rest." + service + "." + string(md.Name())
+	if n != 0 {
+		operationID = fmt.Sprintf("%s.%d", operationID, n)
+	}
+	op := object{
+		"tags":        []any{service},
+		"operationId": operationID,
+		"summary":     string(md.Name()),
+	}
+
+	// Path variables are reduced to their field names, which are also the names of the parameters
+	params := []any{}
+	bound := map[string]struct{}{}
+	path = pathVariable.ReplaceAllStringFunc(path, func(variable string) string {
+		field := pathVariable.FindStringSubmatch(variable)[1]
+		bound[field] = struct{}{}
+		params = append(params, object{
+			"name":     field,
+			"in":       "path",
+			"required": true,
+			"schema":   g.fieldSchema(fieldByPath(md.Input(), field)),
+		})
+		return "{" + field + "}"
+	})
+
+	body := rule.GetBody()
+	switch body {
+	case "*":
+		mediaType := "application/json"
+		if md.IsStreamingClient() {
+			mediaType = "application/x-ndjson"
+		}
+		op["requestBody"] = object{
+			"required": !md.IsStreamingClient(),
+			"content":  object{mediaType: object{"schema": g.ref(md.Input())}},
+		}
+	case "":
+	default:
+		bound[body] = struct{}{}
+		op["requestBody"] = object{
+			"content": object{"application/json": object{"schema": g.fieldSchema(fieldByPath(md.Input(), body))}},
+		}
+	}
+
+	// Fields not bound to the path or body are query parameters, only fields with a
+	// scalar text form can be given this way
+	if body != "*" {
+		fields := md.Input().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			if _, isBound := bound[string(fd.Name())]; isBound || fd.IsMap() {
+				continue
+			}
+			if fd.Kind() == protoreflect.MessageKind && !isWellKnown(fd.Message()) {
+				continue
+			}
+			params = append(params, object{
+				"name":   string(fd.Name()),
+				"in":     "query",
+				"schema": g.fieldSchema(fd),
+			})
+		}
+	}
+	if len(params) != 0 {
+		op["parameters"] = params
+	}
+
+	content := object{"application/json": object{"schema": g.ref(md.Output())}}
+	if md.IsStreamingServer() {
+		op["description"] = "The response is a stream of messages returned as newline delimited JSON, or as server-sent events when " +
+			"the request accepts text/event-stream.  An error ending the stream is returned as a final message holding only an error field."
+		content = object{
+			"application/x-ndjson": object{"schema": g.ref(md.Output())},
+			"text/event-stream":    object{"schema": object{"type": "string"}},
+		}
+	}
+	op["responses"] = g.responses(md, content)
+	return g.addOperation(path, method, op)
+}
+
+// responses returns the responses of an operation, errors use the JSON form of the Connect protocol
+func (g *generator) responses(md protoreflect.MethodDescriptor, content object) (responses object) {
+	return object{
+		"200": object{
+			"description": string(md.Output().Name()),
+			"content":     content,
+		},
+		"default": object{
+			"description": "An error using the JSON form of the Connect protocol",
+			"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/" + errorSchema}}},
+		},
+	}
+}
+
+// fieldByPath returns the field at a dotted path within a message, or nil
+func fieldByPath(desc protoreflect.MessageDescriptor, path string) (fd protoreflect.FieldDescriptor) {
+	for _, name := range strings.Split(path, ".") {
+		if fd != nil {
+			if fd.Message() == nil {
+				return nil
+			}
+			desc = fd.Message()
+		}
+		if fd = desc.Fields().ByName(protoreflect.Name(name)); fd == nil {
+			return nil
+		}
+	}
+	return fd
+}
+
+// ref returns a reference to the schema of a message, adding the schema when it is first used
+func (g *generator) ref(desc protoreflect.MessageDescriptor) (schema object) {
+	if isWellKnown(desc) {
+		return wellKnownSchema(desc)
+	}
+	name := string(desc.FullName())
+	if _, isPresent := g.schemas[name]; !isPresent {
+		// The placeholder stops recursive messages from being added again
+		g.schemas[name] = object{}
+		g.schemas[name] = g.messageSchema(desc)
+	}
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func (g *generator) messageSchema(desc protoreflect.MessageDescriptor) (schema object) {
+	properties := object{}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		properties[fd.JSONName()] = g.fieldSchema(fd)
+	}
+	return object{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// fieldSchema returns the schema of a field, including repeated and map fields
+func (g *generator) fieldSchema(fd protoreflect.FieldDescriptor) (schema object) {
+	switch {
+	case fd == nil:
+		return object{}
+	case fd.IsMap():
+		return object{"type": "object", "additionalProperties": g.valueSchema(fd.MapValue())}
+	case fd.IsList():
+		return object{"type": "array", "items": g.valueSchema(fd)}
+	default:
+		return g.valueSchema(fd)
+	}
+}
+
+// valueSchema returns the schema of a single value of a field
+func (g *generator) valueSchema(fd protoreflect.FieldDescriptor) (schema object) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return object{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return object{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return object{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return object{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return object{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return object{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return object{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return object{"type": "string"}
+	case protoreflect.BytesKind:
+		return object{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := []any{}
+		for i := 0; i < fd.Enum().Values().Len(); i++ {
+			values = append(values, string(fd.Enum().Values().Get(i).Name()))
+		}
+		return object{"type": "string", "enum": values}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.ref(fd.Message())
+	}
+	return object{}
+}
+
+// isWellKnown returns true for the well known types that have their own JSON form
+func isWellKnown(desc protoreflect.MessageDescriptor) bool {
+	return desc.ParentFile().Package() == "google.protobuf" && wellKnownSchema(desc) != nil
+}
+
+// wellKnownSchema returns the schema of the JSON form of a well known type, or nil
+func wellKnownSchema(desc protoreflect.MessageDescriptor) (schema object) {
+	switch desc.FullName() {
+	case "google.protobuf.Timestamp":
+		return object{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return object{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`, "example": "1.5s"}
+	case "google.protobuf.Empty":
+		return object{"type": "object"}
+	case "google.protobuf.Struct", "google.protobuf.Any":
+		return object{"type": "object", "additionalProperties": true}
+	case "google.protobuf.Value":
+		return object{}
+	case "google.protobuf.ListValue":
+		return object{"type": "array", "items": object{}}
+	case "google.protobuf.FieldMask":
+		return object{"type": "string"}
+	case "google.protobuf.BoolValue":
+		return object{"type": "boolean"}
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return object{"type": "integer"}
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return object{"type": "string", "format": "int64"}
+	case "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return object{"type": "number"}
+	case "google.protobuf.StringValue":
+		return object{"type": "string"}
+	case "google.protobuf.BytesValue":
+		return object{"type": "string", "format": "byte"}
+	}
+	return nil
+}
+
+// connectErrorSchema returns the schema of the JSON errors of the Connect protocol
+func connectErrorSchema() (schema object) {
+	return object{
+		"type": "object",
+		"properties": object{
+			"code": object{
+				"type": "string",
+				"enum": []any{
+					"canceled", "unknown", "invalid_argument", "deadline_exceeded", "not_found", "already_exists",
+					"permission_denied", "resource_exhausted", "failed_precondition", "aborted", "out_of_range",
+					"unimplemented", "internal", "unavailable", "data_loss", "unauthenticated",
+				},
+			},
+			"message": object{"type": "string"},
+			"details": object{
+				"type": "array",
+				"items": object{
+					"type": "object",
+					"properties": object{
+						"type":  object{"type": "string", "example": "google.rpc.ErrorInfo"},
+						"value": object{"type": "string", "format": "byte"},
+						"debug": object{"type": "object", "additionalProperties": true},
+					},
+				},
+			},
+		},
+	}
+}
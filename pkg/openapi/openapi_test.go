@@ -0,0 +1,201 @@
+package openapi
+
+// This file contains tests of the OpenAPI document generated from the ping.v1 services, checking
+// its operations against the methods, and google.api.http annotations, of the proto.
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+)
+
+// services are the services of the ping.v1 proto described by the documents of the tests
+var services = []string{"ping.v1.PingService", "ping.v1.FaultService"}
+
+// newTestDocument returns the document of the ping.v1 services
+func newTestDocument(t *testing.T, isREST bool) (doc object) {
+	t.Helper()
+
+	doc, err := NewDocument(Opts{Title: "ping", Version: "test", Services: services, REST: isREST})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return doc
+}
+
+// operationOf returns the operation of the document at the path using the method, or nil
+func operationOf(doc object, path string, method string) (op object) {
+	item, _ := doc["paths"].(object)[path].(object)
+	op, _ = item[method].(object)
+	return op
+}
+
+// serviceOf returns the descriptor of the service from the ping.v1 proto
+func serviceOf(t *testing.T, name string) (service protoreflect.ServiceDescriptor) {
+	t.Helper()
+
+	service = pingv1.File_ping_v1_ping_proto.Services().ByName(protoreflect.Name(strings.TrimPrefix(name, "ping.v1.")))
+	if service == nil {
+		t.Fatalf("service %s is not in the ping.v1 proto", name)
+	}
+	return service
+}
+
+func TestConnectPaths(t *testing.T) {
+	doc := newTestDocument(t, false)
+
+	operations := 0
+	for _, name := range services {
+		methods := serviceOf(t, name).Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			path := "/" + name + "/" + string(md.Name())
+			op := operationOf(doc, path, "post")
+
+			// Streaming methods cannot be described as a single request and response
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				if op != nil {
+					t.Fatalf("expected no operation for the streaming method %s", path)
+				}
+				continue
+			}
+			if op == nil {
+				t.Fatalf("expected a POST operation for %s", path)
+			}
+			if id := op["operationId"]; id != "connect."+name+"."+string(md.Name()) {
+				t.Fatalf("unexpected operation ID %v for %s", id, path)
+			}
+			operations++
+		}
+	}
+
+	// Without REST only the Connect procedures are described
+	if paths := len(doc["paths"].(object)); paths != operations {
+		t.Fatalf("expected %d paths, got %d", operations, paths)
+	}
+}
+
+func TestRESTPaths(t *testing.T) {
+	doc := newTestDocument(t, true)
+
+	routes := 0
+	for _, name := range services {
+		methods := serviceOf(t, name).Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			rule, _ := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+			if rule == nil {
+				continue
+			}
+			for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+				method, path := "", ""
+				switch pattern := binding.GetPattern().(type) {
+				case *annotations.HttpRule_Get:
+					method, path = "get", pattern.Get
+				case *annotations.HttpRule_Put:
+					method, path = "put", pattern.Put
+				case *annotations.HttpRule_Post:
+					method, path = "post", pattern.Post
+				case *annotations.HttpRule_Delete:
+					method, path = "delete", pattern.Delete
+				case *annotations.HttpRule_Patch:
+					method, path = "patch", pattern.Patch
+				default:
+					t.Fatalf("unexpected HTTP rule pattern of %s", md.FullName())
+				}
+				op := operationOf(doc, path, method)
+				if op == nil {
+					t.Fatalf("expected a %s operation for %s of %s", strings.ToUpper(method), path, md.FullName())
+				}
+				if id, _ := op["operationId"].(string); !strings.HasPrefix(id, "rest."+name+"."+string(md.Name())) {
+					t.Fatalf("unexpected operation ID %v for %s %s", op["operationId"], strings.ToUpper(method), path)
+				}
+
+				// Variables of the path are described as parameters of the same name
+				for _, match := range pathVariable.FindAllStringSubmatch(path, -1) {
+					isFound := false
+					params, _ := op["parameters"].([]any)
+					for _, param := range params {
+						isFound = isFound || (param.(object)["name"] == match[1] && param.(object)["in"] == "path")
+					}
+					if !isFound {
+						t.Fatalf("expected the path parameter %s for %s %s", match[1], strings.ToUpper(method), path)
+					}
+				}
+
+				// Client streams are sent as newline delimited JSON, and server streams returned as it
+				if body, _ := op["requestBody"].(object); md.IsStreamingClient() && body["content"].(object)["application/x-ndjson"] == nil {
+					t.Fatalf("expected a newline delimited JSON request for %s %s", strings.ToUpper(method), path)
+				}
+				content := op["responses"].(object)["200"].(object)["content"].(object)
+				if md.IsStreamingServer() && content["application/x-ndjson"] == nil {
+					t.Fatalf("expected a newline delimited JSON response for %s %s", strings.ToUpper(method), path)
+				}
+				routes++
+			}
+		}
+	}
+	if routes == 0 {
+		t.Fatal("expected the ping.v1 proto to have HTTP rules")
+	}
+}
+
+// TestSchemaRefs checks that every schema referenced by the document is defined by it
+func TestSchemaRefs(t *testing.T) {
+	doc := newTestDocument(t, true)
+
+	data, errGo := json.Marshal(doc)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	decoded := map[string]any{}
+	if errGo = json.Unmarshal(data, &decoded); errGo != nil {
+		t.Fatal(errGo)
+	}
+	schemas := decoded["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			if ref, isRef := v["$ref"].(string); isRef {
+				if _, isPresent := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !isPresent {
+					t.Fatalf("the schema %s is referenced but not defined", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(decoded)
+}
+
+func TestUnknownService(t *testing.T) {
+	testCases := []struct {
+		name    string
+		service string
+	}{
+		{name: "missing", service: "ping.v1.MissingService"},
+		{name: "not a service", service: "ping.v1.PingRequest"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewDocument(Opts{Services: []string{tc.service}}); err == nil {
+				t.Fatalf("expected %s to be refused", tc.service)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package client
+
+// This file contains a Go client for the PingService that hides the TLS and
+// protocol setup needed to talk to a pingsrv instance.
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// Protocol is used to select the wire protocol the client uses when talking to the server
+type Protocol string
+
+const (
+	ProtocolConnect Protocol = "connect"
+	ProtocolGRPC    Protocol = "grpc"
+	ProtocolGRPCWeb Protocol = "grpcweb"
+)
+
+// Compression is used to select the compression applied to request messages
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+)
+
+// Opts contains the configurable options for a PingService client, zero values
+// will result in a Connect protocol client using the system certificate roots
+type Opts struct {
+	// CAFile is a PEM file with the certificates used to verify the server, for example testing.crt
+	CAFile string
+	// ServerName overrides the host name used to verify the server certificate
+	ServerName string
+	// CertFile, and KeyFile are the PEM client certificate and key presented to servers requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// Token is sent as a bearer token in the authorization header of every request
+	Token string
+	// Counter is the name of the server counter used by every request, empty selects the default counter
+	Counter string
+
+	Protocol    Protocol
+	Compression Compression
+	// HTTP3 selects HTTP/3 over QUIC, the server must have its HTTP/3 listener enabled
+	HTTP3 bool
+
+	// DialTimeout limits the time spent establishing the TCP, or QUIC, and TLS connection
+	DialTimeout time.Duration
+	// Timeout is applied as a deadline to every RPC, including the complete lifetime of streams
+	Timeout time.Duration
+}
+
+// Client is used to encapsulate a connectrpc PingService client
+type Client struct {
+	rpc     pingv1connect.PingServiceClient
+	fault   pingv1connect.FaultServiceClient
+	counter string
+	timeout time.Duration
+}
+
+// NewClient returns a client for the PingService at the address, which can be
+// either a host:port pair or an https URL.  Servers offering cleartext HTTP/2 are
+// reached using an http URL, or a unix:// URL holding the path of a Unix socket.
+// Servers with an HTTP/3 listener are reached over QUIC when the HTTP3 option is set.
+func NewClient(addr string, opts Opts) (client *Client, err kv.Error) {
+
+	baseURL := addr
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	socket := ""
+	if strings.HasPrefix(baseURL, "unix://") {
+		socket = strings.TrimPrefix(baseURL, "unix://")
+		baseURL = "http://localhost"
+	}
+
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	connectOpts := []connect.ClientOption{}
+
+	switch opts.Protocol {
+	case ProtocolConnect, "":
+	case ProtocolGRPC:
+		connectOpts = append(connectOpts, connect.WithGRPC())
+	case ProtocolGRPCWeb:
+		connectOpts = append(connectOpts, connect.WithGRPCWeb())
+	default:
+		return nil, kv.NewError("unknown protocol").With("protocol", opts.Protocol, "stack", stack.Trace().TrimRuntime())
+	}
+
+	if len(opts.Token) != 0 {
+		connectOpts = append(connectOpts, connect.WithInterceptors(newTokenInterceptor(opts.Token)))
+	}
+
+	switch opts.Compression {
+	case CompressionNone, "":
+	case CompressionGzip:
+		connectOpts = append(connectOpts, connect.WithSendGzip())
+	default:
+		return nil, kv.NewError("unknown compression").With("compression", opts.Compression, "stack", stack.Trace().TrimRuntime())
+	}
+
+	dialer := &net.Dialer{Timeout: opts.DialTimeout}
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: opts.DialTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+
+	// Cleartext HTTP/2 is used with prior knowledge, streaming RPCs need HTTP/2
+	if strings.HasPrefix(baseURL, "http://") {
+		httpClient.Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+				if len(socket) != 0 {
+					return dialer.DialContext(ctx, "unix", socket)
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+	}
+
+	if opts.HTTP3 {
+		if !strings.HasPrefix(baseURL, "https://") {
+			return nil, kv.NewError("HTTP/3 requires an https address").With("addr", addr, "stack", stack.Trace().TrimRuntime())
+		}
+		httpClient.Transport = &http3.RoundTripper{
+			TLSClientConfig: tlsConfig,
+			QuicConfig:      &quic.Config{HandshakeIdleTimeout: opts.DialTimeout},
+		}
+	}
+
+	client = &Client{
+		rpc:     pingv1connect.NewPingServiceClient(httpClient, baseURL, connectOpts...),
+		fault:   pingv1connect.NewFaultServiceClient(httpClient, baseURL, connectOpts...),
+		counter: opts.Counter,
+		timeout: opts.Timeout,
+	}
+	return client, nil
+}
+
+func newTLSConfig(opts Opts) (tlsConfig *tls.Config, err kv.Error) {
+	tlsConfig = &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ServerName: opts.ServerName,
+		NextProtos: []string{"h2"},
+	}
+
+	if len(opts.CertFile) != 0 || len(opts.KeyFile) != 0 {
+		cert, errGo := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if errGo != nil {
+			return nil, kv.Wrap(errGo).With("cert", opts.CertFile, "key", opts.KeyFile, "stack", stack.Trace().TrimRuntime())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.CAFile) == 0 {
+		return tlsConfig, nil
+	}
+
+	pem, errGo := os.ReadFile(opts.CAFile)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("file", opts.CAFile, "stack", stack.Trace().TrimRuntime())
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, kv.NewError("no certificates found").With("file", opts.CAFile, "stack", stack.Trace().TrimRuntime())
+	}
+	return tlsConfig, nil
+}
+
+// tokenInterceptor adds a bearer token to the headers of outbound requests
+type tokenInterceptor struct {
+	authorization string
+}
+
+func newTokenInterceptor(token string) *tokenInterceptor {
+	return &tokenInterceptor{authorization: "Bearer " + token}
+}
+
+func (interceptor *tokenInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		req.Header().Set("Authorization", interceptor.authorization)
+		return next(ctx, req)
+	}
+}
+
+func (interceptor *tokenInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		conn.RequestHeader().Set("Authorization", interceptor.authorization)
+		return conn
+	}
+}
+
+func (interceptor *tokenInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// withTimeout applies the per RPC deadline, if one was configured
+func (client *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if client.timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, client.timeout)
+}
+
+// Ping returns the current counter within the server and the servers timestamp
+func (client *Client) Ping(ctx context.Context) (resp *pingv1.PingResponse, err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	result, err := client.rpc.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Counter: client.counter}))
+	if err != nil {
+		return nil, err
+	}
+	return result.Msg, nil
+}
+
+// Sum streams the additions to the server and returns the resulting total
+func (client *Client) Sum(ctx context.Context, additions []int32) (resp *pingv1.SumResponse, err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	stream := client.rpc.Sum(ctx)
+	for _, addition := range additions {
+		if err = stream.Send(&pingv1.SumRequest{Addition: addition, Counter: client.counter}); err != nil {
+			break
+		}
+	}
+	// An error from Send is only a signal that the server has stopped, the real
+	// cause is returned by CloseAndReceive
+	result, err := stream.CloseAndReceive()
+	if err != nil {
+		return nil, err
+	}
+	return result.Msg, nil
+}
+
+// Generate asks the server to increment the total by addition and invokes recv with
+// every incremental result streamed back by the server
+func (client *Client) Generate(ctx context.Context, addition int32, recv func(*pingv1.GenerateResponse) error) (err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := client.rpc.Generate(ctx, connect.NewRequest(&pingv1.GenerateRequest{Addition: addition, Counter: client.counter}))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for stream.Receive() {
+		if err = recv(stream.Msg()); err != nil {
+			// Cancelling ends the stream so that closing it does not wait upon the server
+			cancel()
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// Count streams the additions to the server while concurrently passing every
+// incremental result to recv
+func (client *Client) Count(ctx context.Context, additions []int32, recv func(*pingv1.CountResponse) error) (err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	stream := client.rpc.Count(ctx)
+
+	// Sending is done asynchronously so that the server is never blocked on
+	// flow control waiting for us to read its responses
+	sendErrC := make(chan error, 1)
+	go func() {
+		defer close(sendErrC)
+		for _, addition := range additions {
+			if errGo := stream.Send(&pingv1.CountRequest{Addition: addition, Counter: client.counter}); errGo != nil {
+				if !errors.Is(errGo, io.EOF) {
+					sendErrC <- errGo
+				}
+				break
+			}
+		}
+		if errGo := stream.CloseRequest(); errGo != nil {
+			sendErrC <- errGo
+		}
+	}()
+
+	for {
+		msg, errGo := stream.Receive()
+		if errGo != nil {
+			if !errors.Is(errGo, io.EOF) {
+				err = errGo
+			}
+			break
+		}
+		if err = recv(msg); err != nil {
+			cancel()
+			break
+		}
+	}
+	if errGo := stream.CloseResponse(); errGo != nil && err == nil {
+		err = errGo
+	}
+	if errGo := <-sendErrC; errGo != nil && err == nil {
+		err = errGo
+	}
+	return err
+}
+
+// Reset returns the counter to zero, when expected is not nil the server will fail with an
+// aborted error unless the counter holds the expected value
+func (client *Client) Reset(ctx context.Context, expected *int64) (resp *pingv1.ResetResponse, err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	result, err := client.rpc.Reset(ctx, connect.NewRequest(&pingv1.ResetRequest{Counter: client.counter, Expected64: expected}))
+	if err != nil {
+		return nil, err
+	}
+	return result.Msg, nil
+}
+
+// Set assigns the value to the counter, when expected is not nil the server will fail with an
+// aborted error unless the counter holds the expected value
+func (client *Client) Set(ctx context.Context, value int64, expected *int64) (resp *pingv1.SetResponse, err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	result, err := client.rpc.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Counter: client.counter, Value64: &value, Expected64: expected}))
+	if err != nil {
+		return nil, err
+	}
+	return result.Msg, nil
+}
+
+// Watch invokes recv with the current total of the counter and then every change made to it until
+// recv returns an error, the context is cancelled, or the client timeout expires
+func (client *Client) Watch(ctx context.Context, recv func(*pingv1.WatchResponse) error) (err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := client.rpc.Watch(ctx, connect.NewRequest(&pingv1.WatchRequest{Counter: client.counter}))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for stream.Receive() {
+		if err = recv(stream.Msg()); err != nil {
+			// Cancelling ends the stream so that closing it does not wait upon the server
+			cancel()
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// HardFail asks the server to fail with the supplied code, the returned error is
+// the one generated by the server and carries the requested error details, when none
+// are requested the server attaches an ErrorInfo and a DebugInfo
+func (client *Client) HardFail(ctx context.Context, code connect.Code, details ...pingv1.ErrorDetail) (err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	_, err = client.rpc.HardFail(ctx, connect.NewRequest(&pingv1.HardFailRequest{FailureCode: int32(code), Details: details}))
+	return err
+}
+
+// SetFaultRules replaces the fault injection rules of a server serving the FaultService
+func (client *Client) SetFaultRules(ctx context.Context, rules []*pingv1.FaultRule) (err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	_, err = client.fault.SetFaultRules(ctx, connect.NewRequest(&pingv1.SetFaultRulesRequest{Rules: rules}))
+	return err
+}
+
+// GetFaultRules returns the fault injection rules of a server serving the FaultService
+func (client *Client) GetFaultRules(ctx context.Context) (resp *pingv1.GetFaultRulesResponse, err error) {
+	ctx, cancel := client.withTimeout(ctx)
+	defer cancel()
+
+	result, err := client.fault.GetFaultRules(ctx, connect.NewRequest(&pingv1.GetFaultRulesRequest{}))
+	if err != nil {
+		return nil, err
+	}
+	return result.Msg, nil
+}
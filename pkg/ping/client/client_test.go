@@ -0,0 +1,183 @@
+package client
+
+// This file contains tests of the client, covering the validation of its options, the selection of
+// the protocol, and compression, used, and the handling of errors by the Count RPC whose requests
+// are sent concurrently with the receipt of its responses, and the sending of bearer tokens.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"connectrpc.com/connect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+)
+
+func TestNewClient(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if errGo := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	testCases := []struct {
+		name    string
+		addr    string
+		opts    Opts
+		isError bool
+	}{
+		{name: "defaults", addr: "localhost:8080"},
+		{name: "https", addr: "https://localhost:8080"},
+		{name: "h2c", addr: "http://localhost:8080"},
+		{name: "unix socket", addr: "unix:///tmp/ping.sock"},
+		{name: "connect", addr: "localhost:8080", opts: Opts{Protocol: ProtocolConnect}},
+		{name: "grpc", addr: "localhost:8080", opts: Opts{Protocol: ProtocolGRPC}},
+		{name: "grpc-web", addr: "localhost:8080", opts: Opts{Protocol: ProtocolGRPCWeb}},
+		{name: "unknown protocol", addr: "localhost:8080", opts: Opts{Protocol: "grpc-web"}, isError: true},
+		{name: "no compression", addr: "localhost:8080", opts: Opts{Compression: CompressionNone}},
+		{name: "gzip", addr: "localhost:8080", opts: Opts{Compression: CompressionGzip}},
+		{name: "unknown compression", addr: "localhost:8080", opts: Opts{Compression: "zstd"}, isError: true},
+		{name: "http3", addr: "localhost:8080", opts: Opts{HTTP3: true}},
+		{name: "http3 over h2c", addr: "http://localhost:8080", opts: Opts{HTTP3: true}, isError: true},
+		{name: "http3 over a unix socket", addr: "unix:///tmp/ping.sock", opts: Opts{HTTP3: true}, isError: true},
+		{name: "missing CA", addr: "localhost:8080", opts: Opts{CAFile: filepath.Join(dir, "missing.pem")}, isError: true},
+		{name: "CA without certificates", addr: "localhost:8080", opts: Opts{CAFile: notPEM}, isError: true},
+		{name: "certificate without a key", addr: "localhost:8080", opts: Opts{CertFile: notPEM}, isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(tc.addr, tc.opts)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatal("expected the options to be refused")
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if client.rpc == nil || client.fault == nil {
+				t.Fatal("expected the client to have service clients")
+			}
+		})
+	}
+}
+
+// countHandler answers every request of the Count RPC with the running total of its additions
+type countHandler struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (handler *countHandler) Count(ctx context.Context, stream *connect.BidiStream[pingv1.CountRequest, pingv1.CountResponse]) error {
+	sum := int64(0)
+	for {
+		msg, errGo := stream.Receive()
+		if errors.Is(errGo, io.EOF) {
+			return nil
+		}
+		if errGo != nil {
+			return errGo
+		}
+		sum += int64(msg.Addition)
+		if errGo = stream.Send(&pingv1.CountResponse{Sum: int32(sum), Sum64: sum}); errGo != nil {
+			return errGo
+		}
+	}
+}
+
+// newCountClient returns a client of a server answering the Count RPC, using the options of the
+// connect client
+func newCountClient(t *testing.T, opts ...connect.ClientOption) (client *Client) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&countHandler{}))
+	ts := httptest.NewUnstartedServer(mux)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	return &Client{rpc: pingv1connect.NewPingServiceClient(ts.Client(), ts.URL, opts...)}
+}
+
+func TestCount(t *testing.T) {
+	client := newCountClient(t)
+
+	sums := []int64{}
+	err := client.Count(context.Background(), []int32{1, 2, 3}, func(resp *pingv1.CountResponse) error {
+		sums = append(sums, resp.Sum64)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 3 || sums[0] != 1 || sums[1] != 3 || sums[2] != 6 {
+		t.Fatalf("expected the totals 1, 3, and 6, got %v", sums)
+	}
+}
+
+// TestCountSendError checks that a request that cannot be sent fails the RPC, even though the
+// server sees the requests end and completes the stream successfully
+func TestCountSendError(t *testing.T) {
+	client := newCountClient(t, connect.WithSendMaxBytes(1))
+	client.counter = "a counter name longer than the send limit"
+
+	received := 0
+	err := client.Count(context.Background(), []int32{1, 2}, func(resp *pingv1.CountResponse) error {
+		received++
+		return nil
+	})
+	if code := connect.CodeOf(err); code != connect.CodeResourceExhausted {
+		t.Fatalf("expected a %s error, got %v", connect.CodeResourceExhausted, err)
+	}
+	if received != 0 {
+		t.Fatalf("expected no responses, got %d", received)
+	}
+}
+
+// TestCountRecvError checks that the error of the receiving function ends the RPC, and is returned
+func TestCountRecvError(t *testing.T) {
+	client := newCountClient(t)
+
+	errStop := errors.New("stop receiving")
+	received := 0
+	err := client.Count(context.Background(), []int32{1, 2, 3}, func(resp *pingv1.CountResponse) error {
+		received++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the error of the receiving function, got %v", err)
+	}
+	if received != 1 {
+		t.Fatalf("expected receiving to stop after the first response, got %d", received)
+	}
+}
+
+func TestTokenInterceptor(t *testing.T) {
+	authorization := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	ts := httptest.NewUnstartedServer(mux)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := &Client{rpc: pingv1connect.NewPingServiceClient(ts.Client(), ts.URL, connect.WithInterceptors(newTokenInterceptor("a-token")))}
+	if _, err := client.Ping(context.Background()); err == nil {
+		t.Fatal("expected the Ping to fail")
+	}
+	if header := <-authorization; header != "Bearer a-token" {
+		t.Fatalf("expected the bearer token to be sent, got %q", header)
+	}
+}
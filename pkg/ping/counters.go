@@ -0,0 +1,218 @@
+package ping
+
+// This file contains the named counters maintained by the PingServer.  Counters
+// are identified by the name given in requests, optionally scoped by the tenant
+// of the caller so that callers sharing a server do not interfere with each other.
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// CounterScope selects how counters are partitioned between callers
+type CounterScope string
+
+const (
+	// ScopeNone shares counters between all callers
+	ScopeNone CounterScope = "none"
+	// ScopeTenant partitions counters using the tenant of the authenticated caller
+	ScopeTenant CounterScope = "tenant"
+	// ScopeBaggage partitions counters using a member of the OTel baggage sent by the caller
+	ScopeBaggage CounterScope = "baggage"
+)
+
+// OverflowPolicy selects how changes that would take a counter beyond the range of an int64 are handled
+type OverflowPolicy string
+
+const (
+	// OverflowSaturate holds the counter at the limit it would have passed
+	OverflowSaturate OverflowPolicy = "saturate"
+	// OverflowWrap applies the change using two's complement arithmetic, wrapping the counter around
+	OverflowWrap OverflowPolicy = "wrap"
+	// OverflowReject leaves the counter unchanged and fails the RPC with an out of range error
+	OverflowReject OverflowPolicy = "reject"
+)
+
+// DefaultMaxCounters is the limit on the number of counters used when none is configured
+const DefaultMaxCounters = 10000
+
+// Counter names are restricted so that they cannot collide with the tenant portion of a key
+var validCounterName = regexp.MustCompile(`^[A-Za-z0-9._-]{0,64}$`)
+
+// counter is a single running total
+type counter struct {
+	// total is accessed atomically and is kept first so that it is 64-bit aligned on all platforms
+	total int64
+	key   string
+
+	// The mutex serializes changes to the total so that watchers observe them in the
+	// order they were made, the total itself remains readable using atomic loads
+	sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// scopeOf returns the partition of the counters used by the caller
+func (server *PingServer) scopeOf(ctx context.Context) (scope string) {
+	switch server.scope {
+	case ScopeTenant:
+		return auth.Tenant(ctx, server.tenantClaim)
+	case ScopeBaggage:
+		return baggage.FromContext(ctx).Member(server.baggageKey).Value()
+	}
+	return ""
+}
+
+// counter returns the counter for the name within the callers scope.  Counters that do not
+// yet exist are only created when create is true, otherwise nil is returned.
+func (server *PingServer) counter(ctx context.Context, name string, create bool) (c *counter, err error) {
+	if !validCounterName.MatchString(name) {
+		err := kv.NewError("counter names must contain at most 64 letters, digits, '.', '_', or '-'").With("counter", name, "stack", stack.Trace().TrimRuntime())
+		return nil, rpcerr.AddBadRequest(rpcerr.New(connect.CodeInvalidArgument, "INVALID_COUNTER_NAME", err),
+			"counter", "must contain at most 64 letters, digits, '.', '_', or '-'")
+	}
+
+	key := server.keyOf(ctx, name)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("pingbuf.counter", key))
+
+	server.Lock()
+	defer server.Unlock()
+
+	if c, isPresent := server.counters[key]; isPresent || !create {
+		return c, nil
+	}
+	if len(server.counters) >= server.maxCounters {
+		return nil, rpcerr.New(connect.CodeResourceExhausted, "COUNTER_LIMIT_REACHED",
+			kv.NewError("counter limit reached").With("limit", server.maxCounters, "stack", stack.Trace().TrimRuntime()))
+	}
+	c = &counter{key: key}
+	server.counters[key] = c
+	return c, nil
+}
+
+// keyOf returns the key a counter is held under, the name prefixed by the scope of the caller
+// when counters are scoped
+func (server *PingServer) keyOf(ctx context.Context, name string) (key string) {
+	if scope := server.scopeOf(ctx); len(scope) != 0 {
+		return scope + "/" + name
+	}
+	return name
+}
+
+// load returns the current total of a counter, a nil counter has a total of zero
+func (c *counter) load() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.total)
+}
+
+// clamp32 limits a value to the range of the int32 fields retained for compatibility with
+// clients that predate the int64 fields
+func clamp32(value int64) int32 {
+	switch {
+	case value > math.MaxInt32:
+		return math.MaxInt32
+	case value < math.MinInt32:
+		return math.MinInt32
+	}
+	return int32(value)
+}
+
+// add records the change to the counter in the store before applying it, returning the new total.
+// Changes that overflow the counter are handled using the overflow policy of the server.  The
+// procedure is that of the RPC making the change and is passed on to watchers.
+func (server *PingServer) add(ctx context.Context, c *counter, delta int64, procedure string) (total int64, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	current := atomic.LoadInt64(&c.total)
+	total = current + delta
+	if (delta > 0 && total < current) || (delta < 0 && total > current) {
+		apiOverflowCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("pingbuf.overflow.policy", string(server.overflow))))
+
+		switch server.overflow {
+		case OverflowReject:
+			return 0, rpcerr.New(connect.CodeOutOfRange, "COUNTER_OVERFLOW",
+				kv.NewError("counter overflow").With("counter", c.key, "total", current, "delta", delta, "stack", stack.Trace().TrimRuntime()))
+		case OverflowSaturate:
+			total = math.MaxInt64
+			if delta < 0 {
+				total = math.MinInt64
+			}
+			delta = total - current
+		}
+	}
+
+	if errKV := server.store.Add(c.key, delta); errKV != nil {
+		server.loggerFrom(ctx).WarnContext(ctx, "counter state could not be recorded", "counter", c.key, "error", errKV.Error())
+		return 0, errStoreUnavailable(errKV)
+	}
+
+	atomic.StoreInt64(&c.total, total)
+	c.publish(change{total: total, delta: delta, procedure: procedure})
+	return total, nil
+}
+
+// set assigns the value to the counter when expected is nil, or matches the current total.  The
+// counter is locked while the store records the difference from the replaced total so that
+// the comparison and the change are atomic.
+func (server *PingServer) set(ctx context.Context, c *counter, expected *int64, value int64, procedure string) (total int64, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	current := atomic.LoadInt64(&c.total)
+	if expected != nil && *expected != current {
+		return 0, errUnexpectedTotal(c.key, *expected, current)
+	}
+
+	delta := value - current
+	if errKV := server.store.Add(c.key, delta); errKV != nil {
+		server.loggerFrom(ctx).WarnContext(ctx, "counter state could not be recorded", "counter", c.key, "error", errKV.Error())
+		return 0, errStoreUnavailable(errKV)
+	}
+	atomic.StoreInt64(&c.total, value)
+	c.publish(change{total: value, delta: delta, procedure: procedure})
+	return value, nil
+}
+
+// expectedOf returns the expected total of a compare-and-swap, preferring the 64-bit field of the
+// request to the 32-bit field, nil is returned when neither is present
+func expectedOf(expected32 *int32, expected64 *int64) (expected *int64) {
+	if expected64 != nil {
+		return expected64
+	}
+	if expected32 != nil {
+		expected = new(int64)
+		*expected = int64(*expected32)
+	}
+	return expected
+}
+
+// errStoreUnavailable is returned when a change could not be recorded, the failure is usually
+// transient so clients are advised to retry
+func errStoreUnavailable(errKV kv.Error) (err error) {
+	return rpcerr.AddRetryInfo(rpcerr.New(connect.CodeUnavailable, "COUNTER_STATE_UNAVAILABLE", errKV), time.Second)
+}
+
+// errUnexpectedTotal is returned when a compare-and-swap fails
+func errUnexpectedTotal(key string, expected int64, actual int64) (err error) {
+	return rpcerr.New(connect.CodeAborted, "UNEXPECTED_TOTAL",
+		kv.NewError("counter does not hold the expected value").With("counter", key, "expected", expected, "actual", actual, "stack", stack.Trace().TrimRuntime()))
+}
@@ -0,0 +1,286 @@
+package ping
+
+// This file contains tests of the handling of changes that overflow a counter, and of the
+// 64-bit values accepted by the Set, and Reset, RPCs, and their comparisons with counters that do
+// not yet exist.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+)
+
+var (
+	metricReader     *sdkmetric.ManualReader
+	metricReaderOnce sync.Once
+)
+
+// collectMetrics returns the metrics recorded by the package, installing a meter provider that
+// records them on first use
+func collectMetrics(t *testing.T) (rm metricdata.ResourceMetrics) {
+	t.Helper()
+
+	metricReaderOnce.Do(func() {
+		metricReader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)))
+	})
+
+	if errGo := metricReader.Collect(context.Background(), &rm); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return rm
+}
+
+// counterValue returns the total recorded by the named counter metric for the data point with the
+// attribute
+func counterValue(t *testing.T, name string, attr attribute.KeyValue) (value int64) {
+	t.Helper()
+
+	rm := collectMetrics(t)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, isSum := m.Data.(metricdata.Sum[int64])
+			if !isSum {
+				t.Fatalf("metric %s is not an int64 counter", name)
+			}
+			for _, dp := range sum.DataPoints {
+				if v, isPresent := dp.Attributes.Value(attr.Key); isPresent && v == attr.Value {
+					value += dp.Value
+				}
+			}
+		}
+	}
+	return value
+}
+
+func TestOverflow(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy OverflowPolicy
+		start  int64
+		delta  int64
+		code   connect.Code
+		total  int64
+	}{
+		{name: "saturate above", policy: OverflowSaturate, start: math.MaxInt64 - 1, delta: 5, total: math.MaxInt64},
+		{name: "saturate below", policy: OverflowSaturate, start: math.MinInt64 + 1, delta: -5, total: math.MinInt64},
+		{name: "wrap above", policy: OverflowWrap, start: math.MaxInt64 - 1, delta: 5, total: math.MinInt64 + 3},
+		{name: "wrap below", policy: OverflowWrap, start: math.MinInt64 + 1, delta: -5, total: math.MaxInt64 - 3},
+		{name: "reject above", policy: OverflowReject, start: math.MaxInt64 - 1, delta: 5, code: connect.CodeOutOfRange, total: math.MaxInt64 - 1},
+		{name: "reject below", policy: OverflowReject, start: math.MinInt64 + 1, delta: -5, code: connect.CodeOutOfRange, total: math.MinInt64 + 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			policy := attribute.String("pingbuf.overflow.policy", string(tc.policy))
+			overflows := counterValue(t, "pingbuf.counter.overflow.counter", policy)
+
+			server := newTestServer(t, PingServerOpts{Overflow: tc.policy})
+			if _, err := server.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Value64: &tc.start})); err != nil {
+				t.Fatal(err)
+			}
+			c, err := server.counter(ctx, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Changes within the range of the counter are not overflows
+			if _, err = server.add(ctx, c, 0, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if counted := counterValue(t, "pingbuf.counter.overflow.counter", policy) - overflows; counted != 0 {
+				t.Fatalf("expected no overflow to be counted, got %d", counted)
+			}
+
+			total, err := server.add(ctx, c, tc.delta, "test")
+			switch {
+			case tc.code == 0 && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tc.code != 0 && connect.CodeOf(err) != tc.code:
+				t.Fatalf("expected a %s error, got %v", tc.code, err)
+			case tc.code == 0 && total != tc.total:
+				t.Fatalf("expected a total of %d, got %d", tc.total, total)
+			}
+
+			resp, err := server.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Msg.Sum64 != tc.total {
+				t.Fatalf("expected the counter to hold %d, got %d", tc.total, resp.Msg.Sum64)
+			}
+			if counted := counterValue(t, "pingbuf.counter.overflow.counter", policy) - overflows; counted != 1 {
+				t.Fatalf("expected a single overflow to be counted, got %d", counted)
+			}
+		})
+	}
+}
+
+func TestSetFields(t *testing.T) {
+	int32Of := func(value int32) *int32 { return &value }
+	int64Of := func(value int64) *int64 { return &value }
+
+	testCases := []struct {
+		name string
+		req  *pingv1.SetRequest
+		code connect.Code
+		sum  int64
+	}{
+		{name: "int32 value", req: &pingv1.SetRequest{Value: 7}, sum: 7},
+		{name: "int64 value", req: &pingv1.SetRequest{Value64: int64Of(math.MaxInt64)}, sum: math.MaxInt64},
+		{name: "int64 value used in place of int32", req: &pingv1.SetRequest{Value: 7, Value64: int64Of(0)}, sum: 0},
+		{name: "int32 expected", req: &pingv1.SetRequest{Value: 7, Expected: int32Of(1)}, sum: 7},
+		{name: "int64 expected", req: &pingv1.SetRequest{Value: 7, Expected64: int64Of(1)}, sum: 7},
+		{name: "int64 expected used in place of int32", req: &pingv1.SetRequest{Value: 7, Expected: int32Of(1), Expected64: int64Of(2)}, code: connect.CodeAborted, sum: 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := newTestServer(t, PingServerOpts{})
+			if _, err := server.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Value: 1})); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := server.Set(ctx, connect.NewRequest(tc.req))
+			switch {
+			case tc.code == 0 && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tc.code != 0 && connect.CodeOf(err) != tc.code:
+				t.Fatalf("expected a %s error, got %v", tc.code, err)
+			}
+
+			resp, err := server.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Msg.Sum64 != tc.sum {
+				t.Fatalf("expected the counter to hold %d, got %d", tc.sum, resp.Msg.Sum64)
+			}
+		})
+	}
+}
+
+func TestResetFields(t *testing.T) {
+	int32Of := func(value int32) *int32 { return &value }
+	int64Of := func(value int64) *int64 { return &value }
+
+	testCases := []struct {
+		name string
+		req  *pingv1.ResetRequest
+		code connect.Code
+		sum  int64
+	}{
+		{name: "unconditional", req: &pingv1.ResetRequest{}},
+		{name: "int32 expected", req: &pingv1.ResetRequest{Expected: int32Of(-1)}, code: connect.CodeAborted, sum: math.MaxInt64},
+		{name: "int64 expected", req: &pingv1.ResetRequest{Expected64: int64Of(math.MaxInt64)}},
+		{name: "int64 expected used in place of int32", req: &pingv1.ResetRequest{Expected: int32Of(math.MaxInt32), Expected64: int64Of(math.MaxInt64)}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := newTestServer(t, PingServerOpts{})
+			if _, err := server.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Value64: int64Of(math.MaxInt64)})); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := server.Reset(ctx, connect.NewRequest(tc.req))
+			switch {
+			case tc.code == 0 && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tc.code != 0 && connect.CodeOf(err) != tc.code:
+				t.Fatalf("expected a %s error, got %v", tc.code, err)
+			}
+
+			resp, err := server.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Msg.Sum64 != tc.sum {
+				t.Fatalf("expected the counter to hold %d, got %d", tc.sum, resp.Msg.Sum64)
+			}
+		})
+	}
+}
+
+func TestCompareMissingCounter(t *testing.T) {
+	int64Of := func(value int64) *int64 { return &value }
+
+	testCases := []struct {
+		name string
+		call func(ctx context.Context, server *PingServer) error
+	}{
+		{
+			name: "set",
+			call: func(ctx context.Context, server *PingServer) (err error) {
+				_, err = server.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Counter: "missing", Value: 1, Expected64: int64Of(5)}))
+				return err
+			},
+		},
+		{
+			name: "reset",
+			call: func(ctx context.Context, server *PingServer) (err error) {
+				_, err = server.Reset(ctx, connect.NewRequest(&pingv1.ResetRequest{Counter: "missing", Expected64: int64Of(5)}))
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := auth.ContextWithClaims(context.Background(), jwt.MapClaims{"tenant": "acme"})
+			server := newTestServer(t, PingServerOpts{Scope: ScopeTenant, MaxCounters: 1})
+
+			err := tc.call(ctx, server)
+			if code := connect.CodeOf(err); code != connect.CodeAborted {
+				t.Fatalf("expected a %s error, got %v", connect.CodeAborted, err)
+			}
+			connectErr := &connect.Error{}
+			if !errors.As(err, &connectErr) {
+				t.Fatalf("expected a connect error, got %v", err)
+			}
+			key := ""
+			for _, detail := range connectErr.Details() {
+				value, errGo := detail.Value()
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				if info, isInfo := value.(*errdetails.ErrorInfo); isInfo {
+					key = info.GetMetadata()["counter"]
+				}
+			}
+			if key != "acme/missing" {
+				t.Fatalf("expected the error to name the counter acme/missing, got %q", key)
+			}
+
+			// The failed comparison does not create the counter, leaving room for another
+			if _, err = server.Set(ctx, connect.NewRequest(&pingv1.SetRequest{Counter: "other", Value: 1})); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package ping
+
+// This file contains a connectrpc interceptor recording the latency, and stream, metrics
+// of PingService RPCs, labelled with the procedure and the code the RPC ended with, so
+// that SLOs can be measured from the server independently of otelconnect.  The current
+// total of every counter is also reported as a gauge.
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+)
+
+var (
+	apiDurationHistogram       metric.Float64Histogram
+	apiStreamDurationHistogram metric.Float64Histogram
+	apiStreamMessagesHistogram metric.Int64Histogram
+	apiFirstMessageHistogram   metric.Float64Histogram
+	apiActiveStreams           metric.Int64UpDownCounter
+	apiTotalGauge              metric.Int64ObservableGauge
+)
+
+// firstMessageProcedures are the streams whose time to first message is recorded, those that
+// compute their responses rather than waiting upon changes, or a single final response
+var firstMessageProcedures = map[string]struct{}{
+	pingv1connect.PingServiceGenerateProcedure: {},
+	pingv1connect.PingServiceCountProcedure:    {},
+}
+
+func init() {
+	apiDurationHistogram, _ = apiPing.Float64Histogram(
+		"pingbuf.rpc.duration",
+		metric.WithDescription("Latency of unary API calls handled."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	apiStreamDurationHistogram, _ = apiPing.Float64Histogram(
+		"pingbuf.rpc.stream.duration",
+		metric.WithDescription("Duration of streaming API calls handled."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600),
+	)
+	apiStreamMessagesHistogram, _ = apiPing.Int64Histogram(
+		"pingbuf.rpc.stream.messages",
+		metric.WithDescription("Number of messages sent, and received, by each streaming API call."),
+		metric.WithUnit("{message}"),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 10000, 100000),
+	)
+	apiFirstMessageHistogram, _ = apiPing.Float64Histogram(
+		"pingbuf.rpc.stream.first_message",
+		metric.WithDescription("Time from the start of Generate, and Count, API calls to their first response message."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	apiActiveStreams, _ = apiPing.Int64UpDownCounter(
+		"pingbuf.rpc.stream.active",
+		metric.WithDescription("Number of streaming API calls in progress."),
+		metric.WithUnit("{call}"),
+	)
+	apiTotalGauge, _ = apiPing.Int64ObservableGauge(
+		"pingbuf.counter.total",
+		metric.WithDescription("Current total of each counter."),
+		metric.WithUnit("{count}"),
+	)
+}
+
+// observeTotals reports the total of every counter to the gauge, it is registered as a callback
+// by NewPingServer
+func (server *PingServer) observeTotals(_ context.Context, observer metric.Observer) (errGo error) {
+	server.Lock()
+	counters := make([]*counter, 0, len(server.counters))
+	for _, c := range server.counters {
+		counters = append(counters, c)
+	}
+	server.Unlock()
+
+	for _, c := range counters {
+		observer.ObserveInt64(apiTotalGauge, c.load(), metric.WithAttributes(attribute.String("pingbuf.counter", c.key)))
+	}
+	return nil
+}
+
+// codeOf returns the code an RPC ended with, ok when it succeeded.  Handlers ended by their
+// context return its error, which connect only converts into a code once the RPC is answered.
+func codeOf(err error) string {
+	connectErr := &connect.Error{}
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &connectErr):
+		return connectErr.Code().String()
+	case errors.Is(err, context.Canceled):
+		return connect.CodeCanceled.String()
+	case errors.Is(err, context.DeadlineExceeded):
+		return connect.CodeDeadlineExceeded.String()
+	}
+	return connect.CodeOf(err).String()
+}
+
+// MetricsInterceptor records the latency, and stream, metrics of the RPCs it handles
+type MetricsInterceptor struct{}
+
+// NewMetricsInterceptor returns an interceptor recording the metrics of handled RPCs, only RPCs
+// reaching it are measured so interceptors whose rejections should be measured are placed
+// after it
+func NewMetricsInterceptor() (interceptor *MetricsInterceptor) {
+	return &MetricsInterceptor{}
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (interceptor *MetricsInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		resp, err := next(ctx, req)
+
+		apiDurationHistogram.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("rpc.procedure", req.Spec().Procedure),
+			attribute.String("rpc.code", codeOf(err)),
+		))
+		return resp, err
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (interceptor *MetricsInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs
+func (interceptor *MetricsInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		procedure := conn.Spec().Procedure
+		active := metric.WithAttributes(attribute.String("rpc.procedure", procedure))
+
+		apiActiveStreams.Add(ctx, 1, active)
+		defer apiActiveStreams.Add(ctx, -1, active)
+
+		metered := &meteredConn{StreamingHandlerConn: conn, start: time.Now()}
+		err := next(ctx, metered)
+
+		attrs := []attribute.KeyValue{
+			attribute.String("rpc.procedure", procedure),
+			attribute.String("rpc.code", codeOf(err)),
+		}
+		apiStreamDurationHistogram.Record(ctx, time.Since(metered.start).Seconds(), metric.WithAttributes(attrs...))
+		apiStreamMessagesHistogram.Record(ctx, metered.sent.Load(),
+			metric.WithAttributes(append(attrs, attribute.String("rpc.message.direction", "sent"))...))
+		apiStreamMessagesHistogram.Record(ctx, metered.received.Load(),
+			metric.WithAttributes(append(attrs, attribute.String("rpc.message.direction", "received"))...))
+
+		if _, isPresent := firstMessageProcedures[procedure]; isPresent {
+			if first := metered.firstSent.Load(); first != 0 {
+				apiFirstMessageHistogram.Record(ctx, time.Duration(first).Seconds(), metric.WithAttributes(attrs...))
+			}
+		}
+		return err
+	}
+}
+
+// meteredConn counts the messages of a stream, and the time taken to send the first of them.
+// The counts are atomic as bidirectional streams send, and receive, from different goroutines.
+type meteredConn struct {
+	connect.StreamingHandlerConn
+
+	start    time.Time
+	sent     atomic.Int64
+	received atomic.Int64
+	// firstSent is the time from the start of the stream to the first message sent
+	firstSent atomic.Int64
+}
+
+// Send implements the connect.StreamingHandlerConn interface
+func (conn *meteredConn) Send(msg any) (errGo error) {
+	if errGo = conn.StreamingHandlerConn.Send(msg); errGo == nil {
+		if conn.sent.Add(1) == 1 {
+			conn.firstSent.Store(int64(time.Since(conn.start)))
+		}
+	}
+	return errGo
+}
+
+// Receive implements the connect.StreamingHandlerConn interface
+func (conn *meteredConn) Receive(msg any) (errGo error) {
+	if errGo = conn.StreamingHandlerConn.Receive(msg); errGo == nil {
+		conn.received.Add(1)
+	}
+	return errGo
+}
@@ -0,0 +1,271 @@
+package ping
+
+// This file contains tests of the SLO metrics recorded for PingService RPCs, covering the labels
+// of the latency, and stream, histograms, the count of active streams, the time to the first
+// message of a stream, and the reporting of counter totals.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+)
+
+// newMeteredClient returns a client of a server whose RPCs pass through the metrics interceptor
+func newMeteredClient(t *testing.T) (client pingv1connect.PingServiceClient) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(newTestServer(t, PingServerOpts{}), connect.WithInterceptors(NewMetricsInterceptor())))
+	ts := httptest.NewUnstartedServer(mux)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	return pingv1connect.NewPingServiceClient(ts.Client(), ts.URL)
+}
+
+// histogramOf returns the count, and sum, of the named histogram metric over the data points
+// having every one of the attributes
+func histogramOf(t *testing.T, name string, attrs ...attribute.KeyValue) (count uint64, sum float64) {
+	t.Helper()
+
+	isMatch := func(set attribute.Set) bool {
+		for _, attr := range attrs {
+			if v, isPresent := set.Value(attr.Key); !isPresent || v != attr.Value {
+				return false
+			}
+		}
+		return true
+	}
+
+	rm := collectMetrics(t)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					if isMatch(dp.Attributes) {
+						count += dp.Count
+						sum += dp.Sum
+					}
+				}
+			case metricdata.Histogram[int64]:
+				for _, dp := range data.DataPoints {
+					if isMatch(dp.Attributes) {
+						count += dp.Count
+						sum += float64(dp.Sum)
+					}
+				}
+			default:
+				t.Fatalf("metric %s is not a histogram", name)
+			}
+		}
+	}
+	return count, sum
+}
+
+func TestMetricsUnary(t *testing.T) {
+	client := newMeteredClient(t)
+
+	testCases := []struct {
+		name      string
+		call      func(ctx context.Context) error
+		procedure string
+		code      string
+	}{
+		{
+			name: "ok",
+			call: func(ctx context.Context) (err error) {
+				_, err = client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Counter: "metrics-unary"}))
+				return err
+			},
+			procedure: pingv1connect.PingServicePingProcedure,
+			code:      "ok",
+		},
+		{
+			name: "invalid argument",
+			call: func(ctx context.Context) (err error) {
+				_, err = client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Counter: "not a valid counter name"}))
+				return err
+			},
+			procedure: pingv1connect.PingServicePingProcedure,
+			code:      "invalid_argument",
+		},
+		{
+			name: "not found",
+			call: func(ctx context.Context) (err error) {
+				_, err = client.HardFail(ctx, connect.NewRequest(&pingv1.HardFailRequest{FailureCode: int32(connect.CodeNotFound)}))
+				return err
+			},
+			procedure: pingv1connect.PingServiceHardFailProcedure,
+			code:      "not_found",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := []attribute.KeyValue{attribute.String("rpc.procedure", tc.procedure), attribute.String("rpc.code", tc.code)}
+			before, _ := histogramOf(t, "pingbuf.rpc.duration", attrs...)
+
+			if err := tc.call(context.Background()); (err == nil) != (tc.code == "ok") {
+				t.Fatalf("unexpected outcome %v", err)
+			}
+			if after, _ := histogramOf(t, "pingbuf.rpc.duration", attrs...); after != before+1 {
+				t.Fatalf("expected a single latency to be recorded with %v, got %d", attrs, after-before)
+			}
+		})
+	}
+}
+
+func TestMetricsStream(t *testing.T) {
+	client := newMeteredClient(t)
+
+	procedure := attribute.String("rpc.procedure", pingv1connect.PingServiceGenerateProcedure)
+	ok := attribute.String("rpc.code", "ok")
+	sent := attribute.String("rpc.message.direction", "sent")
+	received := attribute.String("rpc.message.direction", "received")
+
+	durations, _ := histogramOf(t, "pingbuf.rpc.stream.duration", procedure, ok)
+	_, sentBefore := histogramOf(t, "pingbuf.rpc.stream.messages", procedure, ok, sent)
+	_, receivedBefore := histogramOf(t, "pingbuf.rpc.stream.messages", procedure, ok, received)
+	firsts, _ := histogramOf(t, "pingbuf.rpc.stream.first_message", procedure, ok)
+
+	stream, err := client.Generate(context.Background(), connect.NewRequest(&pingv1.GenerateRequest{Counter: "metrics-stream", Addition: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stream.Receive() {
+	}
+	if err = stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if errGo := stream.Close(); errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	if count, _ := histogramOf(t, "pingbuf.rpc.stream.duration", procedure, ok); count != durations+1 {
+		t.Fatalf("expected a single stream duration to be recorded, got %d", count-durations)
+	}
+	if _, sum := histogramOf(t, "pingbuf.rpc.stream.messages", procedure, ok, sent); sum != sentBefore+3 {
+		t.Fatalf("expected 3 messages to be recorded as sent, got %v", sum-sentBefore)
+	}
+	if _, sum := histogramOf(t, "pingbuf.rpc.stream.messages", procedure, ok, received); sum != receivedBefore+1 {
+		t.Fatalf("expected the request to be recorded as received, got %v", sum-receivedBefore)
+	}
+	count, sum := histogramOf(t, "pingbuf.rpc.stream.first_message", procedure, ok)
+	if count != firsts+1 {
+		t.Fatalf("expected a single time to the first message to be recorded, got %d", count-firsts)
+	}
+	if sum <= 0 {
+		t.Fatalf("expected a time to the first message, got %v", sum)
+	}
+}
+
+func TestMetricsActiveStreams(t *testing.T) {
+	client := newMeteredClient(t)
+
+	procedure := attribute.String("rpc.procedure", pingv1connect.PingServiceWatchProcedure)
+	before := counterValue(t, "pingbuf.rpc.stream.active", procedure)
+	firsts, _ := histogramOf(t, "pingbuf.rpc.stream.first_message", procedure)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, connect.NewRequest(&pingv1.WatchRequest{Counter: "metrics-active"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stream.Receive() {
+		t.Fatal(stream.Err())
+	}
+	if active := counterValue(t, "pingbuf.rpc.stream.active", procedure); active != before+1 {
+		t.Fatalf("expected 1 more active stream, got %d", active-before)
+	}
+
+	cancel()
+	stream.Close()
+
+	// The handler sees the cancellation, and the count drops, shortly after the client
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		active := counterValue(t, "pingbuf.rpc.stream.active", procedure)
+		if active == before {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the active streams to return to %d, got %d", before, active)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Watch waits upon changes so its time to the first message is not recorded
+	if count, _ := histogramOf(t, "pingbuf.rpc.stream.first_message", procedure); count != firsts {
+		t.Fatalf("expected no time to the first message of Watch to be recorded, got %d", count-firsts)
+	}
+	if count, _ := histogramOf(t, "pingbuf.rpc.stream.duration", procedure, attribute.String("rpc.code", "canceled")); count == 0 {
+		t.Fatal("expected the duration of the cancelled stream to be recorded")
+	}
+}
+
+// totalOf returns the total reported by the gauge for the counter, and whether it was reported
+func totalOf(t *testing.T, key string) (total int64, isPresent bool) {
+	t.Helper()
+
+	rm := collectMetrics(t)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "pingbuf.counter.total" {
+				continue
+			}
+			gauge, isGauge := m.Data.(metricdata.Gauge[int64])
+			if !isGauge {
+				t.Fatalf("metric %s is not an int64 gauge", m.Name)
+			}
+			for _, dp := range gauge.DataPoints {
+				if v, isFound := dp.Attributes.Value("pingbuf.counter"); isFound && v.AsString() == key {
+					return dp.Value, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestObserveTotals(t *testing.T) {
+	collectMetrics(t)
+
+	server := newTestServer(t, PingServerOpts{})
+	c, err := server.counter(context.Background(), "metrics-total", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.add(context.Background(), c, 5, pingv1connect.PingServiceSumProcedure); err != nil {
+		t.Fatal(err)
+	}
+
+	if total, isPresent := totalOf(t, c.key); !isPresent || total != 5 {
+		t.Fatalf("expected a total of 5 to be reported, got %d, %t", total, isPresent)
+	}
+
+	// Once closed the server no longer reports its counters, and closing it again does nothing
+	for i := 0; i != 2; i++ {
+		if err := server.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if total, isPresent := totalOf(t, c.key); isPresent {
+		t.Fatalf("expected no total to be reported once the server is closed, got %d", total)
+	}
+}
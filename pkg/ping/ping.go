@@ -6,21 +6,27 @@ import (
 	"io"
 	"log/slog"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
-	pingv1 "buf.build/gen/go/karlmutch/buf-ping/protocolbuffers/go/ping/v1"
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/go-stack/stack"
 	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+	"github.com/karlmutch/buf-ping/pkg/logging"
+	"github.com/karlmutch/buf-ping/pkg/ping/store"
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
 )
 
 var (
@@ -29,7 +35,13 @@ var (
 	apiSumCounter      metric.Int64Counter
 	apiGenerateCounter metric.Int64Counter
 	apiCountCounter    metric.Int64Counter
+	apiResetCounter    metric.Int64Counter
+	apiSetCounter      metric.Int64Counter
+	apiWatchCounter    metric.Int64Counter
 	apiFailCounter     metric.Int64Counter
+	apiOverflowCounter metric.Int64Counter
+
+	apiRateLimitedCounter metric.Int64Counter
 )
 
 func init() {
@@ -53,23 +65,172 @@ func init() {
 		metric.WithDescription("Number of Count API calls."),
 		metric.WithUnit("{call}"),
 	)
+	apiResetCounter, _ = apiPing.Int64Counter(
+		"pingbuf.api.reset.counter",
+		metric.WithDescription("Number of Reset API calls."),
+		metric.WithUnit("{call}"),
+	)
+	apiSetCounter, _ = apiPing.Int64Counter(
+		"pingbuf.api.set.counter",
+		metric.WithDescription("Number of Set API calls."),
+		metric.WithUnit("{call}"),
+	)
+	apiWatchCounter, _ = apiPing.Int64Counter(
+		"pingbuf.api.watch.counter",
+		metric.WithDescription("Number of Watch API calls."),
+		metric.WithUnit("{call}"),
+	)
 	apiFailCounter, _ = apiPing.Int64Counter(
 		"pingbuf.api.fail.counter",
 		metric.WithDescription("Number of HardFail API calls."),
 		metric.WithUnit("{call}"),
 	)
+	apiOverflowCounter, _ = apiPing.Int64Counter(
+		"pingbuf.counter.overflow.counter",
+		metric.WithDescription("Number of changes that would have overflowed a counter."),
+		metric.WithUnit("{event}"),
+	)
+	apiRateLimitedCounter, _ = apiPing.Int64Counter(
+		"pingbuf.api.ratelimited.counter",
+		metric.WithDescription("Number of API calls rejected by rate limiting."),
+		metric.WithUnit("{call}"),
+	)
+}
+
+// PingServerOpts contains the options used when creating a PingServer
+type PingServerOpts struct {
+	// Store persists the counters, when nil the counters are held only in memory
+	Store store.Store
+
+	// Scope selects how counters are partitioned between callers, default ScopeNone
+	Scope CounterScope
+	// TenantClaim is the bearer token claim used as the tenant with ScopeTenant, default auth.DefaultTenantClaim
+	TenantClaim string
+	// BaggageKey is the OTel baggage member used with ScopeBaggage, default "tenant"
+	BaggageKey string
+
+	// MaxCounters limits the number of counters, default DefaultMaxCounters
+	MaxCounters int
+	// Overflow selects the handling of changes that would overflow a counter, default OverflowReject
+	Overflow OverflowPolicy
+
+	// WatchBuffer is the number of changes buffered for each watcher, default DefaultWatchBuffer
+	WatchBuffer int
+	// SlowConsumer selects the handling of watchers whose buffer is full, default SlowConsumerDrop
+	SlowConsumer SlowConsumerPolicy
 }
 
 // PingServer is used to encapsulate a Ping Server implementation state using connectrpc receivers
 type PingServer struct {
 	logger slog.Logger
-	total  int32
+	store  store.Store
+
+	scope       CounterScope
+	tenantClaim string
+	baggageKey  string
+
+	maxCounters int
+	overflow    OverflowPolicy
+	counters    map[string]*counter
 	sync.Mutex
+
+	watchBuffer  int
+	slowConsumer SlowConsumerPolicy
+
+	// registration reports the totals of the counters to the gauge until the server is closed
+	registration metric.Registration
+}
+
+// NewPingServer returns a new PingServer instance with the counters recovered from its store
+func NewPingServer(logger slog.Logger, opts PingServerOpts) (server *PingServer, err kv.Error) {
+	server = &PingServer{
+		logger:      logger,
+		store:       opts.Store,
+		scope:       opts.Scope,
+		tenantClaim: opts.TenantClaim,
+		baggageKey:  opts.BaggageKey,
+		maxCounters: opts.MaxCounters,
+		overflow:    opts.Overflow,
+		counters:    map[string]*counter{},
+
+		watchBuffer:  opts.WatchBuffer,
+		slowConsumer: opts.SlowConsumer,
+	}
+	if server.store == nil {
+		server.store = store.NewMemory()
+	}
+
+	switch server.scope {
+	case "":
+		server.scope = ScopeNone
+	case ScopeNone, ScopeTenant, ScopeBaggage:
+	default:
+		return nil, kv.NewError("unknown counter scope").With("scope", server.scope, "stack", stack.Trace().TrimRuntime())
+	}
+	if len(server.baggageKey) == 0 {
+		server.baggageKey = "tenant"
+	}
+	if server.maxCounters <= 0 {
+		server.maxCounters = DefaultMaxCounters
+	}
+
+	switch server.overflow {
+	case "":
+		server.overflow = OverflowReject
+	case OverflowSaturate, OverflowWrap, OverflowReject:
+	default:
+		return nil, kv.NewError("unknown overflow policy").With("policy", server.overflow, "stack", stack.Trace().TrimRuntime())
+	}
+
+	switch server.slowConsumer {
+	case "":
+		server.slowConsumer = SlowConsumerDrop
+	case SlowConsumerDrop, SlowConsumerDisconnect:
+	default:
+		return nil, kv.NewError("unknown slow consumer policy").With("policy", server.slowConsumer, "stack", stack.Trace().TrimRuntime())
+	}
+	if server.watchBuffer <= 0 {
+		server.watchBuffer = DefaultWatchBuffer
+	}
+
+	totals, err := server.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for key, total := range totals {
+		server.counters[key] = &counter{key: key, total: total}
+	}
+
+	registration, errGo := apiPing.RegisterCallback(server.observeTotals, apiTotalGauge)
+	if errGo != nil {
+		return nil, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	server.registration = registration
+	return server, nil
+}
+
+// Close stops the reporting of the totals of the counters, it is called once the server is no
+// longer handling RPCs and can be called more than once
+func (server *PingServer) Close() (err kv.Error) {
+	server.Lock()
+	registration := server.registration
+	server.registration = nil
+	server.Unlock()
+
+	if registration == nil {
+		return nil
+	}
+	if errGo := registration.Unregister(); errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return nil
 }
 
-// NewPingServer returns a new PingServer instance
-func NewPingServer(logger slog.Logger) *PingServer {
-	return &PingServer{logger: logger}
+// loggerFrom returns the logger placed into the context of the RPC by the logging interceptor,
+// annotated with the procedure and peer, or the server logger when there is none.  Records
+// should be logged using the context so that they carry the trace, and span, of the RPC.
+func (server *PingServer) loggerFrom(ctx context.Context) (logger *slog.Logger) {
+	return logging.LoggerFromContext(ctx, &server.logger)
 }
 
 // Ping receives a client ping for the server to determine if it's reachable and will return the sum from previous requests
@@ -78,8 +239,22 @@ func (server *PingServer) Ping(ctx context.Context, req *connect.Request[pingv1.
 
 	apiPingCounter.Add(ctx, 1)
 
+	// Claims from a validated bearer token are available to handlers using the context
+	if claims, isPresent := auth.ClaimsFromContext(ctx); isPresent {
+		if subject, errGo := claims.GetSubject(); errGo == nil && len(subject) != 0 {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", subject))
+		}
+	}
+
+	c, err := server.counter(ctx, req.Msg.Counter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := c.load()
 	respMsg := &pingv1.PingResponse{
-		Sum: atomic.LoadInt32(&server.total),
+		Sum:   clamp32(sum),
+		Sum64: sum,
 		Timestamp: &timestamppb.Timestamp{
 			Seconds: time.Now().Unix(),
 			Nanos:   int32(time.Now().Nanosecond()),
@@ -96,15 +271,30 @@ func (server *PingServer) Sum(ctx context.Context, reqStream *connect.ClientStre
 
 	apiSumCounter.Add(ctx, 1)
 
+	// Each message can name its own counter, the total returned is that of the
+	// counter named by the final message
+	var c *counter
 	for reqStream.Receive() {
-		atomic.AddInt32(&server.total, reqStream.Msg().Addition)
+		if c, err = server.counter(ctx, reqStream.Msg().Counter, true); err != nil {
+			return nil, err
+		}
+		if _, err = server.add(ctx, c, int64(reqStream.Msg().Addition), pingv1connect.PingServiceSumProcedure); err != nil {
+			return nil, err
+		}
 	}
 	if reqStream.Err() != nil {
 		return nil, reqStream.Err()
 	}
+	if c == nil {
+		if c, err = server.counter(ctx, "", false); err != nil {
+			return nil, err
+		}
+	}
 
+	sum := c.load()
 	resp = connect.NewResponse(&pingv1.SumResponse{
-		Sum: atomic.LoadInt32(&server.total),
+		Sum:   clamp32(sum),
+		Sum64: sum,
 	})
 	return resp, nil
 }
@@ -115,10 +305,19 @@ func (server *PingServer) Generate(ctx context.Context, req *connect.Request[pin
 
 	apiGenerateCounter.Add(ctx, 1)
 
+	c, err := server.counter(ctx, req.Msg.Counter, true)
+	if err != nil {
+		return err
+	}
+
 	for i := int64(0); i < int64(req.Msg.Addition); i++ {
-		atomic.AddInt32(&server.total, 1)
+		progress, err := server.add(ctx, c, 1, pingv1connect.PingServiceGenerateProcedure)
+		if err != nil {
+			return err
+		}
 		errGo := respStream.Send(&pingv1.GenerateResponse{
-			Progress: atomic.LoadInt32(&server.total),
+			Progress:   clamp32(progress),
+			Progress64: progress,
 		})
 		if errGo != nil {
 			return errGo
@@ -147,13 +346,21 @@ func (server *PingServer) Count(ctx context.Context, stream *connect.BidiStream[
 			span.AddEvent("counting in bulk, will not be generating individual OTel events")
 		}
 
+		c, err := server.counter(ctx, msg.Counter, true)
+		if err != nil {
+			return err
+		}
+
 		for i := int32(0); i != msg.Addition; i++ {
 			if msg.Addition < 10 {
 				span.AddEvent("counting")
 			}
 
-			resp := &pingv1.CountResponse{Sum: atomic.AddInt32(&server.total, 1)}
-			if errGo := stream.Send(resp); errGo != nil {
+			sum, err := server.add(ctx, c, 1, pingv1connect.PingServiceCountProcedure)
+			if err != nil {
+				return err
+			}
+			if errGo := stream.Send(&pingv1.CountResponse{Sum: clamp32(sum), Sum64: sum}); errGo != nil {
 				return errGo
 			}
 		}
@@ -161,6 +368,69 @@ func (server *PingServer) Count(ctx context.Context, stream *connect.BidiStream[
 
 }
 
+// Reset returns a counter to zero, if an expected value is supplied the reset is only applied when the
+// counter holds that value, otherwise an aborted error is returned
+func (server *PingServer) Reset(ctx context.Context, req *connect.Request[pingv1.ResetRequest],
+) (resp *connect.Response[pingv1.ResetResponse], err error) {
+
+	apiResetCounter.Add(ctx, 1)
+
+	c, err := server.counter(ctx, req.Msg.Counter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := expectedOf(req.Msg.Expected, req.Msg.Expected64)
+
+	sum := int64(0)
+	if c != nil {
+		if sum, err = server.set(ctx, c, expected, 0, pingv1connect.PingServiceResetProcedure); err != nil {
+			return nil, err
+		}
+	} else if expected != nil && *expected != 0 {
+		// Counters that have never been used hold zero and need not be created to be reset
+		return nil, errUnexpectedTotal(server.keyOf(ctx, req.Msg.Counter), *expected, 0)
+	}
+
+	return connect.NewResponse(&pingv1.ResetResponse{Sum: clamp32(sum), Sum64: sum}), nil
+}
+
+// Set assigns a value to a counter, if an expected value is supplied the value is only applied when the
+// counter holds the expected value, otherwise an aborted error is returned
+func (server *PingServer) Set(ctx context.Context, req *connect.Request[pingv1.SetRequest],
+) (resp *connect.Response[pingv1.SetResponse], err error) {
+
+	apiSetCounter.Add(ctx, 1)
+
+	c, err := server.counter(ctx, req.Msg.Counter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := expectedOf(req.Msg.Expected, req.Msg.Expected64)
+	if c == nil {
+		// Counters that have never been used hold zero, they are only created once the expected
+		// value is known to match so that failed attempts do not use up the counter limit
+		if expected != nil && *expected != 0 {
+			return nil, errUnexpectedTotal(server.keyOf(ctx, req.Msg.Counter), *expected, 0)
+		}
+		if c, err = server.counter(ctx, req.Msg.Counter, true); err != nil {
+			return nil, err
+		}
+	}
+
+	value := int64(req.Msg.Value)
+	if req.Msg.Value64 != nil {
+		value = *req.Msg.Value64
+	}
+
+	sum, err := server.set(ctx, c, expected, value, pingv1connect.PingServiceSetProcedure)
+	if err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&pingv1.SetResponse{Sum: clamp32(sum), Sum64: sum}), nil
+}
+
 // HardFail generates an error and returns it to the client when invoked
 func (server *PingServer) HardFail(ctx context.Context, req *connect.Request[pingv1.HardFailRequest],
 ) (resp *connect.Response[pingv1.HardFailResponse], err error) {
@@ -169,8 +439,32 @@ func (server *PingServer) HardFail(ctx context.Context, req *connect.Request[pin
 
 	// Use OTel span state to post an error event
 	trace.SpanFromContext(ctx).SetStatus(codes.Error, "HardFail invoked")
+	server.loggerFrom(ctx).InfoContext(ctx, "intentional failure requested", "code", connect.Code(req.Msg.FailureCode).String())
+
+	errKV := kv.NewError("intentional failure").With("code", req.Msg.FailureCode, "stack", stack.Trace().TrimRuntime())
+	connectErr := rpcerr.NewError(connect.Code(req.Msg.FailureCode), errKV)
+
+	// Clients select the error details so that they can test their decoding of each type
+	details := req.Msg.Details
+	if len(details) == 0 {
+		details = []pingv1.ErrorDetail{pingv1.ErrorDetail_ERROR_DETAIL_ERROR_INFO, pingv1.ErrorDetail_ERROR_DETAIL_DEBUG_INFO}
+	}
+	for _, detail := range details {
+		switch detail {
+		case pingv1.ErrorDetail_ERROR_DETAIL_ERROR_INFO:
+			rpcerr.AddErrorInfo(connectErr, "INTENTIONAL_FAILURE", errKV)
+		case pingv1.ErrorDetail_ERROR_DETAIL_RETRY_INFO:
+			delay := time.Second
+			if req.Msg.RetryDelay != nil {
+				delay = req.Msg.RetryDelay.AsDuration()
+			}
+			rpcerr.AddRetryInfo(connectErr, delay)
+		case pingv1.ErrorDetail_ERROR_DETAIL_DEBUG_INFO:
+			rpcerr.AddDebugInfo(connectErr, errKV)
+		case pingv1.ErrorDetail_ERROR_DETAIL_BAD_REQUEST:
+			rpcerr.AddBadRequest(connectErr, "failure_code", "the request asked for the failure")
+		}
+	}
 
-	resp = connect.NewResponse(&pingv1.HardFailResponse{})
-	err = connect.NewError(connect.Code(req.Msg.FailureCode), kv.NewError("intentional failure").With("stack", stack.Trace().TrimRuntime()))
-	return resp, err
+	return connect.NewResponse(&pingv1.HardFailResponse{}), connectErr
 }
@@ -0,0 +1,291 @@
+package ping
+
+// This file contains a connectrpc interceptor rate limiting the RPCs of each caller
+// using token buckets.  Callers are told apart by their authenticated identity, their
+// IP address, or a configured request header, and each caller has its own bucket for
+// every limit.  The state of the bucket is returned to callers using the RateLimit
+// response headers so that well behaved clients can pace themselves.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// RateLimitKey selects how the rate limiter tells callers apart
+type RateLimitKey string
+
+const (
+	// RateLimitByIdentity uses the subject of the bearer token, or the mutual TLS identity, of the
+	// caller, falling back to the IP address of unauthenticated callers
+	RateLimitByIdentity RateLimitKey = "identity"
+	// RateLimitByIP uses the IP address of the caller
+	RateLimitByIP RateLimitKey = "ip"
+	// RateLimitByHeader uses the value of a request header, falling back to the IP address of
+	// callers that do not send the header
+	RateLimitByHeader RateLimitKey = "header"
+)
+
+// idleBucket is how long a full bucket is retained after the last RPC of its caller
+const idleBucket = 5 * time.Minute
+
+// RateLimit is the token bucket applied to each caller of a procedure
+type RateLimit struct {
+	// Procedure is a procedure name, or a path.Match glob such as /ping.v1.PingService/*
+	Procedure string
+	// Rate is the number of RPCs per second added to the bucket
+	Rate float64
+	// Burst is the capacity of the bucket
+	Burst int
+}
+
+// ParseRateLimits parses a comma separated list of procedure=rate[:burst] limits, the rate
+// being in RPCs per second, for example "/ping.v1.PingService/Generate=0.5:2,/ping.v1.PingService/*=50"
+// When no burst is given it defaults to the rate rounded up.
+func ParseRateLimits(spec string) (limits []RateLimit, err kv.Error) {
+	limits = []RateLimit{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		procedure, value, isPresent := strings.Cut(item, "=")
+		if !isPresent {
+			return nil, kv.NewError("rate limits must be of the form procedure=rate[:burst]").With("limit", item, "stack", stack.Trace().TrimRuntime())
+		}
+		if _, errGo := path.Match(procedure, ""); errGo != nil {
+			return nil, kv.Wrap(errGo).With("procedure", procedure, "stack", stack.Trace().TrimRuntime())
+		}
+		rateText, burstText, hasBurst := strings.Cut(value, ":")
+		rate, errGo := strconv.ParseFloat(rateText, 64)
+		if errGo != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, kv.NewError("rates must be a positive number of RPCs per second").With("limit", item, "stack", stack.Trace().TrimRuntime())
+		}
+		burst := int(math.Ceil(rate))
+		if hasBurst {
+			if burst, errGo = strconv.Atoi(burstText); errGo != nil || burst < 1 {
+				return nil, kv.NewError("bursts must be a positive integer").With("limit", item, "stack", stack.Trace().TrimRuntime())
+			}
+		}
+		limits = append(limits, RateLimit{Procedure: procedure, Rate: rate, Burst: burst})
+	}
+	return limits, nil
+}
+
+// RateLimitOpts contains the options used when creating a RateLimiter
+type RateLimitOpts struct {
+	// Limits are the per procedure limits, the first limit matching a procedure is used and
+	// procedures without a matching limit are not rate limited
+	Limits []RateLimit
+	// Key selects how callers are told apart, default RateLimitByIdentity
+	Key RateLimitKey
+	// Header is the request header identifying callers when using RateLimitByHeader
+	Header string
+}
+
+// bucketKey identifies the bucket of a caller for one of the limits
+type bucketKey struct {
+	limit  int
+	caller string
+}
+
+// bucket holds the tokens available to a caller
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a connectrpc interceptor applying token bucket rate limits to each caller
+type RateLimiter struct {
+	opts RateLimitOpts
+
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+	// now is the clock used to refill the buckets, replaced by tests
+	now func() time.Time
+	sync.Mutex
+}
+
+// NewRateLimiter returns a rate limiter using the options supplied
+func NewRateLimiter(opts RateLimitOpts) (limiter *RateLimiter, err kv.Error) {
+	switch opts.Key {
+	case "":
+		opts.Key = RateLimitByIdentity
+	case RateLimitByIdentity, RateLimitByIP:
+	case RateLimitByHeader:
+		if len(opts.Header) == 0 {
+			return nil, kv.NewError("a header must be supplied when rate limiting by header").With("stack", stack.Trace().TrimRuntime())
+		}
+	default:
+		return nil, kv.NewError("unknown rate limit key, expected identity, ip, or header").With("key", opts.Key, "stack", stack.Trace().TrimRuntime())
+	}
+	for _, limit := range opts.Limits {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return nil, kv.NewError("rate limits must have a positive rate and burst").With("procedure", limit.Procedure, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	return &RateLimiter{
+		opts:    opts,
+		buckets: map[bucketKey]*bucket{},
+		swept:   time.Now(),
+		now:     time.Now,
+	}, nil
+}
+
+// caller returns the key of the bucket used for the caller of an RPC
+func (limiter *RateLimiter) caller(ctx context.Context, peer connect.Peer, header http.Header) (caller string) {
+	switch limiter.opts.Key {
+	case RateLimitByIdentity:
+		if subject := auth.Subject(ctx); len(subject) != 0 {
+			return "id:" + subject
+		}
+	case RateLimitByHeader:
+		if value := header.Get(limiter.opts.Header); len(value) != 0 {
+			return "header:" + value
+		}
+	}
+	host, _, errGo := net.SplitHostPort(peer.Addr)
+	if errGo != nil {
+		host = peer.Addr
+	}
+	return "ip:" + host
+}
+
+// take removes a token from the bucket of the caller for the procedure.  The headers
+// describing the bucket are returned, along with an error when the caller has no tokens.
+func (limiter *RateLimiter) take(ctx context.Context, procedure string, caller string) (headers http.Header, err error) {
+	index := -1
+	for i, limit := range limiter.opts.Limits {
+		if isMatch, _ := path.Match(limit.Procedure, procedure); isMatch {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+	limit := limiter.opts.Limits[index]
+
+	limiter.Lock()
+	now := limiter.now()
+	limiter.sweep(now)
+
+	key := bucketKey{limit: index, caller: caller}
+	b, isPresent := limiter.buckets[key]
+	if !isPresent {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		limiter.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	isAllowed := b.tokens >= 1
+	if isAllowed {
+		b.tokens--
+	}
+	remaining := int(b.tokens)
+	reset := seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	wait := seconds((1 - b.tokens) / limit.Rate)
+	limiter.Unlock()
+
+	headers = http.Header{}
+	headers.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	headers.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	headers.Set("RateLimit-Reset", strconv.Itoa(reset))
+	if isAllowed {
+		return headers, nil
+	}
+
+	apiRateLimitedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("rpc.procedure", procedure)))
+
+	connectErr := rpcerr.AddRetryInfo(rpcerr.New(connect.CodeResourceExhausted, "RATE_LIMITED",
+		kv.NewError("rate limit exceeded").With("procedure", procedure, "rate", limit.Rate, "burst", limit.Burst, "stack", stack.Trace().TrimRuntime())),
+		time.Duration(wait)*time.Second)
+	headers.Set("Retry-After", strconv.Itoa(wait))
+	setHeaders(connectErr.Meta(), headers)
+	return headers, connectErr
+}
+
+// sweep discards the buckets of callers that have been idle long enough for their bucket to
+// have refilled, it is called with the lock held
+func (limiter *RateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.swept) < idleBucket {
+		return
+	}
+	limiter.swept = now
+	for key, b := range limiter.buckets {
+		if now.Sub(b.updated) >= idleBucket {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// seconds rounds a duration in seconds up to a whole number of seconds
+func seconds(duration float64) int {
+	return int(math.Max(0, math.Ceil(duration)))
+}
+
+func setHeaders(dst http.Header, src http.Header) {
+	for name, values := range src {
+		dst[name] = values
+	}
+}
+
+// WrapUnary implements the connect.Interceptor interface for unary RPCs
+func (limiter *RateLimiter) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		caller := limiter.caller(ctx, req.Peer(), req.Header())
+		headers, err := limiter.take(ctx, req.Spec().Procedure, caller)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next(ctx, req)
+		if resp != nil {
+			setHeaders(resp.Header(), headers)
+		}
+		if connectErr := new(connect.Error); err != nil && errors.As(err, &connectErr) {
+			setHeaders(connectErr.Meta(), headers)
+		}
+		return resp, err
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface, client streams are passed through
+func (limiter *RateLimiter) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface for streaming RPCs, each
+// stream takes a single token regardless of the number of messages it carries
+func (limiter *RateLimiter) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		caller := limiter.caller(ctx, conn.Peer(), conn.RequestHeader())
+		headers, err := limiter.take(ctx, conn.Spec().Procedure, caller)
+		if err != nil {
+			return err
+		}
+		setHeaders(conn.ResponseHeader(), headers)
+		return next(ctx, conn)
+	}
+}
@@ -0,0 +1,281 @@
+package ping
+
+// This file contains tests of the token buckets of the rate limiter, driven by a fake clock,
+// of the headers describing them, and of how callers are told apart.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/golang-jwt/jwt/v5"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+
+	"github.com/karlmutch/buf-ping/pkg/auth"
+)
+
+// fakeClock is a clock that only moves when advanced by the test
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time { return clock.now }
+
+func (clock *fakeClock) advance(d time.Duration) { clock.now = clock.now.Add(d) }
+
+// newTestRateLimiter returns a rate limiter using the limits and a fake clock
+func newTestRateLimiter(t *testing.T, opts RateLimitOpts) (limiter *RateLimiter, clock *fakeClock) {
+	t.Helper()
+
+	limiter, err := NewRateLimiter(opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	clock = &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter.now = clock.Now
+	limiter.swept = clock.now
+	return limiter, clock
+}
+
+// checkHeaders fails the test unless the headers hold the values, an empty value expects the
+// header to be absent
+func checkHeaders(t *testing.T, headers http.Header, expected map[string]string) {
+	t.Helper()
+
+	for name, value := range expected {
+		if got := headers.Get(name); got != value {
+			t.Fatalf("expected %s to be %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected []RateLimit
+		isError  bool
+	}{
+		{spec: "", expected: []RateLimit{}},
+		{spec: "/a/B=5", expected: []RateLimit{{Procedure: "/a/B", Rate: 5, Burst: 5}}},
+		{spec: "/a/B=0.5", expected: []RateLimit{{Procedure: "/a/B", Rate: 0.5, Burst: 1}}},
+		{spec: "/a/B=0.5:3, /a/*=50", expected: []RateLimit{{Procedure: "/a/B", Rate: 0.5, Burst: 3}, {Procedure: "/a/*", Rate: 50, Burst: 50}}},
+		{spec: "/a/B", isError: true},
+		{spec: "/a/B=0", isError: true},
+		{spec: "/a/B=-1", isError: true},
+		{spec: "/a/B=Inf", isError: true},
+		{spec: "/a/B=1:0", isError: true},
+		{spec: "/a/B=1:x", isError: true},
+		{spec: "/a/[=1", isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			limits, err := ParseRateLimits(tc.spec)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected %q to be refused, got %v", tc.spec, limits)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if len(limits) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, limits)
+			}
+			for i := range limits {
+				if limits[i] != tc.expected[i] {
+					t.Fatalf("expected %v, got %v", tc.expected, limits)
+				}
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestRateLimiter(t, RateLimitOpts{
+		Limits: []RateLimit{{Procedure: "/ping.v1.PingService/*", Rate: 2, Burst: 3}},
+	})
+	procedure := pingv1connect.PingServicePingProcedure
+	rejected := attribute.String("rpc.procedure", procedure)
+	rejections := counterValue(t, "pingbuf.api.ratelimited.counter", rejected)
+
+	// A new caller may use the whole burst at once
+	for remaining := 2; remaining >= 0; remaining-- {
+		headers, err := limiter.take(ctx, procedure, "ip:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkHeaders(t, headers, map[string]string{
+			"RateLimit-Limit":     "3",
+			"RateLimit-Remaining": []string{"0", "1", "2"}[remaining],
+			"Retry-After":         "",
+		})
+	}
+
+	// Once the bucket is empty the caller is refused until it refills at 2 RPCs a second
+	headers, err := limiter.take(ctx, procedure, "ip:a")
+	connectErr := &connect.Error{}
+	if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeResourceExhausted {
+		t.Fatalf("expected the RPC to be refused, got %v", err)
+	}
+	expected := map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "0", "RateLimit-Reset": "2", "Retry-After": "1"}
+	checkHeaders(t, headers, expected)
+	checkHeaders(t, connectErr.Meta(), expected)
+	if counted := counterValue(t, "pingbuf.api.ratelimited.counter", rejected) - rejections; counted != 1 {
+		t.Fatalf("expected the refused RPC to be counted, got %d", counted)
+	}
+
+	// Other callers have buckets of their own
+	if _, err = limiter.take(ctx, procedure, "ip:b"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(400 * time.Millisecond)
+	if _, err = limiter.take(ctx, procedure, "ip:a"); err == nil {
+		t.Fatal("expected the bucket to hold less than a token")
+	}
+	clock.advance(100 * time.Millisecond)
+	if _, err = limiter.take(ctx, procedure, "ip:a"); err != nil {
+		t.Fatalf("expected the bucket to have refilled a token, %v", err)
+	}
+
+	// Buckets refill no further than the burst
+	clock.advance(time.Minute)
+	headers, err = limiter.take(ctx, procedure, "ip:a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders(t, headers, map[string]string{"RateLimit-Remaining": "2", "RateLimit-Reset": "1"})
+
+	// Procedures without a limit are not limited, nor given headers
+	for i := 0; i != 10; i++ {
+		if headers, err = limiter.take(ctx, "/grpc.health.v1.Health/Check", "ip:a"); err != nil || headers != nil {
+			t.Fatalf("expected the procedure to be unlimited, got %v %v", headers, err)
+		}
+	}
+
+	// Idle buckets are discarded
+	clock.advance(idleBucket)
+	if _, err = limiter.take(ctx, procedure, "ip:c"); err != nil {
+		t.Fatal(err)
+	}
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected only the bucket of the latest caller to remain, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimitCaller(t *testing.T) {
+	claims := auth.ContextWithClaims(context.Background(), jwt.MapClaims{"sub": "tester", "tenant": "acme"})
+	identity := auth.ContextWithIdentity(context.Background(), auth.Identity{CommonName: "client"})
+	header := http.Header{"X-Client": []string{"dashboard"}}
+	peer := connect.Peer{Addr: "192.0.2.1:5000"}
+
+	testCases := []struct {
+		name     string
+		key      RateLimitKey
+		ctx      context.Context
+		header   http.Header
+		peer     connect.Peer
+		expected string
+	}{
+		{name: "identity of a token", key: RateLimitByIdentity, ctx: claims, peer: peer, expected: "id:tester"},
+		{name: "identity of a certificate", key: RateLimitByIdentity, ctx: identity, peer: peer, expected: "id:client"},
+		{name: "identity of an unauthenticated caller", key: RateLimitByIdentity, ctx: context.Background(), peer: peer, expected: "ip:192.0.2.1"},
+		{name: "ip", key: RateLimitByIP, ctx: claims, header: header, peer: peer, expected: "ip:192.0.2.1"},
+		{name: "ipv6", key: RateLimitByIP, ctx: context.Background(), peer: connect.Peer{Addr: "[2001:db8::1]:5000"}, expected: "ip:2001:db8::1"},
+		{name: "address without a port", key: RateLimitByIP, ctx: context.Background(), peer: connect.Peer{Addr: "pipe"}, expected: "ip:pipe"},
+		{name: "header", key: RateLimitByHeader, ctx: claims, header: header, peer: peer, expected: "header:dashboard"},
+		{name: "missing header", key: RateLimitByHeader, ctx: claims, header: http.Header{}, peer: peer, expected: "ip:192.0.2.1"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			limiter, _ := newTestRateLimiter(t, RateLimitOpts{Key: tc.key, Header: "X-Client"})
+			if caller := limiter.caller(tc.ctx, tc.peer, tc.header); caller != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, caller)
+			}
+		})
+	}
+
+	if _, err := NewRateLimiter(RateLimitOpts{Key: RateLimitByHeader}); err == nil {
+		t.Error("expected rate limiting by header to require a header")
+	}
+	if _, err := NewRateLimiter(RateLimitOpts{Key: "cookie"}); err == nil {
+		t.Error("expected an unknown key to be refused")
+	}
+}
+
+// rateLimitedService answers Ping, and Generate, RPCs without doing any work
+type rateLimitedService struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (rateLimitedService) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	return connect.NewResponse(&pingv1.PingResponse{}), nil
+}
+
+func (rateLimitedService) Generate(_ context.Context, _ *connect.Request[pingv1.GenerateRequest], stream *connect.ServerStream[pingv1.GenerateResponse]) error {
+	return stream.Send(&pingv1.GenerateResponse{})
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	limiter, _ := newTestRateLimiter(t, RateLimitOpts{
+		Limits: []RateLimit{{Procedure: "/ping.v1.PingService/*", Rate: 1, Burst: 1}},
+		Key:    RateLimitByHeader,
+		Header: "X-Client",
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(rateLimitedService{}, connect.WithInterceptors(limiter)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	ping := func(caller string) (*connect.Response[pingv1.PingResponse], error) {
+		req := connect.NewRequest(&pingv1.PingRequest{})
+		req.Header().Set("X-Client", caller)
+		return client.Ping(context.Background(), req)
+	}
+
+	resp, err := ping("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders(t, resp.Header(), map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "1"})
+
+	_, err = ping("a")
+	connectErr := &connect.Error{}
+	if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeResourceExhausted {
+		t.Fatalf("expected the second RPC to be refused, got %v", err)
+	}
+	checkHeaders(t, connectErr.Meta(), map[string]string{"RateLimit-Remaining": "0", "Retry-After": "1"})
+
+	if _, err = ping("b"); err != nil {
+		t.Fatalf("expected a second caller to have a bucket of its own, %v", err)
+	}
+
+	// Streams take a single token and carry the headers in their response headers
+	req := connect.NewRequest(&pingv1.GenerateRequest{})
+	req.Header().Set("X-Client", "c")
+	stream, err := client.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stream.Receive() {
+	}
+	if err = stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders(t, stream.ResponseHeader(), map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0"})
+	stream.Close()
+}
@@ -0,0 +1,410 @@
+package store
+
+// This file contains an embedded on-disk Store.  Every change to a counter is
+// appended to a write-ahead log as a length prefixed, checksummed record.  The
+// log is periodically folded into a snapshot and truncated, with sequence
+// numbers making recovery correct even when a crash occurs between the snapshot
+// being written and the log being truncated.
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// FsyncPolicy controls when the write-ahead log is flushed to stable storage.  All
+// policies survive a crash of the server process, only FsyncAlways guarantees that
+// no acknowledged change is lost when the host itself fails.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways flushes the log before every change is acknowledged
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval flushes the log periodically, bounding the loss window to the interval
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves flushing the log to the operating system
+	FsyncNever FsyncPolicy = "never"
+)
+
+const (
+	walName      = "total.wal"
+	snapshotName = "total.snapshot"
+
+	// recordHeaderSize is the length and CRC32 prefixing every log record
+	recordHeaderSize = 8
+)
+
+// DiskOpts contains the options for an on-disk store, zero values select the defaults
+type DiskOpts struct {
+	// Dir is the directory holding the log and snapshot files, it is created if needed
+	Dir string
+
+	Fsync FsyncPolicy
+	// FsyncInterval is used with FsyncInterval, default 1s
+	FsyncInterval time.Duration
+
+	// SnapshotInterval is the maximum time between snapshots, default 1m
+	SnapshotInterval time.Duration
+	// SnapshotRecords is the number of log records that will trigger a snapshot, default 10000
+	SnapshotRecords int
+
+	// Logger reports snapshots that failed and are being retried, default slog.Default()
+	Logger *slog.Logger
+}
+
+type walRecord struct {
+	Seq     uint64 `json:"seq"`
+	Counter string `json:"counter,omitempty"`
+	Delta   int64  `json:"delta"`
+}
+
+type snapshotState struct {
+	Seq uint64 `json:"seq"`
+	// Total is the default counter, it is kept separately for compatibility with
+	// snapshots written before named counters were introduced
+	Total    int64            `json:"total"`
+	Counters map[string]int64 `json:"counters,omitempty"`
+}
+
+// Disk is a Store using a write-ahead log and periodic snapshots
+type Disk struct {
+	opts DiskOpts
+
+	wal     *os.File
+	offset  int64  // end of the last complete record in the log
+	seq     uint64 // sequence number of the last record written
+	totals  map[string]int64
+	records int  // records appended since the last snapshot
+	dirty   bool // records written but not yet flushed
+	closed  bool
+
+	// snapshotErr is the failure of the last snapshot, snapshots are retried by later changes,
+	// and the snapshot timer, until one succeeds
+	snapshotErr kv.Error
+
+	stopC chan struct{}
+	doneC chan struct{}
+
+	sync.Mutex
+}
+
+// NewDisk opens, or creates, an on-disk store and recovers the totals from its
+// snapshot and log
+func NewDisk(opts DiskOpts) (disk *Disk, err kv.Error) {
+	switch opts.Fsync {
+	case "":
+		opts.Fsync = FsyncInterval
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, kv.NewError("unknown fsync policy").With("policy", opts.Fsync, "stack", stack.Trace().TrimRuntime())
+	}
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = time.Second
+	}
+	if opts.SnapshotInterval <= 0 {
+		opts.SnapshotInterval = time.Minute
+	}
+	if opts.SnapshotRecords <= 0 {
+		opts.SnapshotRecords = 10000
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if errGo := os.MkdirAll(opts.Dir, 0o700); errGo != nil {
+		return nil, kv.Wrap(errGo).With("dir", opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+
+	disk = &Disk{
+		opts:  opts,
+		stopC: make(chan struct{}),
+		doneC: make(chan struct{}),
+	}
+
+	snap, err := readSnapshot(filepath.Join(opts.Dir, snapshotName))
+	if err != nil {
+		return nil, err
+	}
+	disk.seq = snap.Seq
+	disk.totals = map[string]int64{"": snap.Total}
+	for key, total := range snap.Counters {
+		disk.totals[key] = total
+	}
+
+	if err = disk.openWAL(snap.Seq); err != nil {
+		return nil, err
+	}
+
+	go disk.background()
+
+	return disk, nil
+}
+
+func readSnapshot(fn string) (snap snapshotState, err kv.Error) {
+	data, errGo := os.ReadFile(fn)
+	if errGo != nil {
+		if os.IsNotExist(errGo) {
+			return snap, nil
+		}
+		return snap, kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	if errGo = json.Unmarshal(data, &snap); errGo != nil {
+		return snap, kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	return snap, nil
+}
+
+// openWAL replays the records in the log that are newer than the snapshot, any
+// torn or corrupted tail left by a crash is truncated away
+func (disk *Disk) openWAL(snapSeq uint64) (err kv.Error) {
+	fn := filepath.Join(disk.opts.Dir, walName)
+	wal, errGo := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0o600)
+	if errGo != nil {
+		return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	data, errGo := io.ReadAll(wal)
+	if errGo != nil {
+		wal.Close()
+		return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	offset := 0
+	for len(data)-offset >= recordHeaderSize {
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		sum := binary.BigEndian.Uint32(data[offset+4:])
+		if size > len(data)-offset-recordHeaderSize {
+			break
+		}
+		payload := data[offset+recordHeaderSize : offset+recordHeaderSize+size]
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		rec := walRecord{}
+		if errGo = json.Unmarshal(payload, &rec); errGo != nil {
+			break
+		}
+		if rec.Seq > snapSeq {
+			disk.totals[rec.Counter] += rec.Delta
+			disk.seq = rec.Seq
+			disk.records++
+		}
+		offset += recordHeaderSize + size
+	}
+
+	if offset != len(data) {
+		if errGo = wal.Truncate(int64(offset)); errGo != nil {
+			wal.Close()
+			return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	if _, errGo = wal.Seek(int64(offset), io.SeekStart); errGo != nil {
+		wal.Close()
+		return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+
+	disk.wal = wal
+	disk.offset = int64(offset)
+	return nil
+}
+
+// Load implements the Store interface
+func (disk *Disk) Load() (totals map[string]int64, err kv.Error) {
+	disk.Lock()
+	defer disk.Unlock()
+	return copyTotals(disk.totals), nil
+}
+
+// Add implements the Store interface
+func (disk *Disk) Add(key string, delta int64) (err kv.Error) {
+	disk.Lock()
+	defer disk.Unlock()
+
+	if disk.closed {
+		return kv.NewError("store closed").With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+
+	payload, errGo := json.Marshal(walRecord{Seq: disk.seq + 1, Counter: key, Delta: delta})
+	if errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	// Records are written at the end of the last complete record so that a failed write, or
+	// sync, is removed by truncating back to it, leaving the log, and totals, unchanged
+	if _, errGo = disk.wal.WriteAt(buf, disk.offset); errGo != nil {
+		disk.rollback()
+		return kv.Wrap(errGo).With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+	if disk.opts.Fsync == FsyncAlways {
+		if errGo = disk.wal.Sync(); errGo != nil {
+			disk.rollback()
+			return kv.Wrap(errGo).With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+		}
+	} else {
+		disk.dirty = true
+	}
+
+	disk.offset += int64(len(buf))
+	disk.seq++
+	disk.totals[key] += delta
+	disk.records++
+
+	// The change is in the log and will be recovered regardless of the snapshot, so snapshot
+	// failures are logged and retried rather than returned
+	if disk.records >= disk.opts.SnapshotRecords {
+		disk.trySnapshot()
+	}
+	return nil
+}
+
+// rollback removes anything written beyond the last complete record, it must be called with
+// the lock held
+func (disk *Disk) rollback() {
+	_ = disk.wal.Truncate(disk.offset)
+}
+
+// trySnapshot takes a snapshot, logging when snapshots begin to fail, and when they recover,
+// it must be called with the lock held
+func (disk *Disk) trySnapshot() {
+	err := disk.snapshot()
+	switch {
+	case err != nil && disk.snapshotErr == nil:
+		disk.opts.Logger.Warn("counter state snapshot failed, it will be retried", "dir", disk.opts.Dir, "records", disk.records, "error", err.Error())
+	case err == nil && disk.snapshotErr != nil:
+		disk.opts.Logger.Info("counter state snapshot recovered", "dir", disk.opts.Dir)
+	}
+	disk.snapshotErr = err
+}
+
+// snapshot writes the totals to the snapshot file and then truncates the log, it
+// must be called with the lock held
+func (disk *Disk) snapshot() (err kv.Error) {
+	fn := filepath.Join(disk.opts.Dir, snapshotName)
+	tmpFn := fn + ".tmp"
+
+	snap := snapshotState{Seq: disk.seq, Counters: map[string]int64{}}
+	for key, total := range disk.totals {
+		if len(key) == 0 {
+			snap.Total = total
+			continue
+		}
+		snap.Counters[key] = total
+	}
+
+	data, errGo := json.Marshal(snap)
+	if errGo != nil {
+		return kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+
+	tmp, errGo := os.OpenFile(tmpFn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if errGo != nil {
+		return kv.Wrap(errGo).With("file", tmpFn, "stack", stack.Trace().TrimRuntime())
+	}
+	if _, errGo = tmp.Write(data); errGo == nil {
+		errGo = tmp.Sync()
+	}
+	if errClose := tmp.Close(); errGo == nil {
+		errGo = errClose
+	}
+	if errGo != nil {
+		return kv.Wrap(errGo).With("file", tmpFn, "stack", stack.Trace().TrimRuntime())
+	}
+	if errGo = os.Rename(tmpFn, fn); errGo != nil {
+		return kv.Wrap(errGo).With("file", fn, "stack", stack.Trace().TrimRuntime())
+	}
+	syncDir(disk.opts.Dir)
+
+	// Records now covered by the snapshot are skipped on recovery using their
+	// sequence numbers, so a crash before the truncation is harmless
+	if errGo = disk.wal.Truncate(0); errGo != nil {
+		return kv.Wrap(errGo).With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+	disk.offset = 0
+	disk.records = 0
+	disk.dirty = false
+	return nil
+}
+
+// syncDir flushes directory entries, such as a rename, on platforms supporting it
+func syncDir(dir string) {
+	if d, errGo := os.Open(dir); errGo == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+// background performs the interval based flushing and snapshotting
+func (disk *Disk) background() {
+	defer close(disk.doneC)
+
+	fsyncTicker := time.NewTicker(disk.opts.FsyncInterval)
+	defer fsyncTicker.Stop()
+	snapshotTicker := time.NewTicker(disk.opts.SnapshotInterval)
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-disk.stopC:
+			return
+		case <-fsyncTicker.C:
+			if disk.opts.Fsync != FsyncInterval {
+				continue
+			}
+			disk.Lock()
+			if disk.dirty && !disk.closed {
+				if errGo := disk.wal.Sync(); errGo == nil {
+					disk.dirty = false
+				}
+			}
+			disk.Unlock()
+		case <-snapshotTicker.C:
+			disk.Lock()
+			if disk.records != 0 && !disk.closed {
+				disk.trySnapshot()
+			}
+			disk.Unlock()
+		}
+	}
+}
+
+// Close implements the Store interface, a final snapshot is taken so that the
+// next start does not need to replay the log
+func (disk *Disk) Close() (err kv.Error) {
+	disk.Lock()
+	if disk.closed {
+		disk.Unlock()
+		return nil
+	}
+	disk.closed = true
+	disk.Unlock()
+
+	close(disk.stopC)
+	<-disk.doneC
+
+	disk.Lock()
+	defer disk.Unlock()
+
+	if disk.records != 0 {
+		err = disk.snapshot()
+	}
+	if errGo := disk.wal.Sync(); errGo != nil && err == nil {
+		err = kv.Wrap(errGo).With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+	if errGo := disk.wal.Close(); errGo != nil && err == nil {
+		err = kv.Wrap(errGo).With("dir", disk.opts.Dir, "stack", stack.Trace().TrimRuntime())
+	}
+	return err
+}
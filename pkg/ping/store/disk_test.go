@@ -0,0 +1,254 @@
+package store
+
+// This file contains tests of the recovery of the disk store from its log and snapshot, after
+// both clean shutdowns and crashes, and of its handling of failed snapshots.
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDisk opens a store whose timers do not fire during the tests
+func newTestDisk(t *testing.T, dir string, snapshotRecords int) (disk *Disk) {
+	t.Helper()
+
+	disk, err := NewDisk(DiskOpts{
+		Dir:              dir,
+		Fsync:            FsyncAlways,
+		SnapshotInterval: time.Hour,
+		SnapshotRecords:  snapshotRecords,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return disk
+}
+
+// crash stops the store without the final snapshot, and log flush, of Close
+func crash(disk *Disk) {
+	disk.Lock()
+	disk.closed = true
+	disk.Unlock()
+
+	close(disk.stopC)
+	<-disk.doneC
+	disk.wal.Close()
+}
+
+func add(t *testing.T, disk *Disk, key string, delta int64) {
+	t.Helper()
+	if err := disk.Add(key, delta); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func checkTotals(t *testing.T, disk *Disk, expected map[string]int64) {
+	t.Helper()
+
+	totals, err := disk.Load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for key, total := range expected {
+		if totals[key] != total {
+			t.Errorf("counter %q expected %d, got %d", key, total, totals[key])
+		}
+	}
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, errGo := os.Stat(filepath.Join(dir, walName))
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	return info.Size()
+}
+
+func appendWAL(t *testing.T, dir string, data []byte) {
+	t.Helper()
+	f, errGo := os.OpenFile(filepath.Join(dir, walName), os.O_WRONLY|os.O_APPEND, 0o600)
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+	defer f.Close()
+	if _, errGo = f.Write(data); errGo != nil {
+		t.Fatal(errGo)
+	}
+}
+
+func TestDiskReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := newTestDisk(t, dir, 1000)
+	add(t, disk, "", 5)
+	add(t, disk, "a", 3)
+	add(t, disk, "", -2)
+	add(t, disk, "b", 7)
+	crash(disk)
+
+	// Every change is recovered from the log alone
+	disk = newTestDisk(t, dir, 1000)
+	checkTotals(t, disk, map[string]int64{"": 3, "a": 3, "b": 7})
+
+	add(t, disk, "a", 1)
+	if err := disk.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if size := walSize(t, dir); size != 0 {
+		t.Errorf("expected the log to be folded into the snapshot on close, %d bytes remain", size)
+	}
+
+	disk = newTestDisk(t, dir, 1000)
+	defer disk.Close()
+	checkTotals(t, disk, map[string]int64{"": 3, "a": 4, "b": 7})
+}
+
+func TestDiskTornTail(t *testing.T) {
+	badCRC := []byte(`{"seq":3,"delta":100}`)
+	badCRCRecord := make([]byte, recordHeaderSize+len(badCRC))
+	binary.BigEndian.PutUint32(badCRCRecord, uint32(len(badCRC)))
+	binary.BigEndian.PutUint32(badCRCRecord[4:], crc32.ChecksumIEEE(badCRC)+1)
+	copy(badCRCRecord[recordHeaderSize:], badCRC)
+
+	tornRecord := make([]byte, recordHeaderSize+4)
+	binary.BigEndian.PutUint32(tornRecord, 64)
+
+	testCases := []struct {
+		name string
+		tail []byte
+	}{
+		{name: "torn header", tail: []byte{0, 0, 0}},
+		{name: "torn payload", tail: tornRecord},
+		{name: "bad crc", tail: badCRCRecord},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			disk := newTestDisk(t, dir, 1000)
+			add(t, disk, "", 1)
+			add(t, disk, "", 2)
+			crash(disk)
+
+			valid := walSize(t, dir)
+			appendWAL(t, dir, tc.tail)
+
+			disk = newTestDisk(t, dir, 1000)
+			checkTotals(t, disk, map[string]int64{"": 3})
+			if size := walSize(t, dir); size != valid {
+				t.Errorf("expected the log to be truncated to %d bytes, got %d", valid, size)
+			}
+
+			// Changes made after the truncation are recovered rather than stranded behind the tail
+			add(t, disk, "", 4)
+			crash(disk)
+
+			disk = newTestDisk(t, dir, 1000)
+			defer disk.Close()
+			checkTotals(t, disk, map[string]int64{"": 7})
+		})
+	}
+}
+
+func TestDiskSnapshotBeforeTruncate(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := newTestDisk(t, dir, 1000)
+	add(t, disk, "", 10)
+	add(t, disk, "a", 20)
+
+	wal, errGo := os.ReadFile(filepath.Join(dir, walName))
+	if errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	disk.Lock()
+	err := disk.snapshot()
+	disk.Unlock()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	crash(disk)
+
+	// Restoring the log simulates a crash after the snapshot was written but before the log
+	// was truncated, the records it covers must not be applied a second time
+	if errGo = os.WriteFile(filepath.Join(dir, walName), wal, 0o600); errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	disk = newTestDisk(t, dir, 1000)
+	checkTotals(t, disk, map[string]int64{"": 10, "a": 20})
+
+	add(t, disk, "a", 1)
+	crash(disk)
+
+	disk = newTestDisk(t, dir, 1000)
+	defer disk.Close()
+	checkTotals(t, disk, map[string]int64{"": 10, "a": 21})
+}
+
+func TestDiskSnapshotFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory in place of the temporary snapshot file causes every snapshot to fail
+	blocker := filepath.Join(dir, snapshotName+".tmp")
+	if errGo := os.Mkdir(blocker, 0o700); errGo != nil {
+		t.Fatal(errGo)
+	}
+
+	disk := newTestDisk(t, dir, 2)
+	for i := 0; i != 4; i++ {
+		// Changes in the log are acknowledged even though their snapshot failed
+		add(t, disk, "", 1)
+	}
+	checkTotals(t, disk, map[string]int64{"": 4})
+	if disk.snapshotErr == nil {
+		t.Fatal("expected the snapshot to have failed")
+	}
+
+	// The next change retries the snapshot, which then folds the log away
+	if errGo := os.Remove(blocker); errGo != nil {
+		t.Fatal(errGo)
+	}
+	add(t, disk, "", 1)
+	if disk.snapshotErr != nil {
+		t.Fatalf("expected the snapshot to be retried, %s", disk.snapshotErr.Error())
+	}
+	if size := walSize(t, dir); size != 0 {
+		t.Errorf("expected the log to be truncated by the snapshot, %d bytes remain", size)
+	}
+	crash(disk)
+
+	disk = newTestDisk(t, dir, 2)
+	defer disk.Close()
+	checkTotals(t, disk, map[string]int64{"": 5})
+}
+
+func TestDiskWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := newTestDisk(t, dir, 1000)
+	add(t, disk, "", 1)
+
+	// A failed write is not applied to the totals
+	disk.wal.Close()
+	if err := disk.Add("", 1); err == nil {
+		t.Fatal("expected the change to fail once the log is closed")
+	}
+	checkTotals(t, disk, map[string]int64{"": 1})
+	crash(disk)
+
+	disk = newTestDisk(t, dir, 1000)
+	defer disk.Close()
+	checkTotals(t, disk, map[string]int64{"": 1})
+}
@@ -0,0 +1,62 @@
+package store
+
+// This file contains the interface used by the PingServer to persist its running
+// totals, along with an in-memory implementation for servers that do not need the
+// totals to survive a restart.
+
+import (
+	"sync"
+
+	"github.com/karlmutch/kv"
+)
+
+// Store is implemented by the persistence layers that record changes to the
+// PingServer counters.  Counters are identified by a key, the empty key being the
+// servers default counter.
+type Store interface {
+	// Load returns the totals of all counters recovered from previous runs of the server
+	Load() (totals map[string]int64, err kv.Error)
+	// Add durably records a change to a counter, subject to the stores sync policy
+	Add(key string, delta int64) (err kv.Error)
+	// Close flushes any pending changes and releases the stores resources
+	Close() (err kv.Error)
+}
+
+// Memory is a Store that keeps nothing beyond the lifetime of the process
+type Memory struct {
+	totals map[string]int64
+	sync.Mutex
+}
+
+// NewMemory returns a store that does not persist the counters
+func NewMemory() *Memory {
+	return &Memory{totals: map[string]int64{}}
+}
+
+// Load implements the Store interface
+func (mem *Memory) Load() (totals map[string]int64, err kv.Error) {
+	mem.Lock()
+	defer mem.Unlock()
+	return copyTotals(mem.totals), nil
+}
+
+// Add implements the Store interface
+func (mem *Memory) Add(key string, delta int64) (err kv.Error) {
+	mem.Lock()
+	defer mem.Unlock()
+	mem.totals[key] += delta
+	return nil
+}
+
+// Close implements the Store interface
+func (mem *Memory) Close() (err kv.Error) {
+	return nil
+}
+
+func copyTotals(totals map[string]int64) (result map[string]int64) {
+	result = make(map[string]int64, len(totals))
+	for key, total := range totals {
+		result[key] = total
+	}
+	return result
+}
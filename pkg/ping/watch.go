@@ -0,0 +1,174 @@
+package ping
+
+// This file contains the fan-out of counter changes to the clients using the Watch RPC.
+// Every watcher has a bounded buffer so that a slow client can never stall the RPCs
+// changing the counter, what happens when the buffer fills is decided by the
+// SlowConsumerPolicy.
+
+import (
+	"context"
+	"sync/atomic"
+
+	"connectrpc.com/connect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// SlowConsumerPolicy selects what happens to watchers that do not keep up with the changes to a counter
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerDrop discards changes that do not fit into the buffer of the watcher, once the
+	// watcher catches up it is sent a gap carrying the number of changes dropped and the current total
+	SlowConsumerDrop SlowConsumerPolicy = "drop"
+	// SlowConsumerDisconnect ends the Watch RPC of a watcher whose buffer is full with a resource exhausted error
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// DefaultWatchBuffer is the number of changes buffered for each watcher when none is configured
+const DefaultWatchBuffer = 64
+
+// change is a single modification of a counter
+type change struct {
+	total     int64
+	delta     int64
+	procedure string
+}
+
+// watcher is the subscription of a single Watch RPC to a counter, the dropped and evicted
+// fields are guarded by the mutex of the counter
+type watcher struct {
+	policy  SlowConsumerPolicy
+	changes chan change
+
+	// gapC is signalled when the watcher has either dropped changes or been evicted
+	gapC    chan struct{}
+	dropped uint64
+	evicted bool
+}
+
+// watch subscribes to the changes of the counter, returning the total that the first change
+// delivered to the watcher will follow on from
+func (c *counter) watch(policy SlowConsumerPolicy, size int) (w *watcher, total int64) {
+	w = &watcher{
+		policy:  policy,
+		changes: make(chan change, size),
+		gapC:    make(chan struct{}, 1),
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.watchers == nil {
+		c.watchers = map[*watcher]struct{}{}
+	}
+	c.watchers[w] = struct{}{}
+	return w, atomic.LoadInt64(&c.total)
+}
+
+// unwatch removes the subscription of a watcher
+func (c *counter) unwatch(w *watcher) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.watchers, w)
+}
+
+// publish delivers a change to every watcher without blocking, the counter must be locked
+func (c *counter) publish(ch change) {
+	for w := range c.watchers {
+		// Once a change has been dropped everything is dropped until the watcher has
+		// caught up, this keeps the changes it does see in order
+		if w.dropped == 0 {
+			select {
+			case w.changes <- ch:
+				continue
+			default:
+			}
+		}
+
+		if w.policy == SlowConsumerDisconnect {
+			w.evicted = true
+			delete(c.watchers, w)
+		} else {
+			w.dropped++
+		}
+		select {
+		case w.gapC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// resync is used by a watcher that has been signalled on its gapC.  It returns the changes still
+// buffered for the watcher along with the count of those dropped after them and the current total.
+func (c *counter) resync(w *watcher) (pending []change, dropped uint64, total int64, evicted bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	for len(w.changes) != 0 {
+		pending = append(pending, <-w.changes)
+	}
+	dropped, w.dropped = w.dropped, 0
+	return pending, dropped, atomic.LoadInt64(&c.total), w.evicted
+}
+
+// Watch streams the current total of a counter followed by every change made to it by other RPCs
+func (server *PingServer) Watch(ctx context.Context, req *connect.Request[pingv1.WatchRequest], stream *connect.ServerStream[pingv1.WatchResponse]) (err error) {
+
+	apiWatchCounter.Add(ctx, 1)
+
+	c, err := server.counter(ctx, req.Msg.Counter, true)
+	if err != nil {
+		return err
+	}
+
+	w, total := c.watch(server.slowConsumer, server.watchBuffer)
+	defer c.unwatch(w)
+
+	if err = stream.Send(&pingv1.WatchResponse{Sum: clamp32(total), Sum64: total}); err != nil {
+		return err
+	}
+
+	send := func(ch change) error {
+		return stream.Send(&pingv1.WatchResponse{
+			Sum:       clamp32(ch.total),
+			Delta:     clamp32(ch.delta),
+			Procedure: ch.procedure,
+			Sum64:     ch.total,
+			Delta64:   ch.delta,
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch := <-w.changes:
+			if err = send(ch); err != nil {
+				return err
+			}
+		case <-w.gapC:
+			pending, dropped, total, evicted := c.resync(w)
+			for _, ch := range pending {
+				if err = send(ch); err != nil {
+					return err
+				}
+			}
+			if evicted {
+				server.loggerFrom(ctx).InfoContext(ctx, "watcher disconnected after falling behind", "counter", c.key)
+				return rpcerr.New(connect.CodeResourceExhausted, "WATCHER_TOO_SLOW",
+					kv.NewError("watcher was not keeping up with changes").With("counter", c.key, "stack", stack.Trace().TrimRuntime()))
+			}
+			if dropped != 0 {
+				if err = stream.Send(&pingv1.WatchResponse{Sum: clamp32(total), Sum64: total, Gap: true, Dropped: dropped}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
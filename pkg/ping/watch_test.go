@@ -0,0 +1,289 @@
+package ping
+
+// This file contains tests of the delivery of counter changes to watchers, covering watchers
+// that fall behind under each of the slow consumer policies and checking that a full buffer
+// never blocks the RPCs changing a counter.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+)
+
+// addChanges makes count changes of one to the counter, failing the test should the changes
+// not complete promptly as would happen were a watcher able to block them
+func addChanges(t *testing.T, server *PingServer, c *counter, count int) {
+	t.Helper()
+
+	errC := make(chan error, 1)
+	go func() {
+		for i := 0; i != count; i++ {
+			if _, err := server.add(context.Background(), c, 1, "test"); err != nil {
+				errC <- err
+				return
+			}
+		}
+		errC <- nil
+	}()
+
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("changes to the counter were blocked by a watcher")
+	}
+}
+
+// isSignalled returns true when the watcher has been signalled to resync
+func isSignalled(w *watcher) bool {
+	select {
+	case <-w.gapC:
+		return true
+	default:
+		return false
+	}
+}
+
+// newTestServer returns a server using the options that discards its logs, and is closed once
+// the test completes
+func newTestServer(t *testing.T, opts PingServerOpts) (server *PingServer) {
+	t.Helper()
+
+	server, err := NewPingServer(*slog.New(slog.NewTextHandler(io.Discard, nil)), opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() {
+		if err := server.Close(); err != nil {
+			t.Error(err.Error())
+		}
+	})
+	return server
+}
+
+// newTestCounter returns a counter of a server using the slow consumer policy, and buffer size
+func newTestCounter(t *testing.T, policy SlowConsumerPolicy, size int) (server *PingServer, c *counter) {
+	t.Helper()
+
+	server = newTestServer(t, PingServerOpts{SlowConsumer: policy, WatchBuffer: size})
+	c, err := server.counter(context.Background(), "watched", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, c
+}
+
+func TestWatchDrop(t *testing.T) {
+	server, c := newTestCounter(t, SlowConsumerDrop, 2)
+	addChanges(t, server, c, 1)
+
+	w, total := c.watch(server.slowConsumer, server.watchBuffer)
+	defer c.unwatch(w)
+	if total != 1 {
+		t.Fatalf("expected the watch to start from a total of 1, got %d", total)
+	}
+
+	// Changes beyond the buffer are dropped, and counted, without waiting for the watcher
+	addChanges(t, server, c, 5)
+	if !isSignalled(w) {
+		t.Fatal("expected the watcher to be signalled once changes were dropped")
+	}
+	pending, dropped, total, evicted := c.resync(w)
+	if len(pending) != 2 || pending[0].total != 2 || pending[1].total != 3 {
+		t.Fatalf("expected the buffered changes to the totals 2, and 3, got %v", pending)
+	}
+	if dropped != 3 || total != 6 || evicted {
+		t.Fatalf("expected a gap of 3 changes up to a total of 6, got %d changes up to %d evicted %t", dropped, total, evicted)
+	}
+
+	// Once caught up the watcher is sent changes again
+	addChanges(t, server, c, 1)
+	if isSignalled(w) {
+		t.Fatal("expected the watcher to have caught up")
+	}
+	if ch := <-w.changes; ch.total != 7 || ch.delta != 1 || ch.procedure != "test" {
+		t.Fatalf("expected the change to the total 7, got %v", ch)
+	}
+}
+
+func TestWatchDisconnect(t *testing.T) {
+	server, c := newTestCounter(t, SlowConsumerDisconnect, 2)
+
+	w, _ := c.watch(server.slowConsumer, server.watchBuffer)
+	defer c.unwatch(w)
+
+	addChanges(t, server, c, 2)
+	if isSignalled(w) {
+		t.Fatal("expected the watcher to be kept while its buffer has room")
+	}
+
+	// The change that does not fit evicts the watcher, later changes are no longer delivered
+	addChanges(t, server, c, 10)
+	if !isSignalled(w) {
+		t.Fatal("expected the watcher to be signalled once evicted")
+	}
+	c.Lock()
+	watchers := len(c.watchers)
+	c.Unlock()
+	if watchers != 0 {
+		t.Fatalf("expected the watcher to be removed from the counter, %d remain", watchers)
+	}
+
+	pending, dropped, _, evicted := c.resync(w)
+	if !evicted || dropped != 0 || len(pending) != 2 {
+		t.Fatalf("expected the eviction to follow the 2 buffered changes, got %v dropped %d evicted %t", pending, dropped, evicted)
+	}
+}
+
+// TestWatchFullBuffer checks that watchers which never read, under either policy, do not
+// block changes to the counter nor hold back the delivery of changes to other watchers
+func TestWatchFullBuffer(t *testing.T) {
+	server, c := newTestCounter(t, SlowConsumerDrop, 1)
+
+	stalled := []*watcher{}
+	for _, policy := range []SlowConsumerPolicy{SlowConsumerDrop, SlowConsumerDisconnect} {
+		w, _ := c.watch(policy, 1)
+		defer c.unwatch(w)
+		stalled = append(stalled, w)
+	}
+	w, _ := c.watch(SlowConsumerDrop, 1000)
+	defer c.unwatch(w)
+
+	addChanges(t, server, c, 1000)
+
+	for _, stalledW := range stalled {
+		if len(stalledW.changes) != 1 || !isSignalled(stalledW) {
+			t.Fatalf("expected the %s watcher to hold a single change and be signalled", stalledW.policy)
+		}
+	}
+	if len(w.changes) != 1000 || isSignalled(w) {
+		t.Fatalf("expected every change to be delivered to the watcher with room, got %d", len(w.changes))
+	}
+}
+
+// watchStream serves the server using httptest and starts a Watch RPC for the counter, the
+// initial total having been received when it returns
+func watchStream(t *testing.T, ctx context.Context, server *PingServer, name string) (stream *connect.ServerStreamForClient[pingv1.WatchResponse]) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(server))
+	httpServer := httptest.NewServer(mux)
+	t.Cleanup(httpServer.Close)
+
+	client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL)
+	stream, err := client.Watch(ctx, connect.NewRequest(&pingv1.WatchRequest{Counter: name}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Close() })
+	if !stream.Receive() {
+		t.Fatalf("expected the initial total, %v", stream.Err())
+	}
+	return stream
+}
+
+// fallBehind changes the counter until a watcher has dropped a change, or been evicted, doing so
+// while the client of the Watch RPC is not reading fills the buffers of the connection and then
+// those of the watcher, the number of changes made is returned
+func fallBehind(t *testing.T, server *PingServer, c *counter) (count int) {
+	t.Helper()
+
+	isBehind := func() bool {
+		c.Lock()
+		defer c.Unlock()
+		for w := range c.watchers {
+			if w.dropped != 0 {
+				return true
+			}
+		}
+		return len(c.watchers) == 0
+	}
+
+	for !isBehind() {
+		if count > 50_000_000 {
+			t.Fatal("the watcher did not fall behind")
+		}
+		addChanges(t, server, c, 1000)
+		count += 1000
+	}
+	return count
+}
+
+func TestWatchSlowConsumerDrop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, c := newTestCounter(t, SlowConsumerDrop, 4)
+	stream := watchStream(t, ctx, server, "watched")
+
+	// Changes made after the watcher fell behind are still reported once it catches up
+	count := fallBehind(t, server, c) + 100
+	addChanges(t, server, c, 100)
+	final := c.load()
+
+	// Every change is either received, or accounted for by a gap, and the watcher ends up
+	// with the final total
+	received, dropped, previous := 0, uint64(0), int64(0)
+	for stream.Receive() {
+		msg := stream.Msg()
+		if msg.Gap {
+			dropped += msg.Dropped
+		} else {
+			if msg.Sum64 <= previous {
+				t.Fatalf("expected changes to arrive in order, %d followed %d", msg.Sum64, previous)
+			}
+			received++
+		}
+		previous = msg.Sum64
+		if previous == final {
+			break
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if previous != final {
+		t.Fatalf("expected the watch to reach the total %d, got %d", final, previous)
+	}
+	if dropped == 0 {
+		t.Fatal("expected a gap to be reported")
+	}
+	if received+int(dropped) != count {
+		t.Fatalf("expected %d changes to be received, or dropped, got %d received %d dropped", count, received, dropped)
+	}
+}
+
+func TestWatchSlowConsumerDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, c := newTestCounter(t, SlowConsumerDisconnect, 4)
+	stream := watchStream(t, ctx, server, "watched")
+	fallBehind(t, server, c)
+
+	// The changes sent before the eviction are received followed by the error ending the RPC
+	previous := int64(0)
+	for stream.Receive() {
+		if msg := stream.Msg(); msg.Gap || msg.Sum64 != previous+1 {
+			t.Fatalf("expected the change following the total %d, got %v", previous, msg)
+		}
+		previous++
+	}
+	connectErr := &connect.Error{}
+	if !errors.As(stream.Err(), &connectErr) || connectErr.Code() != connect.CodeResourceExhausted {
+		t.Fatalf("expected the watch to end with %s, got %v", connect.CodeResourceExhausted, stream.Err())
+	}
+}
@@ -0,0 +1,41 @@
+package pingtest
+
+// This file contains the generation of the CA, and server certificate, used by the servers
+// started for tests.
+
+import (
+	"path/filepath"
+
+	"github.com/karlmutch/buf-ping/pkg/devcert"
+
+	"github.com/karlmutch/kv"
+)
+
+// Certificates holds the PEM files of a freshly generated CA, and of a server certificate
+// issued by it
+type Certificates struct {
+	// CAFn is the CA certificate clients use to verify the server
+	CAFn string
+	// CertFn, and KeyFn are the server certificate and its private key
+	CertFn string
+	KeyFn  string
+}
+
+// NewCertificates generates a CA, and a server certificate issued by it for the hosts,
+// which can be DNS names or IP addresses, and writes them into the directory
+func NewCertificates(dir string, hosts []string) (certs *Certificates, err kv.Error) {
+	certs = &Certificates{
+		CAFn:   filepath.Join(dir, "ca.crt"),
+		CertFn: filepath.Join(dir, "server.crt"),
+		KeyFn:  filepath.Join(dir, "server.key"),
+	}
+	if _, err = devcert.Ensure(devcert.Opts{
+		CertFn: certs.CertFn,
+		KeyFn:  certs.KeyFn,
+		CAFn:   certs.CAFn,
+		Hosts:  hosts,
+	}); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
@@ -0,0 +1,154 @@
+package pingtest
+
+// This file contains a harness that runs a server in-process for tests.  The server is
+// started on a free loopback port using a freshly generated CA and server certificate,
+// the harness waits for it to report that it has started, hands out clients configured
+// to reach it, and stops it again once the test is complete.
+//
+// The harness does not depend upon the server itself, which lives in a main package that
+// cannot be imported, instead tests supply a StartFunc that runs their server using the
+// Config they are given, for pingsrv that is a thin wrapper around its EntryPoint.
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/karlmutch/buf-ping/pkg/ping/client"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// ServerName is the host name the server certificate is issued for, and that clients verify
+const ServerName = "localhost"
+
+// startTimeout limits the time a server is given to report that it has started
+const startTimeout = 30 * time.Second
+
+// Config is the configuration a StartFunc uses to run its server
+type Config struct {
+	// Addr is the loopback host:port the server listens on
+	Addr string
+	// Certs are the server certificate and key, along with the CA that issued them
+	Certs *Certificates
+	// StartedC is closed by the server once it is ready to accept requests
+	StartedC chan any
+	// Logger receives the logging of the server, it is discarded unless the test is verbose
+	Logger *slog.Logger
+}
+
+// StartFunc runs a server using the configuration until the context is cancelled, returning
+// only once the server has stopped
+type StartFunc func(ctx context.Context, cfg *Config) (errs []kv.Error)
+
+// Server is a server running in-process for the duration of a test
+type Server struct {
+	Config
+
+	cancel context.CancelFunc
+	// doneC is closed once the StartFunc has returned, after which errs holds its errors
+	doneC chan struct{}
+	errs  []kv.Error
+}
+
+// Start runs a server using the start function and waits for it to be ready.  The server is
+// stopped when the test, and its subtests, complete.
+func Start(t testing.TB, start StartFunc) (srv *Server) {
+	t.Helper()
+
+	certs, err := NewCertificates(t.TempDir(), []string{ServerName, "127.0.0.1", "::1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	addr, err := freeAddr()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	output := io.Discard
+	if testing.Verbose() {
+		output = os.Stderr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv = &Server{
+		Config: Config{
+			Addr:     addr,
+			Certs:    certs,
+			StartedC: make(chan any),
+			Logger:   slog.New(slog.NewTextHandler(output, nil)),
+		},
+		cancel: cancel,
+		doneC:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(srv.doneC)
+		srv.errs = start(ctx, &srv.Config)
+	}()
+	t.Cleanup(func() {
+		if errs := srv.Stop(); len(errs) != 0 {
+			t.Error(errs)
+		}
+	})
+
+	select {
+	case <-srv.StartedC:
+	case <-srv.doneC:
+		t.Fatal("server stopped before it started", srv.errs)
+	case <-time.After(startTimeout):
+		t.Fatalf("server did not start within %s", startTimeout)
+	}
+	return srv
+}
+
+// freeAddr returns a loopback address with a port that was free when it was checked
+func freeAddr() (addr string, err kv.Error) {
+	ln, errGo := net.Listen("tcp", "127.0.0.1:0")
+	if errGo != nil {
+		return "", kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	addr = ln.Addr().String()
+	if errGo = ln.Close(); errGo != nil {
+		return "", kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+	}
+	return addr, nil
+}
+
+// NewClient returns a client for the server, the CA, and server name, of the options are
+// set to those of the server, and a DialTimeout, and Timeout, are applied unless supplied
+func (srv *Server) NewClient(t testing.TB, opts client.Opts) (c *client.Client) {
+	t.Helper()
+
+	opts.CAFile = srv.Certs.CAFn
+	opts.ServerName = ServerName
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	c, err := client.NewClient(srv.Addr, opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return c
+}
+
+// Stop asks the server to stop and waits for it to do so, returning the errors of the server.
+// Stop is called automatically when the test completes and it is safe to call it more than once.
+func (srv *Server) Stop() (errs []kv.Error) {
+	srv.cancel()
+	<-srv.doneC
+	for _, err := range srv.errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
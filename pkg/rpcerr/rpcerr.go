@@ -0,0 +1,146 @@
+package rpcerr
+
+// This file contains the construction of the connect errors returned by the
+// servers RPCs.  The kv errors used within the server carry their context as key
+// value pairs along with a stack trace, rather than flattening these into the
+// error message they are returned to clients as structured google.rpc error
+// details.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/karlmutch/kv"
+)
+
+// Domain is the domain of the ErrorInfo details returned by the server
+const Domain = "bufping.karlmutch.github.com"
+
+// stackKey is the key of the kv error field holding the stack trace
+const stackKey = "stack"
+
+// parsed is an error split into its message, fields, and stack trace
+type parsed struct {
+	text   string
+	fields kv.List
+	stack  []string
+}
+
+// parse splits the text of an error into the message, the key value pairs, and the stack trace
+func parse(err error) (p parsed) {
+	text, list := kv.Parse([]byte(err.Error()))
+	p = parsed{
+		text:   string(text),
+		fields: kv.List{},
+	}
+	keyvals := list.Keyvals()
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if fmt.Sprint(keyvals[i]) == stackKey {
+			p.stack = strings.Fields(strings.Trim(fmt.Sprint(keyvals[i+1]), "[]"))
+			continue
+		}
+		p.fields = p.fields.With(keyvals[i], keyvals[i+1])
+	}
+	return p
+}
+
+// message returns the error message with the fields, but not the stack trace, of the error
+func (p parsed) message() string {
+	if len(p.fields) == 0 {
+		return p.text
+	}
+	return strings.TrimSpace(p.text + " " + p.fields.String())
+}
+
+// metadata returns the fields of the error as ErrorInfo metadata
+func (p parsed) metadata() (metadata map[string]string) {
+	metadata = make(map[string]string, len(p.fields)/2)
+	for i := 0; i+1 < len(p.fields); i += 2 {
+		metadata[fmt.Sprint(p.fields[i])] = fmt.Sprint(p.fields[i+1])
+	}
+	return metadata
+}
+
+// Text returns the message of a kv error without its fields
+func Text(err error) (text string) {
+	return parse(err).text
+}
+
+// Field returns the value of a field of a kv error
+func Field(err error, key string) (value string, isPresent bool) {
+	fields := parse(err).fields
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fmt.Sprint(fields[i]) == key {
+			return fmt.Sprint(fields[i+1]), true
+		}
+	}
+	return "", false
+}
+
+// NewError returns a connect error whose message omits the stack trace of err, no details are attached
+func NewError(code connect.Code, err error) (connectErr *connect.Error) {
+	return connect.NewError(code, errors.New(parse(err).message()))
+}
+
+// New returns a connect error carrying an ErrorInfo with the reason and the fields of err, and a
+// DebugInfo with the stack trace of err.  The reason is an UPPER_SNAKE_CASE identifier of the
+// cause of the error that clients can rely upon.
+func New(code connect.Code, reason string, err error) (connectErr *connect.Error) {
+	connectErr = NewError(code, err)
+	AddErrorInfo(connectErr, reason, err)
+	AddDebugInfo(connectErr, err)
+	return connectErr
+}
+
+// AddErrorInfo attaches an ErrorInfo with the reason and the fields of err
+func AddErrorInfo(connectErr *connect.Error, reason string, err error) *connect.Error {
+	add(connectErr, &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   Domain,
+		Metadata: parse(err).metadata(),
+	})
+	return connectErr
+}
+
+// AddDebugInfo attaches a DebugInfo with the stack trace of err
+func AddDebugInfo(connectErr *connect.Error, err error) *connect.Error {
+	p := parse(err)
+	add(connectErr, &errdetails.DebugInfo{
+		StackEntries: p.stack,
+		Detail:       p.message(),
+	})
+	return connectErr
+}
+
+// AddRetryInfo attaches a RetryInfo advising clients to wait for the delay before retrying
+func AddRetryInfo(connectErr *connect.Error, delay time.Duration) *connect.Error {
+	add(connectErr, &errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+	return connectErr
+}
+
+// AddBadRequest attaches a BadRequest describing why the field of the request is invalid
+func AddBadRequest(connectErr *connect.Error, field string, description string) *connect.Error {
+	add(connectErr, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		},
+	})
+	return connectErr
+}
+
+func add(connectErr *connect.Error, msg proto.Message) {
+	// NewErrorDetail only fails for messages that cannot be marshalled, which the
+	// google.rpc details used here always can be
+	if detail, errGo := connect.NewErrorDetail(msg); errGo == nil {
+		connectErr.AddDetail(detail)
+	}
+}
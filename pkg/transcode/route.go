@@ -0,0 +1,183 @@
+package transcode
+
+// This file contains the routes built from the google.api.http annotations of the
+// transcoded services.  Path templates are made of literal segments, single segment
+// wildcards, and variables binding a single segment to a field of the request, and
+// can end with a custom verb, for example /v1/counters/{counter}:reset.  Multi
+// segment wildcards, and variables holding patterns, are not supported.
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+)
+
+// segment is a single segment of a path template
+type segment struct {
+	// literal is matched exactly when the segment is neither a wildcard nor a variable
+	literal string
+	// field is the dotted path of the request field a variable binds the segment to
+	field  string
+	isWild bool
+}
+
+// route maps the requests matching an HTTP rule to a procedure
+type route struct {
+	method   string
+	segments []segment
+	verb     string
+	// body is empty when the request has no body, * when the body is the request message,
+	// or the name of the request field holding the body
+	body string
+
+	procedure string
+	desc      protoreflect.MethodDescriptor
+}
+
+// newRoutes returns the routes of every HTTP rule, including the additional bindings, of
+// the methods of a service
+func newRoutes(service protoreflect.ServiceDescriptor) (routes []*route, err kv.Error) {
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		rule, _ := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if rule == nil {
+			continue
+		}
+		for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			r, err := newRoute(md, binding)
+			if err != nil {
+				return nil, err.With("procedure", procedureOf(md))
+			}
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+// procedureOf returns the procedure name of a method, for example /ping.v1.PingService/Ping
+func procedureOf(md protoreflect.MethodDescriptor) (procedure string) {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+func newRoute(md protoreflect.MethodDescriptor, rule *annotations.HttpRule) (r *route, err kv.Error) {
+	r = &route{
+		body:      rule.GetBody(),
+		procedure: procedureOf(md),
+		desc:      md,
+	}
+
+	template := ""
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		r.method, template = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		r.method, template = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		r.method, template = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		r.method, template = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		r.method, template = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		r.method, template = pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	default:
+		return nil, kv.NewError("HTTP rule has no pattern").With("stack", stack.Trace().TrimRuntime())
+	}
+
+	if r.segments, r.verb, err = parseTemplate(template); err != nil {
+		return nil, err
+	}
+	for _, s := range r.segments {
+		if len(s.field) == 0 {
+			continue
+		}
+		if _, err = fieldOf(md.Input(), s.field); err != nil {
+			return nil, err.With("template", template)
+		}
+	}
+
+	switch r.body {
+	case "", "*":
+	default:
+		if md.Input().Fields().ByName(protoreflect.Name(r.body)) == nil {
+			return nil, kv.NewError("HTTP rule body is not a field of the request").With("body", r.body, "stack", stack.Trace().TrimRuntime())
+		}
+	}
+	if md.IsStreamingClient() && r.body != "*" {
+		return nil, kv.NewError("HTTP rules of client streaming methods must use the request as the body").With("stack", stack.Trace().TrimRuntime())
+	}
+	return r, nil
+}
+
+// splitVerb separates the custom verb from the final segment of a path
+func splitVerb(path string) (rest string, verb string) {
+	i := strings.LastIndex(path, ":")
+	if i < 0 || i < strings.LastIndex(path, "/") || i < strings.LastIndex(path, "}") {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// parseTemplate parses a path template, for example /v1/counters/{counter}:reset
+func parseTemplate(template string) (segments []segment, verb string, err kv.Error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, "", kv.NewError("path templates must start with a /").With("template", template, "stack", stack.Trace().TrimRuntime())
+	}
+	path, verb := splitVerb(template)
+	for _, part := range strings.Split(path[1:], "/") {
+		switch {
+		case part == "*":
+			segments = append(segments, segment{isWild: true})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			field, pattern, _ := strings.Cut(part[1:len(part)-1], "=")
+			if pattern != "" && pattern != "*" {
+				return nil, "", kv.NewError("path template variables may only match a single segment").With("template", template, "stack", stack.Trace().TrimRuntime())
+			}
+			segments = append(segments, segment{field: field})
+		case len(part) == 0 || strings.ContainsAny(part, "{}*"):
+			return nil, "", kv.NewError("unsupported path template segment").With("template", template, "segment", part, "stack", stack.Trace().TrimRuntime())
+		default:
+			segments = append(segments, segment{literal: part})
+		}
+	}
+	return segments, verb, nil
+}
+
+// match returns the values of the variables of the route when the request matches it
+func (r *route) match(method string, path string) (vars map[string]string, isMatch bool) {
+	if method != r.method {
+		return nil, false
+	}
+	path, verb := splitVerb(path)
+	if verb != r.verb || !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	parts := strings.Split(path[1:], "/")
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+
+	vars = map[string]string{}
+	for i, s := range r.segments {
+		value, errGo := url.PathUnescape(parts[i])
+		if errGo != nil || len(value) == 0 {
+			return nil, false
+		}
+		switch {
+		case len(s.field) != 0:
+			vars[s.field] = value
+		case s.isWild:
+		case s.literal != value:
+			return nil, false
+		}
+	}
+	return vars, true
+}
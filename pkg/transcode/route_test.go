@@ -0,0 +1,147 @@
+package transcode
+
+// This file contains tests of the parsing of path templates, and of the matching of requests
+// to the routes built from them.
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	_ "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+)
+
+// newPingHandler returns a handler transcoding the services of ping.proto, requests not
+// matching a route are passed to next
+func newPingHandler(t *testing.T, next http.Handler) (h *Handler) {
+	t.Helper()
+
+	h, err := NewHandler(next, Opts{Services: []string{"ping.v1.PingService", "ping.v1.FaultService"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return h
+}
+
+func TestParseTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		segments []segment
+		verb     string
+		isError  bool
+	}{
+		{template: "/v1/ping", segments: []segment{{literal: "v1"}, {literal: "ping"}}},
+		{template: "/v1/counters/{counter}", segments: []segment{{literal: "v1"}, {literal: "counters"}, {field: "counter"}}},
+		{template: "/v1/counters/{counter=*}", segments: []segment{{literal: "v1"}, {literal: "counters"}, {field: "counter"}}},
+		{template: "/v1/counters/{counter}:reset", segments: []segment{{literal: "v1"}, {literal: "counters"}, {field: "counter"}}, verb: "reset"},
+		{template: "/v1/*/items:list", segments: []segment{{literal: "v1"}, {isWild: true}, {literal: "items"}}, verb: "list"},
+		{template: "v1/ping", isError: true},
+		{template: "/v1//ping", isError: true},
+		{template: "/v1/**", isError: true},
+		{template: "/v1/{name=counters/*}", isError: true},
+		{template: "/v1/x{name}", isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.template, func(t *testing.T) {
+			segments, verb, err := parseTemplate(tc.template)
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected the template to be refused, got %v", segments)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				return
+			}
+			if !reflect.DeepEqual(segments, tc.segments) || verb != tc.verb {
+				t.Fatalf("expected %v verb %q, got %v verb %q", tc.segments, tc.verb, segments, verb)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	h := newPingHandler(t, http.NotFoundHandler())
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		procedure string
+		vars      map[string]string
+	}{
+		{name: "literal", method: http.MethodGet, path: "/v1/ping", procedure: "/ping.v1.PingService/Ping", vars: map[string]string{}},
+		{name: "variable", method: http.MethodGet, path: "/v1/counters/requests", procedure: "/ping.v1.PingService/Ping", vars: map[string]string{"counter": "requests"}},
+		{name: "escaped variable", method: http.MethodGet, path: "/v1/counters/a%2Fb%3Ac", procedure: "/ping.v1.PingService/Ping", vars: map[string]string{"counter": "a/b:c"}},
+		{name: "verb", method: http.MethodGet, path: "/v1/counters/requests:watch", procedure: "/ping.v1.PingService/Watch", vars: map[string]string{"counter": "requests"}},
+		{name: "method", method: http.MethodPut, path: "/v1/counters/requests", procedure: "/ping.v1.PingService/Set", vars: map[string]string{"counter": "requests"}},
+		{name: "method and verb", method: http.MethodPost, path: "/v1/counters/requests:reset", procedure: "/ping.v1.PingService/Reset", vars: map[string]string{"counter": "requests"}},
+		{name: "second service", method: http.MethodPut, path: "/v1/faults", procedure: "/ping.v1.FaultService/SetFaultRules", vars: map[string]string{}},
+		{name: "unknown verb", method: http.MethodGet, path: "/v1/counters/requests:stop"},
+		{name: "unknown method", method: http.MethodDelete, path: "/v1/counters/requests"},
+		{name: "empty variable", method: http.MethodGet, path: "/v1/counters/"},
+		{name: "extra segment", method: http.MethodGet, path: "/v1/counters/a/b"},
+		{name: "missing segment", method: http.MethodGet, path: "/v1/counters"},
+		{name: "connect procedure", method: http.MethodPost, path: "/ping.v1.PingService/Ping"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rt, vars := h.find(tc.method, tc.path)
+			if len(tc.procedure) == 0 {
+				if rt != nil {
+					t.Fatalf("expected no route, got %s", rt.procedure)
+				}
+				return
+			}
+			if rt == nil {
+				t.Fatalf("expected %s, got no route", tc.procedure)
+			}
+			if rt.procedure != tc.procedure || !reflect.DeepEqual(vars, tc.vars) {
+				t.Fatalf("expected %s %v, got %s %v", tc.procedure, tc.vars, rt.procedure, vars)
+			}
+		})
+	}
+}
+
+// TestMatchConflicts checks that when several routes match a request the route declared first
+// is used, whether it is a literal, wildcard, or variable route
+func TestMatchConflicts(t *testing.T) {
+	newRoute := func(t *testing.T, procedure string, template string) (rt *route) {
+		t.Helper()
+		segments, verb, err := parseTemplate(template)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return &route{method: http.MethodGet, segments: segments, verb: verb, procedure: procedure}
+	}
+
+	testCases := []struct {
+		name      string
+		templates []string
+		path      string
+		procedure string
+	}{
+		{name: "variable first", templates: []string{"/v1/{name}", "/v1/special"}, path: "/v1/special", procedure: "0"},
+		{name: "literal first", templates: []string{"/v1/special", "/v1/{name}"}, path: "/v1/special", procedure: "0"},
+		{name: "wildcard first", templates: []string{"/v1/*", "/v1/{name}"}, path: "/v1/special", procedure: "0"},
+		{name: "only the second matches", templates: []string{"/v1/special", "/v1/{name}"}, path: "/v1/other", procedure: "1"},
+		{name: "verb distinguishes", templates: []string{"/v1/{name}", "/v1/{name}:special"}, path: "/v1/other:special", procedure: "1"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{}
+			for i, template := range tc.templates {
+				h.routes = append(h.routes, newRoute(t, string(rune('0'+i)), template))
+			}
+			rt, _ := h.find(http.MethodGet, tc.path)
+			if rt == nil || rt.procedure != tc.procedure {
+				t.Fatalf("expected route %s to be used, got %v", tc.procedure, rt)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package transcode
+
+// This file contains the transcoding of streaming RPCs.  Requests of client streaming
+// RPCs are a sequence of JSON messages, usually newline delimited, each of which is
+// sent to the RPC as it is read.  Responses of server streaming RPCs are returned as
+// newline delimited JSON, or as server-sent events when the client accepts
+// text/event-stream, and an error ending the stream is returned as a final message
+// holding only an error field, or an error event.  Errors before the first message
+// of the response use the HTTP status and JSON body of unary RPCs.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+const (
+	// envelopeHeader is the size of the header preceding every message of a Connect stream
+	envelopeHeader = 5
+	// flagCompressed, and flagEndStream, are the envelope flags of compressed messages, and
+	// of the message ending a stream
+	flagCompressed = 0x01
+	flagEndStream  = 0x02
+)
+
+// format is the encoding of the response of a streaming RPC
+type format int
+
+const (
+	// formatJSON is a single JSON message, used by client streaming RPCs
+	formatJSON format = iota
+	// formatNDJSON is newline delimited JSON
+	formatNDJSON
+	// formatSSE is server-sent events
+	formatSSE
+)
+
+// envelope returns the message enveloped for a Connect stream
+func envelope(data []byte) (enveloped []byte) {
+	enveloped = make([]byte, envelopeHeader, envelopeHeader+len(data))
+	binary.BigEndian.PutUint32(enveloped[1:], uint32(len(data)))
+	return append(enveloped, data...)
+}
+
+// serveStream passes a streaming RPC to the next handler as a Connect streaming request, and
+// translates the response stream
+func (h *Handler) serveStream(w http.ResponseWriter, r *http.Request, rt *route, vars map[string]string) {
+	sw := &streamWriter{
+		w:           w,
+		r:           r,
+		errorWriter: h.errorWriter,
+		header:      http.Header{},
+	}
+	switch {
+	case !rt.desc.IsStreamingServer():
+		sw.format = formatJSON
+	case strings.Contains(r.Header.Get("Accept"), "text/event-stream"):
+		sw.format = formatSSE
+	default:
+		sw.format = formatNDJSON
+	}
+
+	// Server streaming RPCs have their single request decoded before the RPC starts so that
+	// invalid requests are rejected immediately
+	if !rt.desc.IsStreamingClient() {
+		body, errGo := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if errGo != nil {
+			h.writeError(w, r, invalidRequest(kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())))
+			return
+		}
+		msg, err := rt.decode(body, vars, r.URL.Query())
+		if err != nil {
+			h.writeError(w, r, invalidRequest(err))
+			return
+		}
+		data, errGo := protojson.Marshal(msg)
+		if errGo != nil {
+			h.writeError(w, r, rpcerr.NewError(connect.CodeInternal, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())))
+			return
+		}
+		h.next.ServeHTTP(sw, streamRequest(r, rt, io.NopCloser(bytes.NewReader(envelope(data)))))
+		sw.finish(nil)
+		return
+	}
+
+	// Client streaming RPCs read the request body while the response is being written, which
+	// HTTP/1.1 servers must be told to allow
+	_ = http.NewResponseController(w).EnableFullDuplex()
+
+	reader, writer := io.Pipe()
+	enc := &requestEncoder{route: rt, vars: vars, doneC: make(chan struct{})}
+	go enc.encode(r.Body, writer)
+
+	h.next.ServeHTTP(sw, streamRequest(r, rt, reader))
+
+	// Closing the reader stops the encoder when the RPC ended without reading every message
+	reader.Close()
+	<-enc.doneC
+	sw.finish(enc.err)
+}
+
+// streamRequest returns the Connect streaming request for a REST request.  The request is
+// given the protocol version of HTTP/2, as bidirectional streams are refused over HTTP/1.1,
+// the translation supporting them over either.
+func streamRequest(r *http.Request, rt *route, body io.ReadCloser) (req *http.Request) {
+	req = connectRequest(r, rt, "application/connect+json", body)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+	return req
+}
+
+// requestEncoder encodes the JSON messages of the body of a client streaming REST request
+// as the messages of a Connect stream
+type requestEncoder struct {
+	route *route
+	vars  map[string]string
+
+	// err is the error decoding the body, it is set before doneC is closed
+	err   kv.Error
+	doneC chan struct{}
+}
+
+func (enc *requestEncoder) encode(body io.Reader, writer *io.PipeWriter) {
+	defer close(enc.doneC)
+
+	decoder := json.NewDecoder(body)
+	for {
+		raw := json.RawMessage{}
+		if errGo := decoder.Decode(&raw); errGo != nil {
+			if errors.Is(errGo, io.EOF) {
+				writer.Close()
+				return
+			}
+			enc.err = kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+			writer.CloseWithError(errGo)
+			return
+		}
+		msg, err := enc.route.decode(raw, enc.vars, nil)
+		if err != nil {
+			enc.err = err
+			writer.CloseWithError(err)
+			return
+		}
+		data, errGo := protojson.Marshal(msg)
+		if errGo != nil {
+			enc.err = kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())
+			writer.CloseWithError(errGo)
+			return
+		}
+		if _, errGo = writer.Write(envelope(data)); errGo != nil {
+			// The RPC has ended without reading the remaining messages
+			return
+		}
+	}
+}
+
+// wireError is the JSON form of the error ending a Connect stream
+type wireError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	Details []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"details,omitempty"`
+}
+
+// connectError returns the connect error described by the JSON form
+func (wire *wireError) connectError() (connectErr *connect.Error) {
+	code := connect.CodeUnknown
+	_ = code.UnmarshalText([]byte(wire.Code))
+	connectErr = connect.NewError(code, errors.New(wire.Message))
+	for _, d := range wire.Details {
+		value, errGo := base64.RawStdEncoding.DecodeString(strings.TrimRight(d.Value, "="))
+		if errGo != nil {
+			continue
+		}
+		detail, errGo := connect.NewErrorDetail(&anypb.Any{TypeUrl: "type.googleapis.com/" + d.Type, Value: value})
+		if errGo != nil {
+			continue
+		}
+		connectErr.AddDetail(detail)
+	}
+	return connectErr
+}
+
+// streamWriter is the http.ResponseWriter given to the Connect handler, it translates the
+// enveloped messages written to it into the format of the REST response
+type streamWriter struct {
+	w           http.ResponseWriter
+	r           *http.Request
+	errorWriter *connect.ErrorWriter
+	format      format
+
+	header      http.Header
+	status      int
+	buf         []byte
+	end         []byte
+	isCommitted bool
+	// err is set once the response written by the handler cannot be translated
+	err error
+	sync.Mutex
+}
+
+// Header implements the http.ResponseWriter interface
+func (sw *streamWriter) Header() http.Header {
+	return sw.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface
+func (sw *streamWriter) WriteHeader(status int) {
+	sw.Lock()
+	defer sw.Unlock()
+	if sw.status == 0 {
+		sw.status = status
+	}
+}
+
+// Write implements the http.ResponseWriter interface, each complete envelope is translated
+// as soon as it has been written
+func (sw *streamWriter) Write(p []byte) (n int, errGo error) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	sw.buf = append(sw.buf, p...)
+	for len(sw.buf) >= envelopeHeader {
+		size := int(binary.BigEndian.Uint32(sw.buf[1:envelopeHeader]))
+		if len(sw.buf) < envelopeHeader+size {
+			break
+		}
+		flags, data := sw.buf[0], sw.buf[envelopeHeader:envelopeHeader+size]
+		sw.buf = sw.buf[envelopeHeader+size:]
+
+		switch {
+		case flags&flagCompressed != 0:
+			sw.err = kv.NewError("compressed response messages cannot be transcoded").With("stack", stack.Trace().TrimRuntime())
+			return 0, sw.err
+		case flags&flagEndStream != 0:
+			sw.end = append([]byte{}, data...)
+		default:
+			if errGo = sw.message(data); errGo != nil {
+				sw.err = errGo
+				return 0, errGo
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Flush implements the http.Flusher interface, messages are flushed as they are translated
+func (sw *streamWriter) Flush() {}
+
+// commit writes the headers of the REST response
+func (sw *streamWriter) commit() {
+	if sw.isCommitted {
+		return
+	}
+	sw.isCommitted = true
+
+	for name, values := range sw.header {
+		switch name {
+		case "Content-Type", "Content-Length", "Content-Encoding", "Connect-Content-Encoding", "Connect-Accept-Encoding":
+		default:
+			sw.w.Header()[name] = values
+		}
+	}
+	switch sw.format {
+	case formatJSON:
+		sw.w.Header().Set("Content-Type", "application/json")
+	case formatNDJSON:
+		sw.w.Header().Set("Content-Type", "application/x-ndjson")
+	case formatSSE:
+		sw.w.Header().Set("Content-Type", "text/event-stream")
+		sw.w.Header().Set("Cache-Control", "no-cache")
+	}
+	sw.w.WriteHeader(http.StatusOK)
+}
+
+// message writes a response message in the format of the REST response
+func (sw *streamWriter) message(data []byte) (errGo error) {
+	sw.commit()
+	switch sw.format {
+	case formatJSON:
+		_, errGo = sw.w.Write(data)
+	case formatNDJSON:
+		_, errGo = sw.w.Write(append(append([]byte{}, data...), '\n'))
+	case formatSSE:
+		_, errGo = sw.w.Write([]byte("data: " + string(data) + "\n\n"))
+	}
+	if errGo != nil {
+		return errGo
+	}
+	_ = http.NewResponseController(sw.w).Flush()
+	return nil
+}
+
+// finish completes the REST response once the RPC has ended, requestErr is the error decoding
+// the request messages, if any, which replaces the error of the RPC
+func (sw *streamWriter) finish(requestErr kv.Error) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	var connectErr *connect.Error
+	errJSON := []byte{}
+	switch {
+	case requestErr != nil:
+		connectErr = invalidRequest(requestErr)
+	case len(sw.end) != 0:
+		end := struct {
+			Error json.RawMessage `json:"error"`
+		}{}
+		if errGo := json.Unmarshal(sw.end, &end); errGo == nil && len(end.Error) != 0 && !bytes.Equal(end.Error, []byte("null")) {
+			wire := &wireError{}
+			if errGo = json.Unmarshal(end.Error, wire); errGo == nil {
+				connectErr = wire.connectError()
+				errJSON = end.Error
+			}
+		}
+	case sw.err != nil:
+		connectErr = rpcerr.NewError(connect.CodeInternal, sw.err)
+	case sw.status != 0 && sw.status != http.StatusOK && !sw.isCommitted:
+		// The handler refused the request without starting the stream
+		sw.w.WriteHeader(sw.status)
+		return
+	}
+
+	if connectErr == nil {
+		sw.commit()
+		return
+	}
+	if !sw.isCommitted {
+		sw.isCommitted = true
+		for name, values := range sw.header {
+			if strings.HasPrefix(name, "Content-") || strings.HasPrefix(name, "Connect-") {
+				continue
+			}
+			sw.w.Header()[name] = values
+		}
+		_ = sw.errorWriter.Write(sw.w, sw.r, connectErr)
+		return
+	}
+
+	// The stream has started so the error is sent as its final message
+	if len(errJSON) == 0 {
+		errJSON, _ = json.Marshal(&wireError{Code: connectErr.Code().String(), Message: connectErr.Message()})
+	}
+	switch sw.format {
+	case formatNDJSON:
+		_, _ = sw.w.Write([]byte(`{"error":` + string(errJSON) + "}\n"))
+	case formatSSE:
+		_, _ = sw.w.Write([]byte("event: error\ndata: " + string(errJSON) + "\n\n"))
+	}
+	_ = http.NewResponseController(sw.w).Flush()
+}
@@ -0,0 +1,219 @@
+package transcode
+
+// This file contains tests of the REST transcoding of streaming RPCs made against a PingServer
+// running in-process, covering the newline delimited JSON, and server-sent event, responses
+// along with the errors that end them.
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	"github.com/karlmutch/buf-ping/proto/gen/go/ping/v1/pingv1connect"
+
+	"github.com/karlmutch/buf-ping/pkg/ping"
+)
+
+// restMessage is a single message of a streamed REST response, isError is set for the message,
+// or event, ending the stream with an error
+type restMessage struct {
+	data    string
+	isError bool
+}
+
+// readNDJSON returns the lines of a newline delimited JSON response
+func readNDJSON(t *testing.T, body io.Reader) (msgs []restMessage) {
+	t.Helper()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		end := struct {
+			Error json.RawMessage `json:"error"`
+		}{}
+		if errGo := json.Unmarshal([]byte(line), &end); errGo != nil {
+			t.Fatalf("invalid line %q, %v", line, errGo)
+		}
+		if len(end.Error) != 0 {
+			msgs = append(msgs, restMessage{data: string(end.Error), isError: true})
+			continue
+		}
+		msgs = append(msgs, restMessage{data: line})
+	}
+	if errGo := scanner.Err(); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return msgs
+}
+
+// readSSE returns the events of a server-sent event response
+func readSSE(t *testing.T, body io.Reader) (msgs []restMessage) {
+	t.Helper()
+
+	scanner := bufio.NewScanner(body)
+	msg := restMessage{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(line) == 0:
+			msgs = append(msgs, msg)
+			msg = restMessage{}
+		case line == "event: error":
+			msg.isError = true
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	if errGo := scanner.Err(); errGo != nil {
+		t.Fatal(errGo)
+	}
+	return msgs
+}
+
+// checkMessages compares the messages of a streamed response with those expected, a nil
+// message stands for an error ending the stream with the code
+func checkMessages(t *testing.T, msgs []restMessage, expected []proto.Message, code connect.Code) {
+	t.Helper()
+
+	if len(msgs) != len(expected) {
+		t.Fatalf("expected %d messages, got %v", len(expected), msgs)
+	}
+	for i, msg := range msgs {
+		if expected[i] == nil {
+			if !msg.isError {
+				t.Fatalf("expected message %d to be an error, got %s", i, msg.data)
+			}
+			wire := struct {
+				Code string `json:"code"`
+			}{}
+			if errGo := json.Unmarshal([]byte(msg.data), &wire); errGo != nil {
+				t.Fatal(errGo)
+			}
+			if wire.Code != code.String() {
+				t.Fatalf("expected a %s error, got %s", code, msg.data)
+			}
+			continue
+		}
+		if msg.isError {
+			t.Fatalf("unexpected error %s", msg.data)
+		}
+		decoded := expected[i].ProtoReflect().New().Interface()
+		if errGo := protojson.Unmarshal([]byte(msg.data), decoded); errGo != nil {
+			t.Fatal(errGo)
+		}
+		if !proto.Equal(decoded, expected[i]) {
+			t.Fatalf("expected message %d to be %v, got %v", i, expected[i], decoded)
+		}
+	}
+}
+
+// newPingServerHandler returns a handler transcoding requests for a new PingServer
+func newPingServerHandler(t *testing.T) (h *Handler) {
+	t.Helper()
+
+	server, err := ping.NewPingServer(*slog.New(slog.NewTextHandler(io.Discard, nil)), ping.PingServerOpts{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() {
+		if err := server.Close(); err != nil {
+			t.Error(err.Error())
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(server))
+	return newPingHandler(t, mux)
+}
+
+func TestServeStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected []proto.Message
+		code     connect.Code
+	}{
+		{
+			name:   "server stream",
+			method: http.MethodGet,
+			path:   "/v1/generate?addition=3",
+			expected: []proto.Message{
+				&pingv1.GenerateResponse{Progress: 1, Progress64: 1},
+				&pingv1.GenerateResponse{Progress: 2, Progress64: 2},
+				&pingv1.GenerateResponse{Progress: 3, Progress64: 3},
+			},
+		},
+		{
+			name:   "bidirectional stream",
+			method: http.MethodPost,
+			path:   "/v1/count",
+			body:   `{"addition":1}` + "\n" + `{"addition":2}` + "\n",
+			expected: []proto.Message{
+				&pingv1.CountResponse{Sum: 1, Sum64: 1},
+				&pingv1.CountResponse{Sum: 2, Sum64: 2},
+				&pingv1.CountResponse{Sum: 3, Sum64: 3},
+			},
+		},
+		{
+			name:   "invalid request message",
+			method: http.MethodPost,
+			path:   "/v1/count",
+			body:   `{"addition":1}` + "\n" + `{"addition":"one"}` + "\n",
+			expected: []proto.Message{
+				&pingv1.CountResponse{Sum: 1, Sum64: 1},
+				nil,
+			},
+			code: connect.CodeInvalidArgument,
+		},
+	}
+
+	formats := []struct {
+		name        string
+		accept      string
+		contentType string
+		read        func(t *testing.T, body io.Reader) []restMessage
+	}{
+		{name: "ndjson", contentType: "application/x-ndjson", read: readNDJSON},
+		{name: "sse", accept: "text/event-stream", contentType: "text/event-stream", read: readSSE},
+	}
+
+	for _, format := range formats {
+		format := format
+		t.Run(format.name, func(t *testing.T) {
+			for _, tc := range tests {
+				tc := tc
+				t.Run(tc.name, func(t *testing.T) {
+					h := newPingServerHandler(t)
+
+					req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+					if len(format.accept) != 0 {
+						req.Header.Set("Accept", format.accept)
+					}
+					w := httptest.NewRecorder()
+					h.ServeHTTP(w, req)
+
+					if w.Code != http.StatusOK {
+						t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+					}
+					if contentType := w.Header().Get("Content-Type"); contentType != format.contentType {
+						t.Fatalf("expected %q, got %q", format.contentType, contentType)
+					}
+					checkMessages(t, format.read(t, w.Body), tc.expected, tc.code)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package transcode
+
+// This file contains an http.Handler transcoding REST/JSON requests into Connect
+// protocol requests using the google.api.http annotations of the services.  The
+// translated requests are passed to the handler serving the services, so they are
+// subject to the same interceptors as any other RPC.  The fields of request messages
+// are populated from the path variables, the query parameters, and the JSON body, as
+// described by the HTTP rule.  Responses of unary RPCs are returned unchanged, while
+// streaming RPCs are translated in stream.go.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/go-stack/stack"
+	"github.com/karlmutch/kv"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+// maxBodyBytes limits the size of the body of unary requests
+const maxBodyBytes = 4 * 1024 * 1024 // 4MiB
+
+// Opts contains the options used when creating a Handler
+type Opts struct {
+	// Services are the fully qualified names of the services transcoded, they must be
+	// registered with the global protobuf registry by importing their generated code
+	Services []string
+}
+
+// Handler is an http.Handler serving the REST routes of the services, requests not matching
+// a route are passed to the next handler unchanged
+type Handler struct {
+	next        http.Handler
+	routes      []*route
+	errorWriter *connect.ErrorWriter
+}
+
+// NewHandler returns a handler transcoding the REST routes of the services to the Connect
+// protocol requests served by next
+func NewHandler(next http.Handler, opts Opts) (h *Handler, err kv.Error) {
+	h = &Handler{
+		next:        next,
+		errorWriter: connect.NewErrorWriter(),
+	}
+	for _, name := range opts.Services {
+		desc, errGo := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if errGo != nil {
+			return nil, kv.Wrap(errGo).With("service", name, "stack", stack.Trace().TrimRuntime())
+		}
+		service, isService := desc.(protoreflect.ServiceDescriptor)
+		if !isService {
+			return nil, kv.NewError("not a service").With("service", name, "stack", stack.Trace().TrimRuntime())
+		}
+		routes, err := newRoutes(service)
+		if err != nil {
+			return nil, err.With("service", name)
+		}
+		h.routes = append(h.routes, routes...)
+	}
+	return h, nil
+}
+
+// Routes returns the method and path template of every route, for logging
+func (h *Handler) Routes() (routes []string) {
+	routes = make([]string, 0, len(h.routes))
+	for _, r := range h.routes {
+		parts := make([]string, 0, len(r.segments))
+		for _, s := range r.segments {
+			switch {
+			case len(s.field) != 0:
+				parts = append(parts, "{"+s.field+"}")
+			case s.isWild:
+				parts = append(parts, "*")
+			default:
+				parts = append(parts, s.literal)
+			}
+		}
+		template := "/" + strings.Join(parts, "/")
+		if len(r.verb) != 0 {
+			template += ":" + r.verb
+		}
+		routes = append(routes, r.method+" "+template)
+	}
+	return routes
+}
+
+// find returns the first route, in the order the services, methods, and bindings were declared,
+// that matches the request along with the values of its variables
+func (h *Handler) find(method string, path string) (rt *route, vars map[string]string) {
+	for _, rt := range h.routes {
+		if vars, isMatch := rt.match(method, path); isMatch {
+			return rt, vars
+		}
+	}
+	return nil, nil
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, vars := h.find(r.Method, r.URL.EscapedPath())
+	switch {
+	case rt == nil:
+		h.next.ServeHTTP(w, r)
+	case rt.desc.IsStreamingClient() || rt.desc.IsStreamingServer():
+		h.serveStream(w, r, rt, vars)
+	default:
+		h.serveUnary(w, r, rt, vars)
+	}
+}
+
+// serveUnary passes a unary RPC to the next handler as a Connect unary request, the JSON
+// response of which is also the REST response
+func (h *Handler) serveUnary(w http.ResponseWriter, r *http.Request, rt *route, vars map[string]string) {
+	body, errGo := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if errGo != nil {
+		h.writeError(w, r, invalidRequest(kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())))
+		return
+	}
+	msg, err := rt.decode(body, vars, r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, invalidRequest(err))
+		return
+	}
+	data, errGo := protojson.Marshal(msg)
+	if errGo != nil {
+		h.writeError(w, r, rpcerr.NewError(connect.CodeInternal, kv.Wrap(errGo).With("stack", stack.Trace().TrimRuntime())))
+		return
+	}
+
+	req := connectRequest(r, rt, "application/json", io.NopCloser(bytes.NewReader(data)))
+	req.ContentLength = int64(len(data))
+	h.next.ServeHTTP(w, req)
+}
+
+// connectRequest returns a copy of the REST request, keeping its context and headers,
+// rewritten as a Connect protocol request for the procedure of the route
+func connectRequest(r *http.Request, rt *route, contentType string, body io.ReadCloser) (req *http.Request) {
+	req = r.Clone(r.Context())
+	req.Method = http.MethodPost
+	req.URL.Path = rt.procedure
+	req.URL.RawPath = ""
+	req.URL.RawQuery = ""
+	req.RequestURI = rt.procedure
+	req.Body = body
+	req.ContentLength = -1
+
+	for _, name := range []string{"Content-Length", "Content-Encoding", "Connect-Content-Encoding", "Connect-Accept-Encoding"} {
+		req.Header.Del(name)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Connect-Protocol-Version", "1")
+	return req
+}
+
+// invalidRequest is returned for REST requests that cannot be transcoded
+func invalidRequest(err kv.Error) (connectErr *connect.Error) {
+	connectErr = rpcerr.New(connect.CodeInvalidArgument, "INVALID_REST_REQUEST", err)
+	if field, isPresent := rpcerr.Field(err, "field"); isPresent {
+		connectErr = rpcerr.AddBadRequest(connectErr, field, rpcerr.Text(err))
+	}
+	return connectErr
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	_ = h.errorWriter.Write(w, r, err)
+}
+
+// decode returns the request message populated from the body, the query parameters, and the
+// path variables in that order, so that the path variables take precedence
+func (rt *route) decode(body []byte, vars map[string]string, query url.Values) (msg *dynamicpb.Message, err kv.Error) {
+	msg = dynamicpb.NewMessage(rt.desc.Input())
+
+	if len(bytes.TrimSpace(body)) != 0 {
+		switch rt.body {
+		case "":
+			return nil, kv.NewError("the request does not accept a body").With("procedure", rt.procedure, "stack", stack.Trace().TrimRuntime())
+		case "*":
+			if errGo := protojson.Unmarshal(body, msg); errGo != nil {
+				return nil, kv.Wrap(errGo).With("procedure", rt.procedure, "stack", stack.Trace().TrimRuntime())
+			}
+		default:
+			// The body is decoded as the value of the field within a JSON object so that
+			// fields of any type are handled by protojson
+			fd := rt.desc.Input().Fields().ByName(protoreflect.Name(rt.body))
+			doc := append(append([]byte(`{"`+fd.JSONName()+`":`), body...), '}')
+			field := dynamicpb.NewMessage(rt.desc.Input())
+			if errGo := protojson.Unmarshal(doc, field); errGo != nil {
+				return nil, kv.Wrap(errGo).With("field", rt.body, "stack", stack.Trace().TrimRuntime())
+			}
+			proto.Merge(msg, field)
+		}
+	}
+
+	// Query parameters populate the fields not held in the body
+	if rt.body != "*" {
+		for name, values := range query {
+			if err = setField(msg, name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for name, value := range vars {
+		if err = setField(msg, name, []string{value}); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// fieldOf returns the field at the dotted path within a message, fields can be named using
+// either their protobuf, or JSON, names
+func fieldOf(desc protoreflect.MessageDescriptor, path string) (fds []protoreflect.FieldDescriptor, err kv.Error) {
+	for i, name := range strings.Split(path, ".") {
+		if i != 0 {
+			parent := fds[len(fds)-1]
+			if parent.Kind() != protoreflect.MessageKind || parent.IsList() || parent.IsMap() {
+				return nil, kv.NewError("only singular message fields can have fields selected from them").With("field", path, "stack", stack.Trace().TrimRuntime())
+			}
+			desc = parent.Message()
+		}
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = desc.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, kv.NewError("unknown field").With("field", path, "stack", stack.Trace().TrimRuntime())
+		}
+		fds = append(fds, fd)
+	}
+	if last := fds[len(fds)-1]; last.IsMap() {
+		return nil, kv.NewError("map fields cannot be set from the path or query").With("field", path, "stack", stack.Trace().TrimRuntime())
+	}
+	return fds, nil
+}
+
+// setField parses the values into the field at the dotted path, repeated fields receive every
+// value while singular fields receive the last
+func setField(msg protoreflect.Message, path string, values []string) (err kv.Error) {
+	fds, err := fieldOf(msg.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds[:len(fds)-1] {
+		msg = msg.Mutable(fd).Message()
+	}
+	fd := fds[len(fds)-1]
+
+	if !fd.IsList() {
+		if len(values) == 0 {
+			return nil
+		}
+		values = values[len(values)-1:]
+	}
+	for _, text := range values {
+		value, err := parseValue(fd, text)
+		if err != nil {
+			return err.With("field", path)
+		}
+		if fd.IsList() {
+			msg.Mutable(fd).List().Append(value)
+		} else {
+			msg.Set(fd, value)
+		}
+	}
+	return nil
+}
+
+// parseValue parses the text form of a value of the field, messages use the JSON string form
+// of the well known types, for example a google.protobuf.Duration of 1.5s
+func parseValue(fd protoreflect.FieldDescriptor, text string) (value protoreflect.Value, err kv.Error) {
+	var errGo error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), nil
+	case protoreflect.BoolKind:
+		var v bool
+		if v, errGo = strconv.ParseBool(text); errGo == nil {
+			return protoreflect.ValueOfBool(v), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var v int64
+		if v, errGo = strconv.ParseInt(text, 10, 32); errGo == nil {
+			return protoreflect.ValueOfInt32(int32(v)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var v int64
+		if v, errGo = strconv.ParseInt(text, 10, 64); errGo == nil {
+			return protoreflect.ValueOfInt64(v), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var v uint64
+		if v, errGo = strconv.ParseUint(text, 10, 32); errGo == nil {
+			return protoreflect.ValueOfUint32(uint32(v)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var v uint64
+		if v, errGo = strconv.ParseUint(text, 10, 64); errGo == nil {
+			return protoreflect.ValueOfUint64(v), nil
+		}
+	case protoreflect.FloatKind:
+		var v float64
+		if v, errGo = strconv.ParseFloat(text, 32); errGo == nil && !math.IsInf(v, 0) {
+			return protoreflect.ValueOfFloat32(float32(v)), nil
+		}
+	case protoreflect.DoubleKind:
+		var v float64
+		if v, errGo = strconv.ParseFloat(text, 64); errGo == nil {
+			return protoreflect.ValueOfFloat64(v), nil
+		}
+	case protoreflect.BytesKind:
+		var v []byte
+		if v, errGo = base64.StdEncoding.DecodeString(text); errGo != nil {
+			v, errGo = base64.URLEncoding.DecodeString(text)
+		}
+		if errGo == nil {
+			return protoreflect.ValueOfBytes(v), nil
+		}
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(text)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		var v int64
+		if v, errGo = strconv.ParseInt(text, 10, 32); errGo == nil {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+		}
+	case protoreflect.MessageKind:
+		msg := dynamicpb.NewMessage(fd.Message())
+		if errGo = protojson.Unmarshal([]byte(strconv.Quote(text)), msg); errGo == nil {
+			return protoreflect.ValueOfMessage(msg), nil
+		}
+	}
+	if errGo != nil {
+		return protoreflect.Value{}, kv.Wrap(errGo).With("value", text, "stack", stack.Trace().TrimRuntime())
+	}
+	return protoreflect.Value{}, kv.NewError("invalid value").With("value", text, "kind", fd.Kind().String(), "stack", stack.Trace().TrimRuntime())
+}
@@ -0,0 +1,235 @@
+package transcode
+
+// This file contains tests of the decoding of REST requests into request messages, of their
+// translation into Connect requests, and of the errors returned for requests that cannot be
+// transcoded.
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pingv1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+
+	"github.com/karlmutch/buf-ping/pkg/rpcerr"
+)
+
+func TestDecode(t *testing.T) {
+	h := newPingHandler(t, http.NotFoundHandler())
+
+	testCases := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		expected proto.Message
+		field    string
+		isError  bool
+	}{
+		{
+			name:     "body",
+			method:   http.MethodPost,
+			target:   "/v1/set",
+			body:     `{"counter":"a","value64":"5","expected":1}`,
+			expected: &pingv1.SetRequest{Counter: "a", Value64: proto.Int64(5), Expected: proto.Int32(1)},
+		},
+		{
+			name:     "path variable takes precedence over the body",
+			method:   http.MethodPut,
+			target:   "/v1/counters/a",
+			body:     `{"counter":"b","value":5}`,
+			expected: &pingv1.SetRequest{Counter: "a", Value: 5},
+		},
+		{
+			name:     "query",
+			method:   http.MethodGet,
+			target:   "/v1/generate?addition=3&counter=a",
+			expected: &pingv1.GenerateRequest{Addition: 3, Counter: "a"},
+		},
+		{
+			name:     "last query value of a singular field",
+			method:   http.MethodGet,
+			target:   "/v1/generate?addition=3&addition=4",
+			expected: &pingv1.GenerateRequest{Addition: 4},
+		},
+		{
+			name:     "path variable takes precedence over the query",
+			method:   http.MethodGet,
+			target:   "/v1/counters/a?counter=b",
+			expected: &pingv1.PingRequest{Counter: "a"},
+		},
+		{
+			name:     "empty body",
+			method:   http.MethodGet,
+			target:   "/v1/ping",
+			body:     " \n",
+			expected: &pingv1.PingRequest{},
+		},
+		{name: "body refused", method: http.MethodGet, target: "/v1/ping", body: `{"counter":"a"}`, isError: true},
+		{name: "invalid body", method: http.MethodPost, target: "/v1/set", body: `{"value":`, isError: true},
+		{name: "unknown body field", method: http.MethodPost, target: "/v1/set", body: `{"unknown":1}`, isError: true},
+		{name: "unknown query field", method: http.MethodGet, target: "/v1/generate?unknown=1", field: "unknown", isError: true},
+		{name: "invalid query value", method: http.MethodGet, target: "/v1/generate?addition=one", field: "addition", isError: true},
+		{name: "query value out of range", method: http.MethodGet, target: "/v1/generate?addition=3000000000", field: "addition", isError: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			target, errGo := url.Parse(tc.target)
+			if errGo != nil {
+				t.Fatal(errGo)
+			}
+			rt, vars := h.find(tc.method, target.EscapedPath())
+			if rt == nil {
+				t.Fatalf("no route for %s %s", tc.method, tc.target)
+			}
+
+			msg, err := rt.decode([]byte(tc.body), vars, target.Query())
+			switch {
+			case tc.isError && err == nil:
+				t.Fatalf("expected the request to be refused, got %v", msg)
+			case !tc.isError && err != nil:
+				t.Fatal(err.Error())
+			case tc.isError:
+				if field, _ := rpcerr.Field(err, "field"); field != tc.field {
+					t.Fatalf("expected the error to name the field %q, got %q", tc.field, field)
+				}
+				return
+			}
+
+			decoded := tc.expected.ProtoReflect().New().Interface()
+			data, errGo := proto.Marshal(msg)
+			if errGo != nil {
+				t.Fatal(errGo)
+			}
+			if errGo = proto.Unmarshal(data, decoded); errGo != nil {
+				t.Fatal(errGo)
+			}
+			if !proto.Equal(decoded, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, decoded)
+			}
+		})
+	}
+}
+
+// TestServeUnary checks that unary REST requests are passed on as Connect requests for the
+// procedure of their route, and that other requests are passed on unchanged
+func TestServeUnary(t *testing.T) {
+	var received *http.Request
+	receivedBody := ""
+	h := newPingHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received, receivedBody = r, string(body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/counters/a?unused=1", strings.NewReader(`{"value":5}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received == nil {
+		t.Fatal("expected the request to be passed on")
+	}
+	if received.Method != http.MethodPost || received.URL.Path != "/ping.v1.PingService/Set" || len(received.URL.RawQuery) != 0 {
+		t.Errorf("expected a POST to /ping.v1.PingService/Set, got %s %s", received.Method, received.URL)
+	}
+	for name, expected := range map[string]string{
+		"Content-Type":             "application/json",
+		"Connect-Protocol-Version": "1",
+		"Authorization":            "Bearer token",
+	} {
+		if value := received.Header.Get(name); value != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, value)
+		}
+	}
+	msg := &pingv1.SetRequest{}
+	if errGo := protojson.Unmarshal([]byte(receivedBody), msg); errGo != nil {
+		t.Fatal(errGo)
+	}
+	if !proto.Equal(msg, &pingv1.SetRequest{Counter: "a", Value: 5}) {
+		t.Errorf("expected the message to hold the counter, and value, got %v", msg)
+	}
+
+	// Requests that do not match a route reach the next handler untouched
+	received = nil
+	req = httptest.NewRequest(http.MethodPost, "/ping.v1.PingService/Ping?x=1", strings.NewReader(`{}`))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if received != req {
+		t.Errorf("expected the request to be passed on unchanged")
+	}
+}
+
+// TestErrors checks that requests which cannot be transcoded are refused using the status, and
+// JSON error, of the Connect protocol without reaching the next handler
+func TestErrors(t *testing.T) {
+	h := newPingHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %s", r.URL)
+	}))
+
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		field  string
+	}{
+		{name: "unary body", method: http.MethodPost, target: "/v1/set", body: `{"value":"x"}`},
+		{name: "unary query", method: http.MethodGet, target: "/v1/ping?unknown=1", field: "unknown"},
+		{name: "stream query", method: http.MethodGet, target: "/v1/generate?addition=x", field: "addition"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Fatalf("expected a JSON error, got %q", contentType)
+			}
+			wire := &wireError{}
+			if errGo := json.Unmarshal(w.Body.Bytes(), wire); errGo != nil {
+				t.Fatal(errGo)
+			}
+			connectErr := wire.connectError()
+			if connectErr.Code() != connect.CodeInvalidArgument {
+				t.Fatalf("expected %s, got %s", connect.CodeInvalidArgument, connectErr.Code())
+			}
+
+			reason, field := "", ""
+			for _, detail := range connectErr.Details() {
+				value, errGo := detail.Value()
+				if errGo != nil {
+					t.Fatal(errGo)
+				}
+				switch v := value.(type) {
+				case *errdetails.ErrorInfo:
+					reason = v.GetReason()
+				case *errdetails.BadRequest:
+					for _, violation := range v.GetFieldViolations() {
+						field = violation.GetField()
+					}
+				}
+			}
+			if reason != "INVALID_REST_REQUEST" {
+				t.Errorf("expected the reason INVALID_REST_REQUEST, got %q", reason)
+			}
+			if field != tc.field {
+				t.Errorf("expected the bad request to name the field %q, got %q", tc.field, field)
+			}
+		})
+	}
+}
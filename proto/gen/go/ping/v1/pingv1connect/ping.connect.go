@@ -0,0 +1,450 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: ping/v1/ping.proto
+
+package pingv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/karlmutch/buf-ping/proto/gen/go/ping/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// PingServiceName is the fully-qualified name of the PingService service.
+	PingServiceName = "ping.v1.PingService"
+	// FaultServiceName is the fully-qualified name of the FaultService service.
+	FaultServiceName = "ping.v1.FaultService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// PingServicePingProcedure is the fully-qualified name of the PingService's Ping RPC.
+	PingServicePingProcedure = "/ping.v1.PingService/Ping"
+	// PingServiceSumProcedure is the fully-qualified name of the PingService's Sum RPC.
+	PingServiceSumProcedure = "/ping.v1.PingService/Sum"
+	// PingServiceGenerateProcedure is the fully-qualified name of the PingService's Generate RPC.
+	PingServiceGenerateProcedure = "/ping.v1.PingService/Generate"
+	// PingServiceCountProcedure is the fully-qualified name of the PingService's Count RPC.
+	PingServiceCountProcedure = "/ping.v1.PingService/Count"
+	// PingServiceResetProcedure is the fully-qualified name of the PingService's Reset RPC.
+	PingServiceResetProcedure = "/ping.v1.PingService/Reset"
+	// PingServiceSetProcedure is the fully-qualified name of the PingService's Set RPC.
+	PingServiceSetProcedure = "/ping.v1.PingService/Set"
+	// PingServiceWatchProcedure is the fully-qualified name of the PingService's Watch RPC.
+	PingServiceWatchProcedure = "/ping.v1.PingService/Watch"
+	// PingServiceHardFailProcedure is the fully-qualified name of the PingService's HardFail RPC.
+	PingServiceHardFailProcedure = "/ping.v1.PingService/HardFail"
+	// FaultServiceSetFaultRulesProcedure is the fully-qualified name of the FaultService's
+	// SetFaultRules RPC.
+	FaultServiceSetFaultRulesProcedure = "/ping.v1.FaultService/SetFaultRules"
+	// FaultServiceGetFaultRulesProcedure is the fully-qualified name of the FaultService's
+	// GetFaultRules RPC.
+	FaultServiceGetFaultRulesProcedure = "/ping.v1.FaultService/GetFaultRules"
+)
+
+// These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
+var (
+	pingServiceServiceDescriptor              = v1.File_ping_v1_ping_proto.Services().ByName("PingService")
+	pingServicePingMethodDescriptor           = pingServiceServiceDescriptor.Methods().ByName("Ping")
+	pingServiceSumMethodDescriptor            = pingServiceServiceDescriptor.Methods().ByName("Sum")
+	pingServiceGenerateMethodDescriptor       = pingServiceServiceDescriptor.Methods().ByName("Generate")
+	pingServiceCountMethodDescriptor          = pingServiceServiceDescriptor.Methods().ByName("Count")
+	pingServiceResetMethodDescriptor          = pingServiceServiceDescriptor.Methods().ByName("Reset")
+	pingServiceSetMethodDescriptor            = pingServiceServiceDescriptor.Methods().ByName("Set")
+	pingServiceWatchMethodDescriptor          = pingServiceServiceDescriptor.Methods().ByName("Watch")
+	pingServiceHardFailMethodDescriptor       = pingServiceServiceDescriptor.Methods().ByName("HardFail")
+	faultServiceServiceDescriptor             = v1.File_ping_v1_ping_proto.Services().ByName("FaultService")
+	faultServiceSetFaultRulesMethodDescriptor = faultServiceServiceDescriptor.Methods().ByName("SetFaultRules")
+	faultServiceGetFaultRulesMethodDescriptor = faultServiceServiceDescriptor.Methods().ByName("GetFaultRules")
+)
+
+// PingServiceClient is a client for the ping.v1.PingService service.
+type PingServiceClient interface {
+	// Ping is unary RPC function that returns the current counter within the server and a timestamp
+	Ping(context.Context, *connect.Request[v1.PingRequest]) (*connect.Response[v1.PingResponse], error)
+	// Sum is a client streaming RPC function that returns the current counter after the sum requests have
+	// been received from the client
+	Sum(context.Context) *connect.ClientStreamForClient[v1.SumRequest, v1.SumResponse]
+	// Generate is a server streaming RPC function that returns incremental results as a stream of individual increments
+	// to the running sum on the server
+	Generate(context.Context, *connect.Request[v1.GenerateRequest]) (*connect.ServerStreamForClient[v1.GenerateResponse], error)
+	// Count is a bidirectional streaming RPC function that returns incremental results from the a stream of individual increments
+	Count(context.Context) *connect.BidiStreamForClient[v1.CountRequest, v1.CountResponse]
+	// Reset returns a counter to zero, failing with an aborted error if the expected value
+	// is supplied and does not match the current value of the counter
+	Reset(context.Context, *connect.Request[v1.ResetRequest]) (*connect.Response[v1.ResetResponse], error)
+	// Set assigns a value to a counter, failing with an aborted error if the expected value
+	// is supplied and does not match the current value of the counter
+	Set(context.Context, *connect.Request[v1.SetRequest]) (*connect.Response[v1.SetResponse], error)
+	// Watch is a server streaming RPC function that returns the current counter followed by every
+	// subsequent change made to it
+	Watch(context.Context, *connect.Request[v1.WatchRequest]) (*connect.ServerStreamForClient[v1.WatchResponse], error)
+	// HardFail is a hard wired failing rpc
+	HardFail(context.Context, *connect.Request[v1.HardFailRequest]) (*connect.Response[v1.HardFailResponse], error)
+}
+
+// NewPingServiceClient constructs a client for the ping.v1.PingService service. By default, it uses
+// the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewPingServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) PingServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &pingServiceClient{
+		ping: connect.NewClient[v1.PingRequest, v1.PingResponse](
+			httpClient,
+			baseURL+PingServicePingProcedure,
+			connect.WithSchema(pingServicePingMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		sum: connect.NewClient[v1.SumRequest, v1.SumResponse](
+			httpClient,
+			baseURL+PingServiceSumProcedure,
+			connect.WithSchema(pingServiceSumMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		generate: connect.NewClient[v1.GenerateRequest, v1.GenerateResponse](
+			httpClient,
+			baseURL+PingServiceGenerateProcedure,
+			connect.WithSchema(pingServiceGenerateMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		count: connect.NewClient[v1.CountRequest, v1.CountResponse](
+			httpClient,
+			baseURL+PingServiceCountProcedure,
+			connect.WithSchema(pingServiceCountMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		reset: connect.NewClient[v1.ResetRequest, v1.ResetResponse](
+			httpClient,
+			baseURL+PingServiceResetProcedure,
+			connect.WithSchema(pingServiceResetMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		set: connect.NewClient[v1.SetRequest, v1.SetResponse](
+			httpClient,
+			baseURL+PingServiceSetProcedure,
+			connect.WithSchema(pingServiceSetMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		watch: connect.NewClient[v1.WatchRequest, v1.WatchResponse](
+			httpClient,
+			baseURL+PingServiceWatchProcedure,
+			connect.WithSchema(pingServiceWatchMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		hardFail: connect.NewClient[v1.HardFailRequest, v1.HardFailResponse](
+			httpClient,
+			baseURL+PingServiceHardFailProcedure,
+			connect.WithSchema(pingServiceHardFailMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// pingServiceClient implements PingServiceClient.
+type pingServiceClient struct {
+	ping     *connect.Client[v1.PingRequest, v1.PingResponse]
+	sum      *connect.Client[v1.SumRequest, v1.SumResponse]
+	generate *connect.Client[v1.GenerateRequest, v1.GenerateResponse]
+	count    *connect.Client[v1.CountRequest, v1.CountResponse]
+	reset    *connect.Client[v1.ResetRequest, v1.ResetResponse]
+	set      *connect.Client[v1.SetRequest, v1.SetResponse]
+	watch    *connect.Client[v1.WatchRequest, v1.WatchResponse]
+	hardFail *connect.Client[v1.HardFailRequest, v1.HardFailResponse]
+}
+
+// Ping calls ping.v1.PingService.Ping.
+func (c *pingServiceClient) Ping(ctx context.Context, req *connect.Request[v1.PingRequest]) (*connect.Response[v1.PingResponse], error) {
+	return c.ping.CallUnary(ctx, req)
+}
+
+// Sum calls ping.v1.PingService.Sum.
+func (c *pingServiceClient) Sum(ctx context.Context) *connect.ClientStreamForClient[v1.SumRequest, v1.SumResponse] {
+	return c.sum.CallClientStream(ctx)
+}
+
+// Generate calls ping.v1.PingService.Generate.
+func (c *pingServiceClient) Generate(ctx context.Context, req *connect.Request[v1.GenerateRequest]) (*connect.ServerStreamForClient[v1.GenerateResponse], error) {
+	return c.generate.CallServerStream(ctx, req)
+}
+
+// Count calls ping.v1.PingService.Count.
+func (c *pingServiceClient) Count(ctx context.Context) *connect.BidiStreamForClient[v1.CountRequest, v1.CountResponse] {
+	return c.count.CallBidiStream(ctx)
+}
+
+// Reset calls ping.v1.PingService.Reset.
+func (c *pingServiceClient) Reset(ctx context.Context, req *connect.Request[v1.ResetRequest]) (*connect.Response[v1.ResetResponse], error) {
+	return c.reset.CallUnary(ctx, req)
+}
+
+// Set calls ping.v1.PingService.Set.
+func (c *pingServiceClient) Set(ctx context.Context, req *connect.Request[v1.SetRequest]) (*connect.Response[v1.SetResponse], error) {
+	return c.set.CallUnary(ctx, req)
+}
+
+// Watch calls ping.v1.PingService.Watch.
+func (c *pingServiceClient) Watch(ctx context.Context, req *connect.Request[v1.WatchRequest]) (*connect.ServerStreamForClient[v1.WatchResponse], error) {
+	return c.watch.CallServerStream(ctx, req)
+}
+
+// HardFail calls ping.v1.PingService.HardFail.
+func (c *pingServiceClient) HardFail(ctx context.Context, req *connect.Request[v1.HardFailRequest]) (*connect.Response[v1.HardFailResponse], error) {
+	return c.hardFail.CallUnary(ctx, req)
+}
+
+// PingServiceHandler is an implementation of the ping.v1.PingService service.
+type PingServiceHandler interface {
+	// Ping is unary RPC function that returns the current counter within the server and a timestamp
+	Ping(context.Context, *connect.Request[v1.PingRequest]) (*connect.Response[v1.PingResponse], error)
+	// Sum is a client streaming RPC function that returns the current counter after the sum requests have
+	// been received from the client
+	Sum(context.Context, *connect.ClientStream[v1.SumRequest]) (*connect.Response[v1.SumResponse], error)
+	// Generate is a server streaming RPC function that returns incremental results as a stream of individual increments
+	// to the running sum on the server
+	Generate(context.Context, *connect.Request[v1.GenerateRequest], *connect.ServerStream[v1.GenerateResponse]) error
+	// Count is a bidirectional streaming RPC function that returns incremental results from the a stream of individual increments
+	Count(context.Context, *connect.BidiStream[v1.CountRequest, v1.CountResponse]) error
+	// Reset returns a counter to zero, failing with an aborted error if the expected value
+	// is supplied and does not match the current value of the counter
+	Reset(context.Context, *connect.Request[v1.ResetRequest]) (*connect.Response[v1.ResetResponse], error)
+	// Set assigns a value to a counter, failing with an aborted error if the expected value
+	// is supplied and does not match the current value of the counter
+	Set(context.Context, *connect.Request[v1.SetRequest]) (*connect.Response[v1.SetResponse], error)
+	// Watch is a server streaming RPC function that returns the current counter followed by every
+	// subsequent change made to it
+	Watch(context.Context, *connect.Request[v1.WatchRequest], *connect.ServerStream[v1.WatchResponse]) error
+	// HardFail is a hard wired failing rpc
+	HardFail(context.Context, *connect.Request[v1.HardFailRequest]) (*connect.Response[v1.HardFailResponse], error)
+}
+
+// NewPingServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewPingServiceHandler(svc PingServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	pingServicePingHandler := connect.NewUnaryHandler(
+		PingServicePingProcedure,
+		svc.Ping,
+		connect.WithSchema(pingServicePingMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceSumHandler := connect.NewClientStreamHandler(
+		PingServiceSumProcedure,
+		svc.Sum,
+		connect.WithSchema(pingServiceSumMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceGenerateHandler := connect.NewServerStreamHandler(
+		PingServiceGenerateProcedure,
+		svc.Generate,
+		connect.WithSchema(pingServiceGenerateMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceCountHandler := connect.NewBidiStreamHandler(
+		PingServiceCountProcedure,
+		svc.Count,
+		connect.WithSchema(pingServiceCountMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceResetHandler := connect.NewUnaryHandler(
+		PingServiceResetProcedure,
+		svc.Reset,
+		connect.WithSchema(pingServiceResetMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceSetHandler := connect.NewUnaryHandler(
+		PingServiceSetProcedure,
+		svc.Set,
+		connect.WithSchema(pingServiceSetMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceWatchHandler := connect.NewServerStreamHandler(
+		PingServiceWatchProcedure,
+		svc.Watch,
+		connect.WithSchema(pingServiceWatchMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	pingServiceHardFailHandler := connect.NewUnaryHandler(
+		PingServiceHardFailProcedure,
+		svc.HardFail,
+		connect.WithSchema(pingServiceHardFailMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/ping.v1.PingService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PingServicePingProcedure:
+			pingServicePingHandler.ServeHTTP(w, r)
+		case PingServiceSumProcedure:
+			pingServiceSumHandler.ServeHTTP(w, r)
+		case PingServiceGenerateProcedure:
+			pingServiceGenerateHandler.ServeHTTP(w, r)
+		case PingServiceCountProcedure:
+			pingServiceCountHandler.ServeHTTP(w, r)
+		case PingServiceResetProcedure:
+			pingServiceResetHandler.ServeHTTP(w, r)
+		case PingServiceSetProcedure:
+			pingServiceSetHandler.ServeHTTP(w, r)
+		case PingServiceWatchProcedure:
+			pingServiceWatchHandler.ServeHTTP(w, r)
+		case PingServiceHardFailProcedure:
+			pingServiceHardFailHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedPingServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedPingServiceHandler struct{}
+
+func (UnimplementedPingServiceHandler) Ping(context.Context, *connect.Request[v1.PingRequest]) (*connect.Response[v1.PingResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Ping is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Sum(context.Context, *connect.ClientStream[v1.SumRequest]) (*connect.Response[v1.SumResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Sum is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Generate(context.Context, *connect.Request[v1.GenerateRequest], *connect.ServerStream[v1.GenerateResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Generate is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Count(context.Context, *connect.BidiStream[v1.CountRequest, v1.CountResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Count is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Reset(context.Context, *connect.Request[v1.ResetRequest]) (*connect.Response[v1.ResetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Reset is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Set(context.Context, *connect.Request[v1.SetRequest]) (*connect.Response[v1.SetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Set is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Watch(context.Context, *connect.Request[v1.WatchRequest], *connect.ServerStream[v1.WatchResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.Watch is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) HardFail(context.Context, *connect.Request[v1.HardFailRequest]) (*connect.Response[v1.HardFailResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.PingService.HardFail is not implemented"))
+}
+
+// FaultServiceClient is a client for the ping.v1.FaultService service.
+type FaultServiceClient interface {
+	// SetFaultRules replaces the fault injection rules
+	SetFaultRules(context.Context, *connect.Request[v1.SetFaultRulesRequest]) (*connect.Response[v1.SetFaultRulesResponse], error)
+	// GetFaultRules returns the fault injection rules in use
+	GetFaultRules(context.Context, *connect.Request[v1.GetFaultRulesRequest]) (*connect.Response[v1.GetFaultRulesResponse], error)
+}
+
+// NewFaultServiceClient constructs a client for the ping.v1.FaultService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewFaultServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) FaultServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &faultServiceClient{
+		setFaultRules: connect.NewClient[v1.SetFaultRulesRequest, v1.SetFaultRulesResponse](
+			httpClient,
+			baseURL+FaultServiceSetFaultRulesProcedure,
+			connect.WithSchema(faultServiceSetFaultRulesMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getFaultRules: connect.NewClient[v1.GetFaultRulesRequest, v1.GetFaultRulesResponse](
+			httpClient,
+			baseURL+FaultServiceGetFaultRulesProcedure,
+			connect.WithSchema(faultServiceGetFaultRulesMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// faultServiceClient implements FaultServiceClient.
+type faultServiceClient struct {
+	setFaultRules *connect.Client[v1.SetFaultRulesRequest, v1.SetFaultRulesResponse]
+	getFaultRules *connect.Client[v1.GetFaultRulesRequest, v1.GetFaultRulesResponse]
+}
+
+// SetFaultRules calls ping.v1.FaultService.SetFaultRules.
+func (c *faultServiceClient) SetFaultRules(ctx context.Context, req *connect.Request[v1.SetFaultRulesRequest]) (*connect.Response[v1.SetFaultRulesResponse], error) {
+	return c.setFaultRules.CallUnary(ctx, req)
+}
+
+// GetFaultRules calls ping.v1.FaultService.GetFaultRules.
+func (c *faultServiceClient) GetFaultRules(ctx context.Context, req *connect.Request[v1.GetFaultRulesRequest]) (*connect.Response[v1.GetFaultRulesResponse], error) {
+	return c.getFaultRules.CallUnary(ctx, req)
+}
+
+// FaultServiceHandler is an implementation of the ping.v1.FaultService service.
+type FaultServiceHandler interface {
+	// SetFaultRules replaces the fault injection rules
+	SetFaultRules(context.Context, *connect.Request[v1.SetFaultRulesRequest]) (*connect.Response[v1.SetFaultRulesResponse], error)
+	// GetFaultRules returns the fault injection rules in use
+	GetFaultRules(context.Context, *connect.Request[v1.GetFaultRulesRequest]) (*connect.Response[v1.GetFaultRulesResponse], error)
+}
+
+// NewFaultServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewFaultServiceHandler(svc FaultServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	faultServiceSetFaultRulesHandler := connect.NewUnaryHandler(
+		FaultServiceSetFaultRulesProcedure,
+		svc.SetFaultRules,
+		connect.WithSchema(faultServiceSetFaultRulesMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	faultServiceGetFaultRulesHandler := connect.NewUnaryHandler(
+		FaultServiceGetFaultRulesProcedure,
+		svc.GetFaultRules,
+		connect.WithSchema(faultServiceGetFaultRulesMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/ping.v1.FaultService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case FaultServiceSetFaultRulesProcedure:
+			faultServiceSetFaultRulesHandler.ServeHTTP(w, r)
+		case FaultServiceGetFaultRulesProcedure:
+			faultServiceGetFaultRulesHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedFaultServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedFaultServiceHandler struct{}
+
+func (UnimplementedFaultServiceHandler) SetFaultRules(context.Context, *connect.Request[v1.SetFaultRulesRequest]) (*connect.Response[v1.SetFaultRulesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.FaultService.SetFaultRules is not implemented"))
+}
+
+func (UnimplementedFaultServiceHandler) GetFaultRules(context.Context, *connect.Request[v1.GetFaultRulesRequest]) (*connect.Response[v1.GetFaultRulesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("ping.v1.FaultService.GetFaultRules is not implemented"))
+}